@@ -0,0 +1,101 @@
+// Copyright 2020 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// 缓存的准入策略，key在时间窗口内的请求次数（count-min sketch估算）
+// 达到阈值后才允许缓存，避免只访问一次的请求（如爬虫扫描）淘汰常用的缓存。
+// 与lru缓存一样按hash分片，各分片有独立的锁与sketch，避免所有请求竞争同一个锁
+
+package cache
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	defaultAdmissionWindow = time.Minute
+	// sketch的最大容量（每行的宽度），避免占用过多内存
+	maxAdmissionCapacity = 1 << 20
+)
+
+type (
+	admission struct {
+		shards []*admissionShard
+		// 请求次数的阈值
+		threshold int
+		window    time.Duration
+	}
+	// admissionShard the shard of admission
+	admissionShard struct {
+		mu     sync.Mutex
+		sketch *cmSketch
+		// 计数清零的时间
+		resetAt time.Time
+	}
+)
+
+// newAdmission new an admission, the key is admitted if it is requested
+// threshold times within the window. The capacity is split to the shards
+func newAdmission(threshold int, window time.Duration, capacity, shards int) *admission {
+	if window <= 0 {
+		window = defaultAdmissionWindow
+	}
+	if threshold > cmMaxCount {
+		threshold = cmMaxCount
+	}
+	if capacity > maxAdmissionCapacity {
+		capacity = maxAdmissionCapacity
+	}
+	if shards <= 0 {
+		shards = 1
+	}
+	a := &admission{
+		shards:    make([]*admissionShard, shards),
+		threshold: threshold,
+		window:    window,
+	}
+	for i := range a.shards {
+		a.shards[i] = &admissionShard{
+			sketch:  newCMSketch(capacity / shards),
+			resetAt: time.Now().Add(window),
+		}
+	}
+	return a
+}
+
+// mixHash mix the bits of hash, the shard is selected by the modulo of hash,
+// so the hash of sketch should not be related to it
+func mixHash(hash uint64) uint64 {
+	hash ^= hash >> 33
+	hash *= 0xff51afd7ed558ccd
+	hash ^= hash >> 33
+	return hash
+}
+
+// admit increment the count of hash and check it reaches the threshold,
+// the shard is selected as the lru cache(hash % count of shards)
+func (a *admission) admit(hash uint64) bool {
+	shard := a.shards[hash%uint64(len(a.shards))]
+	hash = mixHash(hash)
+	now := time.Now()
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	// 超过时间窗口则重新计数
+	if now.After(shard.resetAt) {
+		shard.sketch.clear()
+		shard.resetAt = now.Add(a.window)
+	}
+	shard.sketch.Increment(hash)
+	return shard.sketch.Estimate(hash) >= a.threshold
+}
@@ -0,0 +1,108 @@
+// Copyright 2020 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vicanso/pike/config"
+)
+
+func TestAdmission(t *testing.T) {
+	assert := assert.New(t)
+	a := newAdmission(3, 0, 100, 0)
+	assert.Equal(defaultAdmissionWindow, a.window)
+	assert.Equal(3, a.threshold)
+	assert.Equal(1, len(a.shards))
+
+	hash := MemHashString("GET aslant.site /books/1")
+	assert.False(a.admit(hash))
+	assert.False(a.admit(hash))
+	assert.True(a.admit(hash))
+	assert.True(a.admit(hash))
+
+	// 超过时间窗口则重新计数
+	a.shards[0].resetAt = time.Now().Add(-time.Second)
+	assert.False(a.admit(hash))
+
+	a = newAdmission(20, time.Second, 1<<30, 1)
+	assert.Equal(cmMaxCount, a.threshold)
+	assert.Equal(uint64(maxAdmissionCapacity-1), a.shards[0].sketch.mask)
+
+	// 按hash分片计数
+	a = newAdmission(2, 0, 4*cmMinWidth, 4)
+	assert.Equal(4, len(a.shards))
+	for i := uint64(0); i < 4; i++ {
+		assert.False(a.admit(i))
+	}
+	shard := a.shards[1]
+	assert.Equal(1, shard.sketch.Estimate(mixHash(1)))
+	assert.Equal(0, shard.sketch.Estimate(mixHash(2)))
+	assert.True(a.admit(1))
+	// 超过时间窗口只重置该分片
+	shard.resetAt = time.Now().Add(-time.Second)
+	assert.False(a.admit(1))
+	assert.True(a.admit(2))
+}
+
+func BenchmarkAdmission(b *testing.B) {
+	a := newAdmission(2, 0, 10*1024, 10)
+	b.RunParallel(func(pb *testing.PB) {
+		i := uint64(0)
+		for pb.Next() {
+			a.admit(MemHashString(strconv.FormatUint(i, 10)))
+			i++
+		}
+	})
+}
+
+func TestDispatcherAdmit(t *testing.T) {
+	assert := assert.New(t)
+	key := []byte("GET aslant.site /books/1")
+
+	// 未设置准入策略，所有key均可缓存
+	d := NewDispatcher(&config.Cache{})
+	assert.True(d.Admit(key))
+
+	cacheConfig := &config.Cache{
+		Size:      1,
+		Zone:      10,
+		Admission: 2,
+	}
+	d = NewDispatcher(cacheConfig)
+	assert.False(d.Admit(key))
+	assert.True(d.Admit(key))
+	assert.Equal(uint64(1), d.Counters().Rejection)
+
+	// 已缓存的key可缓存
+	otherKey := []byte("GET aslant.site /books/2")
+	d.GetHTTPCache(otherKey)
+	assert.True(d.Admit(otherKey))
+
+	// 配置未变化时保留计数
+	newConfig := *cacheConfig
+	newConfig.HitForPass = 10
+	nd := d.reload(&newConfig)
+	assert.Equal(d.admission, nd.admission)
+
+	newConfig.AdmissionWindow = time.Second
+	nd = d.reload(&newConfig)
+	assert.NotEqual(d.admission, nd.admission)
+	thirdKey := []byte("GET aslant.site /books/3")
+	assert.False(nd.Admit(thirdKey))
+}
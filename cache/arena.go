@@ -0,0 +1,301 @@
+// Copyright 2020 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// 缓存数据的page存储，将响应头与响应数据编码后保存至预先分配的大块内存（page）中，
+// 缓存仅保存其偏移量（不包括指针），大量缓存时可减少GC扫描的对象数量。
+// 数据按顺序写入当前page，已写入的区域不会被重用（读取时可直接返回page中的数据，无需复制），
+// page中所有数据都被释放后page也被释放（正在读取的数据仍引用该page，由GC回收），
+// 数据稀疏的page由janitor将其数据迁移至当前page后释放，超过page大小的数据则仍保存在堆中。
+
+package cache
+
+import (
+	"encoding/binary"
+	"sort"
+	"sync"
+)
+
+const (
+	defaultArenaPageSize = 1024 * 1024
+	// 数据按8字节对齐
+	arenaAlign = 8
+	// 长度字段的字节数
+	arenaLenSize = 4
+)
+
+type (
+	// arena the page storage of http data
+	arena struct {
+		mu       sync.RWMutex
+		pageSize int
+		// 已释放的page为nil
+		pages []*arenaPage
+		// 当前写入的page，-1表示无
+		current int
+		// 已释放可重用的page下标
+		free []int
+		// 使用中的数据字节数
+		live int
+	}
+	// arenaPage the page of arena
+	arenaPage struct {
+		buf []byte
+		// 已写入的字节数
+		used int
+		// 使用中的数据字节数
+		live int
+		// 各数据（偏移量）所属的缓存，用于迁移数据
+		owners map[int32]*HTTPCache
+	}
+	// arenaRef the reference of http data in arena, the zero value is invalid
+	arenaRef struct {
+		page   int32
+		offset int32
+		length int32
+		// 占用的字节数（对齐后）
+		size int32
+	}
+)
+
+// newArena new an arena
+func newArena(pageSize int) *arena {
+	if pageSize <= 0 {
+		pageSize = defaultArenaPageSize
+	}
+	return &arena{
+		pageSize: pageSize,
+		current:  -1,
+	}
+}
+
+// alignSize get the size which is aligned to 8 bytes
+func alignSize(size int) int {
+	return (size + arenaAlign - 1) &^ (arenaAlign - 1)
+}
+
+// alloc alloc the region of size(aligned) for owner,
+// a new page is used if the current page doesn't have enough space
+func (a *arena) alloc(length int, owner *HTTPCache) (ref arenaRef, buf []byte) {
+	size := alignSize(length)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.current < 0 || a.pages[a.current].used+size > a.pageSize {
+		a.newPage()
+	}
+	page := a.pages[a.current]
+	offset := page.used
+	page.used += size
+	page.live += size
+	page.owners[int32(offset)] = owner
+	a.live += size
+	ref = arenaRef{
+		page:   int32(a.current),
+		offset: int32(offset),
+		length: int32(length),
+		size:   int32(size),
+	}
+	return ref, page.buf[offset : offset+length]
+}
+
+// newPage create a new page as the current page(the lock should be held)
+func (a *arena) newPage() {
+	page := &arenaPage{
+		buf:    make([]byte, a.pageSize),
+		owners: make(map[int32]*HTTPCache),
+	}
+	if count := len(a.free); count != 0 {
+		a.current = a.free[count-1]
+		a.free = a.free[:count-1]
+		a.pages[a.current] = page
+		return
+	}
+	a.current = len(a.pages)
+	a.pages = append(a.pages, page)
+}
+
+// store encode the http data and save it to arena,
+// returns false if the http data is larger than page
+func (a *arena) store(data *HTTPData, owner *HTTPCache) (ref arenaRef, ok bool) {
+	length := encodedSize(data)
+	if alignSize(length) > a.pageSize {
+		return
+	}
+	ref, buf := a.alloc(length, owner)
+	// 区域已分配给当前数据，写入时无需加锁
+	encodeHTTPData(buf, data)
+	return ref, true
+}
+
+// move copy the data of reference to the current page and release the reference
+func (a *arena) move(ref arenaRef, owner *HTTPCache) arenaRef {
+	nref, buf := a.alloc(int(ref.length), owner)
+	copy(buf, a.getBytes(ref))
+	a.release(ref)
+	return nref
+}
+
+// getBytes get the bytes of reference
+func (a *arena) getBytes(ref arenaRef) []byte {
+	a.mu.RLock()
+	page := a.pages[ref.page]
+	a.mu.RUnlock()
+	start := int(ref.offset)
+	end := start + int(ref.length)
+	return page.buf[start:end:end]
+}
+
+// load decode the data of reference to http data, the bytes of http data
+// is the view of page(not copied), it should not be modified
+func (a *arena) load(ref arenaRef) *HTTPData {
+	return decodeHTTPData(a.getBytes(ref))
+}
+
+// release release the region of reference, the page is released if
+// all its data are released
+func (a *arena) release(ref arenaRef) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	page := a.pages[ref.page]
+	delete(page.owners, ref.offset)
+	page.live -= int(ref.size)
+	a.live -= int(ref.size)
+	if page.live != 0 {
+		return
+	}
+	// 正在读取的数据仍引用page的buf，由GC回收
+	a.pages[ref.page] = nil
+	a.free = append(a.free, int(ref.page))
+	if int(ref.page) == a.current {
+		a.current = -1
+	}
+}
+
+// compact move the data of the sparse pages to the current page,
+// so these pages can be released. It is called by the janitor
+func (a *arena) compact() {
+	owners := a.getSparseOwners()
+	for _, owner := range owners {
+		owner.relocate(a)
+	}
+}
+
+// getSparseOwners get the owners of the sparse pages which should be compacted,
+// the pages are compacted when less than 3/4 of bytes are used
+func (a *arena) getSparseOwners() []*HTTPCache {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	total := 0
+	pages := make([]*arenaPage, 0, len(a.pages))
+	for index, page := range a.pages {
+		if page == nil {
+			continue
+		}
+		total += a.pageSize
+		if index != a.current {
+			pages = append(pages, page)
+		}
+	}
+	if a.live*4 >= total*3 {
+		return nil
+	}
+	// 优先迁移使用字节数最少的page
+	sort.Slice(pages, func(i, j int) bool {
+		return pages[i].live < pages[j].live
+	})
+	owners := make([]*HTTPCache, 0)
+	// 迁移的数据不超过一个page，避免每次迁移过多
+	moved := 0
+	for _, page := range pages {
+		if moved+page.live > a.pageSize {
+			break
+		}
+		moved += page.live
+		for _, owner := range page.owners {
+			owners = append(owners, owner)
+		}
+	}
+	return owners
+}
+
+// Bytes get the byte size of pages
+func (a *arena) Bytes() int {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return (len(a.pages) - len(a.free)) * a.pageSize
+}
+
+// encodedSize get the byte size of encoded http data
+func encodedSize(data *HTTPData) int {
+	// status code, headers count, three bodies
+	size := 5*arenaLenSize + len(data.RawBody) + len(data.GzipBody) + len(data.BrBody)
+	for _, header := range data.Headers {
+		size += 2*arenaLenSize + len(header[0]) + len(header[1])
+	}
+	return size
+}
+
+// encodeHTTPData encode the http data to buf, the length of buf should be the encoded size
+func encodeHTTPData(buf []byte, data *HTTPData) {
+	offset := 0
+	putUint32 := func(v int) {
+		binary.LittleEndian.PutUint32(buf[offset:], uint32(v))
+		offset += arenaLenSize
+	}
+	putBytes := func(b []byte) {
+		putUint32(len(b))
+		offset += copy(buf[offset:], b)
+	}
+	putUint32(data.StatusCode)
+	putUint32(len(data.Headers))
+	for _, header := range data.Headers {
+		putBytes(header[0])
+		putBytes(header[1])
+	}
+	putBytes(data.RawBody)
+	putBytes(data.GzipBody)
+	putBytes(data.BrBody)
+}
+
+// decodeHTTPData decode the http data from buf, the bytes of http data share the buf
+func decodeHTTPData(buf []byte) *HTTPData {
+	offset := 0
+	getUint32 := func() int {
+		v := int(binary.LittleEndian.Uint32(buf[offset:]))
+		offset += arenaLenSize
+		return v
+	}
+	getBytes := func() []byte {
+		size := getUint32()
+		if size == 0 {
+			return nil
+		}
+		b := buf[offset : offset+size : offset+size]
+		offset += size
+		return b
+	}
+	data := &HTTPData{
+		StatusCode: getUint32(),
+	}
+	count := getUint32()
+	if count != 0 {
+		data.Headers = make(HTTPHeaders, count)
+		for i := range data.Headers {
+			data.Headers[i] = NewHTTPHeader(getBytes(), getBytes())
+		}
+	}
+	data.RawBody = getBytes()
+	data.GzipBody = getBytes()
+	data.BrBody = getBytes()
+	return data
+}
@@ -0,0 +1,355 @@
+// Copyright 2020 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"bytes"
+	"net/http"
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vicanso/pike/config"
+)
+
+var storages = []string{
+	config.StorageHeap,
+	config.StorageArena,
+}
+
+func newTestHTTPData(size int) *HTTPData {
+	return &HTTPData{
+		Headers: HTTPHeaders{
+			NewHTTPHeader([]byte("Content-Type"), []byte("application/json")),
+			NewHTTPHeader([]byte("Cache-Control"), []byte("public, max-age=60")),
+			NewHTTPHeader([]byte("ETag"), []byte(`"1-abcd"`)),
+		},
+		StatusCode: 200,
+		RawBody:    bytes.Repeat([]byte("a"), size),
+		GzipBody:   bytes.Repeat([]byte("g"), size/4),
+	}
+}
+
+func TestArena(t *testing.T) {
+	t.Run("align size", func(t *testing.T) {
+		assert := assert.New(t)
+		assert.Equal(0, alignSize(0))
+		assert.Equal(8, alignSize(1))
+		assert.Equal(8, alignSize(8))
+		assert.Equal(16, alignSize(9))
+		assert.Equal(defaultArenaPageSize, newArena(0).pageSize)
+	})
+
+	t.Run("encode and decode", func(t *testing.T) {
+		assert := assert.New(t)
+		data := newTestHTTPData(100)
+		buf := make([]byte, encodedSize(data))
+		encodeHTTPData(buf, data)
+		assert.Equal(data, decodeHTTPData(buf))
+
+		empty := &HTTPData{
+			StatusCode: 204,
+		}
+		buf = make([]byte, encodedSize(empty))
+		encodeHTTPData(buf, empty)
+		assert.Equal(empty, decodeHTTPData(buf))
+	})
+
+	t.Run("store load and release", func(t *testing.T) {
+		assert := assert.New(t)
+		a := newArena(4096)
+		data := newTestHTTPData(100)
+		ref, ok := a.store(data, nil)
+		assert.True(ok)
+		assert.Equal(4096, a.Bytes())
+		assert.Equal(alignSize(encodedSize(data)), int(ref.size))
+		loaded := a.load(ref)
+		assert.Equal(data, loaded)
+		// 读取的数据为page中的数据（未复制）
+		a.load(ref).RawBody[0] = 'b'
+		assert.Equal(byte('b'), a.load(ref).RawBody[0])
+		loaded.RawBody[0] = 'a'
+
+		nref, ok := a.store(data, nil)
+		assert.True(ok)
+		// 按顺序写入，已写入的区域不会被重用
+		assert.Equal(ref.offset+ref.size, nref.offset)
+		a.release(ref)
+		nref2, ok := a.store(data, nil)
+		assert.True(ok)
+		assert.Equal(nref.offset+nref.size, nref2.offset)
+		// 释放前读取的数据不受影响
+		assert.Equal(data, loaded)
+
+		// 超过page大小的不保存
+		_, ok = a.store(newTestHTTPData(4096), nil)
+		assert.False(ok)
+	})
+
+	t.Run("release page", func(t *testing.T) {
+		assert := assert.New(t)
+		a := newArena(1024)
+		data := newTestHTTPData(400)
+		ref1, _ := a.store(data, nil)
+		ref2, _ := a.store(data, nil)
+		// 第二个数据保存在新的page中
+		assert.NotEqual(ref1.page, ref2.page)
+		assert.Equal(2048, a.Bytes())
+		loaded := a.load(ref1)
+
+		a.release(ref1)
+		assert.Equal(1024, a.Bytes())
+		assert.Nil(a.pages[ref1.page])
+		// page释放后正在使用的数据仍可读取
+		assert.Equal(data, loaded)
+
+		// 释放的page下标被重用
+		a.release(ref2)
+		assert.Equal(0, a.Bytes())
+		ref3, _ := a.store(data, nil)
+		assert.Equal(ref2.page, ref3.page)
+		assert.Equal(1024, a.Bytes())
+		assert.Equal(data, a.load(ref3))
+	})
+
+	t.Run("compact", func(t *testing.T) {
+		assert := assert.New(t)
+		a := newArena(1024)
+		caches := make([]*HTTPCache, 6)
+		for i := range caches {
+			hc := NewHTTPCache()
+			hc.arena = a
+			hc.Cachable(60, newTestHTTPData(100))
+			caches[i] = hc
+		}
+		assert.Equal(2048, a.Bytes())
+		// 清除第一个page中的大部分数据
+		caches[0].release()
+		caches[1].release()
+		caches[2].release()
+		assert.Equal(2048, a.Bytes())
+		page := caches[3].ref.page
+
+		a.compact()
+		assert.NotEqual(page, caches[3].ref.page)
+		assert.Nil(a.pages[page])
+		assert.Equal(1024, a.Bytes())
+		for _, hc := range caches[3:] {
+			assert.Equal(newTestHTTPData(100), hc.Data())
+		}
+
+		// 当前page的数据不迁移
+		a.compact()
+		assert.Equal(1024, a.Bytes())
+	})
+}
+
+func TestHTTPCacheArena(t *testing.T) {
+	t.Run("cachable", func(t *testing.T) {
+		assert := assert.New(t)
+		hc := NewHTTPCache()
+		hc.arena = newArena(4096)
+		data := newTestHTTPData(100)
+		hc.Cachable(60, data)
+		assert.Nil(hc.data)
+		assert.NotEqual(int32(0), hc.ref.length)
+		status, cached := hc.Get()
+		assert.Equal(StatusCacheable, status)
+		assert.Equal(data, cached)
+		// 占用的字节数为arena中分配的字节数
+		assert.Equal(int(hc.ref.size), hc.Size())
+		assert.True(hc.Size() > data.Size())
+
+		// 数据过大时保存在堆中
+		large := newTestHTTPData(4096)
+		hc.Cachable(60, large)
+		assert.Equal(large, hc.data)
+		assert.Equal(int32(0), hc.ref.length)
+		assert.Equal(large.Size(), hc.Size())
+
+		hc.HitForPass(60)
+		assert.Nil(hc.Data())
+		assert.Equal(0, hc.Size())
+	})
+
+	t.Run("release", func(t *testing.T) {
+		assert := assert.New(t)
+		hc := NewHTTPCache()
+		hc.arena = newArena(4096)
+		hc.Cachable(60, newTestHTTPData(100))
+		hc.release()
+		assert.Nil(hc.Data())
+		assert.Equal(0, hc.arena.Bytes())
+
+		// 删除后的缓存数据保存在堆中
+		data := newTestHTTPData(100)
+		hc.Cachable(60, data)
+		assert.Equal(data, hc.data)
+	})
+
+	t.Run("vary", func(t *testing.T) {
+		assert := assert.New(t)
+		hc := NewHTTPCache()
+		hc.arena = newArena(4096)
+		zhHeader := make(http.Header)
+		zhHeader.Set("Accept-Language", "zh")
+		enHeader := make(http.Header)
+		enHeader.Set("Accept-Language", "en")
+		vary := []string{"Accept-Language"}
+
+		zhData := newTestHTTPData(100)
+		hc.Vary(300, vary, zhHeader).Cachable(300, zhData)
+		enData := newTestHTTPData(200)
+		hc.GetVariant(enHeader).Cachable(300, enData)
+		for _, header := range []http.Header{zhHeader, enHeader} {
+			variant := hc.GetVariant(header)
+			assert.Nil(variant.data)
+			assert.NotEqual(int32(0), variant.ref.length)
+		}
+		_, data := hc.GetVariant(zhHeader).Get()
+		assert.Equal(zhData, data)
+		_, data = hc.GetVariant(enHeader).Get()
+		assert.Equal(enData, data)
+
+		// 删除缓存时释放variant的数据
+		hc.release()
+		assert.Equal(0, hc.arena.Bytes())
+	})
+
+	t.Run("set arena", func(t *testing.T) {
+		assert := assert.New(t)
+		hc := NewHTTPCache()
+		data := newTestHTTPData(100)
+		hc.Cachable(60, data)
+		hc.setArena(newArena(4096))
+		assert.Nil(hc.data)
+		assert.Equal(data, hc.Data())
+		assert.Equal(int(hc.ref.size), hc.Size())
+
+		hc.setArena(nil)
+		assert.Equal(data, hc.data)
+		assert.Equal(int32(0), hc.ref.length)
+		assert.Equal(data.Size(), hc.Size())
+	})
+}
+
+func TestDispatcherArena(t *testing.T) {
+	assert := assert.New(t)
+	cacheConfig := &config.Cache{
+		Size:    1,
+		Zone:    2,
+		Storage: config.StorageArena,
+	}
+	d := NewDispatcher(cacheConfig)
+	defer d.Close()
+	data := newTestHTTPData(100)
+	for _, key := range []string{"a", "b", "c"} {
+		d.GetHTTPCache([]byte(key)).Cachable(60, data)
+	}
+	assert.Equal(defaultArenaPageSize, d.Stats().ArenaBytes)
+	_, cached := d.GetHTTPCache([]byte("c")).Get()
+	assert.Equal(data, cached)
+	// lru按arena中分配的字节数统计
+	size := int(d.GetHTTPCache([]byte("c")).ref.size)
+	assert.Equal(2*size, d.list[0].Bytes())
+	// 清除的缓存释放其占用的字节
+	live := d.arena.live
+	assert.Equal(1, d.Purge("c"))
+	assert.Equal(live-size, d.arena.live)
+
+	// 修改为堆存储时迁移缓存数据
+	newConfig := *cacheConfig
+	newConfig.Storage = config.StorageHeap
+	nd := d.reload(&newConfig)
+	defer nd.Close()
+	assert.Nil(nd.arena)
+	assert.Equal(0, nd.Stats().ArenaBytes)
+	_, cached = nd.GetHTTPCache([]byte("b")).Get()
+	assert.Equal(data, cached)
+	assert.Equal(data.Size(), nd.list[0].Bytes())
+}
+
+// newStorageLRU new a lru cache of storage and fill it with http caches
+func newStorageLRU(storage string, count, size int) *HTTPCacheLRU {
+	lru := NewHTTPCacheLRU(count)
+	if storage == config.StorageArena {
+		lru.arena = newArena(defaultArenaPageSize)
+	}
+	for i := 0; i < count; i++ {
+		lru.FindOrCreate(strconv.Itoa(i)).Cachable(3600, newTestHTTPData(size))
+	}
+	return lru
+}
+
+// BenchmarkStorageGC compare the gc pause of storages with lots of http caches,
+// the gc pause(ns) of each gc is reported as pause/op
+func BenchmarkStorageGC(b *testing.B) {
+	for _, storage := range storages {
+		b.Run(storage, func(b *testing.B) {
+			lru := newStorageLRU(storage, 100000, 512)
+			runtime.GC()
+			var before, after runtime.MemStats
+			runtime.ReadMemStats(&before)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				runtime.GC()
+			}
+			b.StopTimer()
+			runtime.ReadMemStats(&after)
+			if count := after.NumGC - before.NumGC; count != 0 {
+				b.ReportMetric(float64(after.PauseTotalNs-before.PauseTotalNs)/float64(count), "pause/op")
+			}
+			runtime.KeepAlive(lru)
+		})
+	}
+}
+
+// BenchmarkStorageGet compare the throughput of getting http cache
+func BenchmarkStorageGet(b *testing.B) {
+	for _, storage := range storages {
+		b.Run(storage, func(b *testing.B) {
+			count := 10000
+			lru := newStorageLRU(storage, count, 512)
+			b.ReportAllocs()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					_, _ = lru.FindOrCreate(strconv.Itoa(i % count)).Get()
+					i++
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkStorageCachable compare the throughput of saving http cache,
+// the lru cache is full so each saving evicts an http cache
+func BenchmarkStorageCachable(b *testing.B) {
+	for _, storage := range storages {
+		b.Run(storage, func(b *testing.B) {
+			lru := newStorageLRU(storage, 10000, 512)
+			data := newTestHTTPData(512)
+			start := time.Now().UnixNano()
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				lru.FindOrCreate(strconv.FormatInt(start+int64(i), 10)).Cachable(3600, data)
+			}
+		})
+	}
+}
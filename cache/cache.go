@@ -17,34 +17,123 @@
 package cache
 
 import (
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
 	"github.com/vicanso/pike/config"
+	"github.com/vicanso/pike/log"
 	"github.com/vicanso/pike/util"
+	"go.uber.org/zap"
 )
 
 const (
 	defaultSize       = 10
 	defaultZoneSize   = 1024
 	defaultHitForPass = 300
+	// DefaultSurrogateKeyHeader the default header of surrogate key
+	DefaultSurrogateKeyHeader = "Surrogate-Key"
+	// MB
+	mb = 1024 * 1024
+	// ban的最大数量，超出时则直接清除匹配的缓存
+	maxBans = 256
 )
 
 type (
 	// Dispatcher http cache dispatcher
 	Dispatcher struct {
 		HitForPass int
-		size       uint64
-		list       []*HTTPCacheLRU
+		// StaleWhileRevalidate the default stale while revalidate ttl
+		StaleWhileRevalidate int
+		// StaleIfError the default stale if error ttl
+		StaleIfError int
+		// SurrogateKeyHeader the response header of surrogate key(tags of cache)
+		SurrogateKeyHeader string
+		// WaitTimeout the timeout of waiting for the fetching result, zero means no timeout
+		WaitTimeout time.Duration
+		// WaitTimeoutPass pass the request to upstream when wait timeout, otherwise return 504
+		WaitTimeoutPass bool
+		// StatusTTL the ttl(seconds) of status code, it's used when the response
+		// doesn't have Cache-Control and Expires, such as 404 and 502
+		StatusTTL map[int]int
+		// SnapshotPath the snapshot file of http caches, it's saved when
+		// the server is closed and loaded when the server is started
+		SnapshotPath string
+		size         uint64
+		list         []*HTTPCacheLRU
+		// 二级磁盘缓存
+		disk *DiskCache
+
+		banMu sync.RWMutex
+		bans  []*ban
+		// 创建dispatcher的配置，用于重新加载时判断是否有变化
+		config config.Cache
+		// 统计计数
+		counters *Counters
+		// 缓存的准入策略，nil表示所有请求均可缓存
+		admission *admission
+		// 缓存数据的page存储，nil表示数据保存在堆中
+		arena *arena
+		// 定期清除过期缓存的任务
+		janitorInterval time.Duration
+		janitorDone     chan struct{}
+		janitorOnce     sync.Once
+	}
+	// ban the ban of http cache, the matched caches created before it are invalid
+	ban struct {
+		host string
+		reg  *regexp.Regexp
+		// 创建时间（纳秒），秒级的时间无法区分同一秒内创建的缓存
+		createdNano int64
+	}
+	// DispatcherStats http cache dispatcher stats
+	DispatcherStats struct {
+		Entries      int `json:"entries"`
+		Bytes        int `json:"bytes"`
+		MaxBytes     int `json:"maxBytes"`
+		DiskEntries  int `json:"diskEntries"`
+		DiskBytes    int `json:"diskBytes"`
+		DiskMaxBytes int `json:"diskMaxBytes"`
+		// page存储已分配的字节数
+		ArenaBytes int `json:"arenaBytes,omitempty"`
+		// 等待获取数据的请求数
+		Waiters int `json:"waiters"`
+		// 各缓存等待获取数据的请求数（仅包括有等待的缓存）
+		Waiting map[string]int `json:"waiting,omitempty"`
+		// 统计计数
+		Counters *CountersStats `json:"counters"`
 	}
 	// Dispatchers http cache dispatcher list
 	Dispatchers struct {
 		dispatchers map[string]*Dispatcher
+		// 重新加载时被替换的dispatcher与磁盘缓存，在新的dispatchers生效后关闭
+		stale []io.Closer
 	}
 )
 
 // NewDispatcher new a dispatcher
 func NewDispatcher(cacheConfig *config.Cache) *Dispatcher {
+	disp := newDispatcher(cacheConfig, nil)
+	if disp.config.DiskPath != "" {
+		disp.setDiskCache(disp.openDiskCache())
+	}
+	disp.startJanitor()
+	return disp
+}
+
+// newDispatcher new a dispatcher without disk cache,
+// the counters is created if it is nil
+func newDispatcher(cacheConfig *config.Cache, counters *Counters) *Dispatcher {
 	size := defaultSize
 	zoneSize := defaultZoneSize
 	hitForPass := defaultHitForPass
+	janitorInterval := DefaultJanitorInterval
+	maxMemory := 0
+	eviction := ""
+	var a *arena
 	if cacheConfig != nil {
 		if cacheConfig.Size > 0 {
 			size = cacheConfig.Size
@@ -55,39 +144,547 @@ func NewDispatcher(cacheConfig *config.Cache) *Dispatcher {
 		if cacheConfig.HitForPass > 0 {
 			hitForPass = cacheConfig.HitForPass
 		}
+		maxMemory = cacheConfig.MaxMemory
+		eviction = cacheConfig.Eviction
+		if cacheConfig.JanitorInterval > 0 {
+			janitorInterval = cacheConfig.JanitorInterval
+		}
+		if cacheConfig.Storage == config.StorageArena {
+			a = newArena(defaultArenaPageSize)
+		}
+	}
+	if counters == nil {
+		counters = &Counters{}
 	}
 
 	// 按zoneSize与size创建二维缓存，存放的是LRU缓存实例
 	list := make([]*HTTPCacheLRU, size)
+	// 内存限制平均分配至各lru缓存
+	maxBytes := maxMemory * mb / size
 	for i := 0; i < size; i++ {
-		list[i] = NewHTTPCacheLRU(zoneSize)
+		list[i] = NewHTTPCacheLRUWithPolicy(zoneSize, NewEvictionPolicy(eviction, zoneSize))
+		list[i].MaxBytes = maxBytes
+		list[i].counters = counters
+		list[i].arena = a
+	}
+
+	disp := &Dispatcher{
+		HitForPass:         hitForPass,
+		SurrogateKeyHeader: DefaultSurrogateKeyHeader,
+		size:               uint64(size),
+		list:               list,
+		counters:           counters,
+		arena:              a,
+	}
+	if cacheConfig != nil && cacheConfig.Admission > 0 {
+		disp.admission = newAdmission(cacheConfig.Admission, cacheConfig.AdmissionWindow, size*zoneSize, size)
+	}
+	if cacheConfig != nil {
+		disp.config = *cacheConfig
+		disp.StaleWhileRevalidate = cacheConfig.StaleWhileRevalidate
+		disp.StaleIfError = cacheConfig.StaleIfError
+		if cacheConfig.SurrogateKeyHeader != "" {
+			disp.SurrogateKeyHeader = cacheConfig.SurrogateKeyHeader
+		}
+		disp.WaitTimeout = cacheConfig.WaitTimeout
+		disp.WaitTimeoutPass = cacheConfig.WaitTimeoutPass
+		disp.SnapshotPath = cacheConfig.SnapshotPath
+		for statusCode, ttl := range cacheConfig.GetStatusTTL() {
+			if disp.StatusTTL == nil {
+				disp.StatusTTL = make(map[int]int)
+			}
+			disp.StatusTTL[statusCode] = int(ttl / time.Second)
+		}
+	}
+	disp.janitorInterval = janitorInterval
+	return disp
+}
+
+// startJanitor remove the expired http caches and compact the arena periodically,
+// it should be called after the lru caches are initialized
+func (d *Dispatcher) startJanitor() {
+	d.janitorDone = make(chan struct{})
+	list := d.list
+	a := d.arena
+	done := d.janitorDone
+	go func() {
+		ticker := time.NewTicker(d.janitorInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				// 清除ban匹配的缓存，避免ban一直保留
+				d.applyBans()
+				for _, lruCache := range list {
+					lruCache.RemoveExpired()
+				}
+				// 迁移数据稀疏的page，释放其占用的内存
+				if a != nil {
+					a.compact()
+				}
+			}
+		}
+	}()
+}
+
+// stopJanitor stop the janitor of dispatcher
+func (d *Dispatcher) stopJanitor() {
+	d.janitorOnce.Do(func() {
+		if d.janitorDone != nil {
+			close(d.janitorDone)
+		}
+	})
+}
+
+// openDiskCache open the disk cache of config, returns nil if it fails
+func (d *Dispatcher) openDiskCache() *DiskCache {
+	cacheConfig := d.config
+	disk, err := NewDiskCache(cacheConfig.DiskPath, cacheConfig.DiskSize*mb, cacheConfig.DiskTTL)
+	// 磁盘缓存创建失败只输出日志，仅使用内存缓存
+	if err != nil {
+		log.Default().Error("create disk cache fail",
+			zap.String("name", cacheConfig.Name),
+			zap.String("path", cacheConfig.DiskPath),
+			zap.Error(err),
+		)
+		return nil
+	}
+	return disk
+}
+
+// isSameConfig check the configs of dispatcher are the same,
+// the description and purgedAt are ignored
+func isSameConfig(c1, c2 *config.Cache) bool {
+	return c1.Zone == c2.Zone &&
+		c1.Size == c2.Size &&
+		c1.HitForPass == c2.HitForPass &&
+		c1.StaleWhileRevalidate == c2.StaleWhileRevalidate &&
+		c1.StaleIfError == c2.StaleIfError &&
+		c1.MaxMemory == c2.MaxMemory &&
+		isSameDiskConfig(c1, c2) &&
+		c1.SurrogateKeyHeader == c2.SurrogateKeyHeader &&
+		c1.WaitTimeout == c2.WaitTimeout &&
+		c1.WaitTimeoutPass == c2.WaitTimeoutPass &&
+		c1.SnapshotPath == c2.SnapshotPath &&
+		c1.Eviction == c2.Eviction &&
+		isSameAdmissionConfig(c1, c2) &&
+		c1.JanitorInterval == c2.JanitorInterval &&
+		c1.Storage == c2.Storage &&
+		strings.Join(c1.StatusTTL, ",") == strings.Join(c2.StatusTTL, ",")
+}
+
+// isSameDiskConfig check the disk cache configs are the same
+func isSameDiskConfig(c1, c2 *config.Cache) bool {
+	return c1.DiskPath == c2.DiskPath &&
+		c1.DiskSize == c2.DiskSize &&
+		c1.DiskTTL == c2.DiskTTL
+}
+
+// isSameAdmissionConfig check the admission configs are the same
+func isSameAdmissionConfig(c1, c2 *config.Cache) bool {
+	return c1.Admission == c2.Admission &&
+		c1.AdmissionWindow == c2.AdmissionWindow
+}
+
+// reload create a dispatcher with the new config, and the http caches are kept.
+// If the config isn't changed, returns itself. If the zone, size and eviction aren't changed,
+// the lru caches are shared, otherwise the http caches are migrated to the new lru caches.
+func (d *Dispatcher) reload(cacheConfig *config.Cache) *Dispatcher {
+	if isSameConfig(&d.config, cacheConfig) {
+		return d
+	}
+	nd := newDispatcher(cacheConfig, d.counters)
+	// 由新的dispatcher清除过期缓存
+	d.stopJanitor()
+	d.banMu.RLock()
+	nd.bans = append(nd.bans, d.bans...)
+	d.banMu.RUnlock()
+
+	sameLayout := d.config.Zone == cacheConfig.Zone &&
+		d.config.Size == cacheConfig.Size &&
+		d.config.Eviction == cacheConfig.Eviction &&
+		d.config.Storage == cacheConfig.Storage
+	// 准入策略未变化则保留已有的计数
+	if sameLayout && isSameAdmissionConfig(&d.config, cacheConfig) {
+		nd.admission = d.admission
+	}
+	if sameLayout {
+		maxBytes := nd.list[0].MaxBytes
+		nd.list = d.list
+		nd.arena = d.arena
+		for _, lruCache := range nd.list {
+			lruCache.Lock()
+			lruCache.MaxBytes = maxBytes
+			lruCache.Unlock()
+		}
+	}
+
+	// 磁盘缓存配置未变化则继续使用，路径未变化则仅更新其限制，
+	// 否则创建新的磁盘缓存（原有的磁盘缓存由Dispatchers在新配置生效后关闭）
+	disk := d.disk
+	if disk != nil && !isSameDiskConfig(&d.config, cacheConfig) {
+		if d.config.DiskPath == cacheConfig.DiskPath {
+			disk.setLimits(cacheConfig.DiskSize*mb, cacheConfig.DiskTTL)
+		} else {
+			disk = nil
+		}
+	}
+	if disk == nil && cacheConfig.DiskPath != "" {
+		disk = nd.openDiskCache()
+	}
+	nd.setDiskCache(disk)
+
+	if !sameLayout {
+		nd.migrate(d.list)
+	}
+	nd.startJanitor()
+	return nd
+}
+
+// migrate move the http caches of the lru caches to dispatcher, the older is moved first
+func (d *Dispatcher) migrate(list []*HTTPCacheLRU) {
+	for _, lruCache := range list {
+		lruCache.Lock()
+		items := lruCache.removeAll()
+		lruCache.Unlock()
+		for _, item := range items {
+			d.getLRU([]byte(item.key)).attach(item.key, item.value)
+		}
+	}
+}
+
+// setDiskCache set the disk cache of dispatcher, the evicted http cache
+// will be saved to disk cache, and loaded from it when created.
+// If the disk cache is nil, the disk cache of dispatcher is removed.
+func (d *Dispatcher) setDiskCache(disk *DiskCache) {
+	d.disk = disk
+	for _, lruCache := range d.list {
+		lruCache.Lock()
+		if disk == nil {
+			lruCache.OnEvicted = nil
+			lruCache.Loader = nil
+		} else {
+			lruCache.OnEvicted = func(key string, value *HTTPCache) {
+				disk.Demote(key, value)
+			}
+			lruCache.Loader = func(key string, value *HTTPCache) {
+				disk.Promote(key, value)
+			}
+		}
+		lruCache.Unlock()
 	}
+}
 
-	return &Dispatcher{
-		HitForPass: hitForPass,
-		size:       uint64(size),
-		list:       list,
+// Admit check the key is admitted to be cached, the key is admitted if it is
+// cached already or it is requested the times of admission within the window.
+// All keys are admitted if the admission isn't set.
+func (d *Dispatcher) Admit(key []byte) bool {
+	if d.admission == nil {
+		return true
 	}
+	lru := d.getLRU(key)
+	k := util.ByteSliceToString(key)
+	lru.Lock()
+	_, ok := lru.Peek(k)
+	lru.Unlock()
+	if ok || (d.disk != nil && d.disk.Has(k)) {
+		return true
+	}
+	if d.admission.admit(MemHash(key)) {
+		return true
+	}
+	d.counters.addRejection()
+	return false
 }
 
 // GetHTTPCache get http cache through key
 func (d *Dispatcher) GetHTTPCache(key []byte) *HTTPCache {
+	lru := d.getLRU(key)
+	k := util.ByteSliceToString(key)
+	hc := lru.FindOrCreate(k)
+	// 如果缓存已被ban，则删除并重新创建
+	if d.isBanned(k, hc.getCreatedNano()) {
+		lru.Lock()
+		value, ok := lru.Peek(k)
+		if ok && value == hc {
+			lru.Remove(k)
+		}
+		lru.Unlock()
+		hc = lru.FindOrCreate(k)
+	}
+	return hc
+}
+
+func (b *ban) match(key string) bool {
+	_, host, uri := util.ParseIdentity(key)
+	if b.host != "" && b.host != host {
+		return false
+	}
+	return b.reg.MatchString(uri)
+}
+
+// Ban add a ban of the uri pattern(regexp), the matched http caches
+// which are created before it will be invalid when they are got
+func (d *Dispatcher) Ban(host, pattern string) error {
+	reg, err := regexp.Compile(pattern)
+	if err != nil {
+		return err
+	}
+	d.banMu.Lock()
+	d.bans = append(d.bans, &ban{
+		host:        host,
+		reg:         reg,
+		createdNano: time.Now().UnixNano(),
+	})
+	count := len(d.bans)
+	d.banMu.Unlock()
+	if count > maxBans {
+		d.applyBans()
+	}
+	return nil
+}
+
+// isBanned check the http cache which is created at the time(unix nanoseconds) is banned
+func (d *Dispatcher) isBanned(key string, createdNano int64) bool {
+	if createdNano == 0 {
+		return false
+	}
+	d.banMu.RLock()
+	defer d.banMu.RUnlock()
+	return isBannedBy(d.bans, key, createdNano)
+}
+
+// isBannedBy check the http cache which is created at the time(unix nanoseconds) matches the bans
+func isBannedBy(bans []*ban, key string, createdNano int64) bool {
+	if createdNano == 0 {
+		return false
+	}
+	for _, b := range bans {
+		if createdNano < b.createdNano && b.match(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// applyBans remove the http caches which are banned, and clear the bans.
+// The http caches created after the bans are kept, and the disk caches
+// which match the bans are removed(the created time isn't saved in index)
+func (d *Dispatcher) applyBans() int {
+	d.banMu.Lock()
+	bans := d.bans
+	d.bans = nil
+	d.banMu.Unlock()
+	if len(bans) == 0 {
+		return 0
+	}
+	removedKeys := make(map[string]bool)
+	for _, lruCache := range d.list {
+		keys := lruCache.removeBy(func(key string, value *HTTPCache) bool {
+			return isBannedBy(bans, key, value.getCreatedNano())
+		})
+		for _, key := range keys {
+			removedKeys[key] = true
+		}
+	}
+	if d.disk != nil {
+		keys := d.disk.RemoveBy(func(key string) bool {
+			for _, b := range bans {
+				if b.match(key) {
+					return true
+				}
+			}
+			return false
+		})
+		for _, key := range keys {
+			removedKeys[key] = true
+		}
+	}
+	return len(removedKeys)
+}
+
+// getLRU get the lru cache of key
+func (d *Dispatcher) getLRU(key []byte) *HTTPCacheLRU {
 	// 计算hash值
 	index := MemHash(key) % d.size
 	// 从预定义的列表中取对应的缓存
-	lru := d.list[index]
-	return lru.FindOrCreate(util.ByteSliceToString(key))
+	return d.list[index]
+}
+
+// Purge remove the http cache of key(include disk cache),
+// returns the count of removed
+func (d *Dispatcher) Purge(key string) int {
+	lru := d.getLRU([]byte(key))
+	lru.Lock()
+	_, ok := lru.Peek(key)
+	if ok {
+		lru.Remove(key)
+	}
+	lru.Unlock()
+	if d.disk != nil && d.disk.Remove(key) {
+		ok = true
+	}
+	if ok {
+		return 1
+	}
+	return 0
+}
+
+// AddTags add the tags to the http cache of key
+func (d *Dispatcher) AddTags(key []byte, tags ...string) {
+	d.getLRU(key).AddTags(util.ByteSliceToString(key), tags...)
+}
+
+// PurgeByTag remove the http caches which have the tag(include disk cache),
+// returns the count of removed
+func (d *Dispatcher) PurgeByTag(tag string) int {
+	removedKeys := make(map[string]bool)
+	for _, lruCache := range d.list {
+		for _, key := range lruCache.RemoveByTag(tag) {
+			removedKeys[key] = true
+		}
+	}
+	if d.disk != nil {
+		for _, key := range d.disk.RemoveByTag(tag) {
+			removedKeys[key] = true
+		}
+	}
+	return len(removedKeys)
+}
+
+// PurgeBy remove the http caches which match the function(include disk cache),
+// returns the count of removed
+func (d *Dispatcher) PurgeBy(match func(key string) bool) int {
+	removedKeys := make(map[string]bool)
+	for _, lruCache := range d.list {
+		for _, key := range lruCache.RemoveBy(match) {
+			removedKeys[key] = true
+		}
+	}
+	if d.disk != nil {
+		for _, key := range d.disk.RemoveBy(match) {
+			removedKeys[key] = true
+		}
+	}
+	return len(removedKeys)
 }
 
-// RemoveExpired remove expired cache
+// RemoveExpired remove expired cache(include the banned cache)
 func (d *Dispatcher) RemoveExpired() int {
-	count := 0
+	count := d.applyBans()
 	for _, lruCache := range d.list {
 		count += lruCache.RemoveExpired()
 	}
 	return count
 }
 
+// Keys get the sorted keys of http caches which have the prefix
+func (d *Dispatcher) Keys(prefix string) []string {
+	keys := make([]string, 0)
+	for _, lruCache := range d.list {
+		lruCache.Lock()
+		for _, key := range lruCache.Keys() {
+			if strings.HasPrefix(key, prefix) {
+				keys = append(keys, key)
+			}
+		}
+		lruCache.Unlock()
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Inspect get the information of http cache, it returns nil if the cache is not exists
+func (d *Dispatcher) Inspect(key string, withHeader bool) *HTTPCacheInfo {
+	lru := d.getLRU([]byte(key))
+	lru.Lock()
+	hc, ok := lru.Peek(key)
+	lru.Unlock()
+	if !ok {
+		return nil
+	}
+	info := hc.Info(withHeader)
+	info.Key = key
+	return info
+}
+
+// List list the information of http caches(sorted by key) which have the prefix
+func (d *Dispatcher) List(prefix string, offset, limit int) (infos []*HTTPCacheInfo, count int) {
+	keys := d.Keys(prefix)
+	count = len(keys)
+	if offset >= count {
+		return
+	}
+	end := offset + limit
+	if end > count {
+		end = count
+	}
+	infos = make([]*HTTPCacheInfo, 0, end-offset)
+	for _, key := range keys[offset:end] {
+		info := d.Inspect(key, false)
+		// 缓存有可能已被删除
+		if info != nil {
+			infos = append(infos, info)
+		}
+	}
+	return
+}
+
+// AddPass add the count of pass request, the pass request doesn't get the http cache
+func (d *Dispatcher) AddPass() {
+	d.counters.addLookup(StatusPassed)
+}
+
+// Counters get the stats of counters
+func (d *Dispatcher) Counters() *CountersStats {
+	return d.counters.Stats()
+}
+
+// Stats get the stats of dispatcher
+func (d *Dispatcher) Stats() *DispatcherStats {
+	stats := &DispatcherStats{
+		Counters: d.counters.Stats(),
+	}
+	for _, lruCache := range d.list {
+		lruCache.Lock()
+		stats.Entries += lruCache.Len()
+		stats.Bytes += lruCache.Bytes()
+		stats.MaxBytes += lruCache.MaxBytes
+		lruCache.ForEach(func(key string, value *HTTPCache) {
+			waiters := value.Waiters()
+			if waiters == 0 {
+				return
+			}
+			if stats.Waiting == nil {
+				stats.Waiting = make(map[string]int)
+			}
+			stats.Waiting[key] = waiters
+			stats.Waiters += waiters
+		})
+		lruCache.Unlock()
+	}
+	if d.arena != nil {
+		stats.ArenaBytes = d.arena.Bytes()
+	}
+	if d.disk != nil {
+		stats.DiskEntries = d.disk.Len()
+		stats.DiskBytes = d.disk.Bytes()
+		stats.DiskMaxBytes = d.disk.getMaxBytes()
+	}
+	return stats
+}
+
+// Close close the dispatcher
+func (d *Dispatcher) Close() error {
+	d.stopJanitor()
+	if d.disk == nil {
+		return nil
+	}
+	return d.disk.Close()
+}
+
 // Get get dispatcher
 func (ds *Dispatchers) Get(name string) *Dispatcher {
 	return ds.dispatchers[name]
@@ -103,3 +700,85 @@ func NewDispatchers(cachesConfig config.Caches) (ds *Dispatchers) {
 	ds.dispatchers = dispatchers
 	return
 }
+
+// ForEach for each all dispatchers
+func (ds *Dispatchers) ForEach(fn func(name string, d *Dispatcher)) {
+	for name, d := range ds.dispatchers {
+		fn(name, d)
+	}
+}
+
+// Stats get the stats of all dispatchers
+func (ds *Dispatchers) Stats() map[string]*DispatcherStats {
+	result := make(map[string]*DispatcherStats)
+	for name, d := range ds.dispatchers {
+		result[name] = d.Stats()
+	}
+	return result
+}
+
+// Reload reload the dispatchers with the configs, the dispatcher of the same name
+// keeps its http caches(migrated if the zone or size is changed),
+// and the new dispatcher loads its snapshot if it has snapshot path.
+// The dispatcher which isn't in the configs and the replaced disk cache
+// aren't closed until CloseStale is called, because the requests may still use them.
+func (ds *Dispatchers) Reload(cachesConfig config.Caches) *Dispatchers {
+	if ds == nil {
+		ds = NewDispatchers(cachesConfig)
+		ds.LoadSnapshots()
+		return ds
+	}
+	dispatchers := make(map[string]*Dispatcher)
+	stale := make([]io.Closer, 0)
+	for _, item := range cachesConfig {
+		d, ok := ds.dispatchers[item.Name]
+		if !ok {
+			// 新增的缓存从快照中恢复
+			nd := NewDispatcher(item)
+			nd.loadSnapshotOfPath(item.Name)
+			dispatchers[item.Name] = nd
+			continue
+		}
+		nd := d.reload(item)
+		if d.disk != nil && d.disk != nd.disk {
+			stale = append(stale, d.disk)
+		}
+		dispatchers[item.Name] = nd
+	}
+	for name, d := range ds.dispatchers {
+		if _, ok := dispatchers[name]; !ok {
+			stale = append(stale, d)
+		}
+	}
+	return &Dispatchers{
+		dispatchers: dispatchers,
+		stale:       stale,
+	}
+}
+
+// CloseStale close the dispatchers and disk caches which are replaced by reload,
+// it should be called after the new dispatchers are used by the requests
+func (ds *Dispatchers) CloseStale() {
+	for _, item := range ds.stale {
+		err := item.Close()
+		if err != nil {
+			log.Default().Error("close stale dispatcher fail",
+				zap.Error(err),
+			)
+		}
+	}
+	ds.stale = nil
+}
+
+// Close close all dispatchers
+func (ds *Dispatchers) Close() {
+	for name, d := range ds.dispatchers {
+		err := d.Close()
+		if err != nil {
+			log.Default().Error("close dispatcher fail",
+				zap.String("name", name),
+				zap.Error(err),
+			)
+		}
+	}
+}
@@ -0,0 +1,278 @@
+// Copyright 2020 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Cache-Control的解析（RFC 9111与RFC 5861），
+// 以共享缓存的角度计算响应的有效期以及过期后是否可使用
+
+package cache
+
+import (
+	"math"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vicanso/elton"
+)
+
+const (
+	headerAge     = "Age"
+	headerDate    = "Date"
+	headerExpires = "Expires"
+
+	// delta-seconds超出时使用的最大值（RFC 9111 1.2.2）
+	maxDeltaSeconds = math.MaxInt32
+)
+
+type (
+	// CacheControl the directives of Cache-Control,
+	// the delta-seconds value is -1 if the directive isn't set.
+	CacheControl struct {
+		NoStore         bool
+		NoCache         bool
+		Private         bool
+		Public          bool
+		MustRevalidate  bool
+		ProxyRevalidate bool
+		// no-cache与private指定的字段，如no-cache="Set-Cookie"
+		NoCacheFields []string
+		PrivateFields []string
+
+		MaxAge               int
+		SMaxAge              int
+		StaleWhileRevalidate int
+		StaleIfError         int
+	}
+	// Freshness the freshness of response for shared cache
+	Freshness struct {
+		// TTL the remaining freshness lifetime(seconds), the response isn't cacheable if it is 0
+		TTL int
+		// StaleWhileRevalidate the value of stale-while-revalidate, -1 if it isn't set
+		StaleWhileRevalidate int
+		// StaleIfError the value of stale-if-error, -1 if it isn't set
+		StaleIfError int
+		// MustRevalidate the stale response shouldn't be used without revalidation,
+		// it's set by must-revalidate, proxy-revalidate or s-maxage(for shared cache),
+		// only the stale-while-revalidate and stale-if-error of response can be used
+		MustRevalidate bool
+		// IgnoreFields the header fields should be removed before caching,
+		// such as no-cache="Set-Cookie"
+		IgnoreFields []string
+	}
+)
+
+// splitDirectives split the Cache-Control value by comma, the comma in quoted string is ignored
+func splitDirectives(value string) []string {
+	result := make([]string, 0)
+	inQuote := false
+	start := 0
+	for i := 0; i < len(value); i++ {
+		switch value[i] {
+		case '\\':
+			if inQuote {
+				i++
+			}
+		case '"':
+			inQuote = !inQuote
+		case ',':
+			if !inQuote {
+				result = append(result, value[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(result, value[start:])
+}
+
+// unquote unquote the quoted-string, the quoted-pair is unescaped
+func unquote(value string) string {
+	if len(value) < 2 || value[0] != '"' || value[len(value)-1] != '"' {
+		return value
+	}
+	value = value[1 : len(value)-1]
+	if strings.IndexByte(value, '\\') == -1 {
+		return value
+	}
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] == '\\' && i+1 < len(value) {
+			i++
+		}
+		b.WriteByte(value[i])
+	}
+	return b.String()
+}
+
+// parseDeltaSeconds parse the delta-seconds, returns 0 if it is invalid(treat as stale)
+func parseDeltaSeconds(value string) int {
+	if value == "" {
+		return 0
+	}
+	for _, ch := range value {
+		if ch < '0' || ch > '9' {
+			return 0
+		}
+	}
+	v, err := strconv.Atoi(value)
+	if err != nil || v > maxDeltaSeconds {
+		return maxDeltaSeconds
+	}
+	return v
+}
+
+// parseFields parse the field names of no-cache="a, b"
+func parseFields(value string) []string {
+	fields := make([]string, 0)
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			fields = append(fields, textproto.CanonicalMIMEHeaderKey(item))
+		}
+	}
+	return fields
+}
+
+// ParseCacheControl parse the value of Cache-Control
+func ParseCacheControl(value string) *CacheControl {
+	cc := &CacheControl{
+		MaxAge:               -1,
+		SMaxAge:              -1,
+		StaleWhileRevalidate: -1,
+		StaleIfError:         -1,
+	}
+	for _, directive := range splitDirectives(value) {
+		directive = strings.TrimSpace(directive)
+		if directive == "" {
+			continue
+		}
+		name := directive
+		value := ""
+		if index := strings.IndexByte(directive, '='); index != -1 {
+			name = strings.TrimSpace(directive[:index])
+			value = strings.TrimSpace(directive[index+1:])
+			value = unquote(value)
+		}
+		switch strings.ToLower(name) {
+		case "no-store":
+			cc.NoStore = true
+		case "no-cache":
+			// 指定字段的no-cache仅表示该字段不可缓存
+			if value == "" {
+				cc.NoCache = true
+			} else {
+				cc.NoCacheFields = append(cc.NoCacheFields, parseFields(value)...)
+			}
+		case "private":
+			if value == "" {
+				cc.Private = true
+			} else {
+				cc.PrivateFields = append(cc.PrivateFields, parseFields(value)...)
+			}
+		case "public":
+			cc.Public = true
+		case "must-revalidate":
+			cc.MustRevalidate = true
+		case "proxy-revalidate":
+			cc.ProxyRevalidate = true
+		// 如果有重复的指令，则使用第一个
+		case "max-age":
+			if cc.MaxAge == -1 {
+				cc.MaxAge = parseDeltaSeconds(value)
+			}
+		case "s-maxage":
+			if cc.SMaxAge == -1 {
+				cc.SMaxAge = parseDeltaSeconds(value)
+			}
+		case "stale-while-revalidate":
+			if cc.StaleWhileRevalidate == -1 {
+				cc.StaleWhileRevalidate = parseDeltaSeconds(value)
+			}
+		case "stale-if-error":
+			if cc.StaleIfError == -1 {
+				cc.StaleIfError = parseDeltaSeconds(value)
+			}
+		}
+	}
+	return cc
+}
+
+// parseHTTPTime parse the http date of header
+func parseHTTPTime(header http.Header, name string) (t time.Time, ok bool) {
+	value := header.Get(name)
+	if value == "" {
+		return
+	}
+	t, err := http.ParseTime(value)
+	if err != nil {
+		return
+	}
+	return t, true
+}
+
+// GetFreshness get the freshness of response, the freshness lifetime is
+// from s-maxage, max-age or Expires(minus Date), and the current age is the
+// greater of Age and the apparent age(now minus Date).
+func GetFreshness(header http.Header, now time.Time) *Freshness {
+	cc := ParseCacheControl(strings.Join(header[elton.HeaderCacheControl], ","))
+	f := &Freshness{
+		StaleWhileRevalidate: cc.StaleWhileRevalidate,
+		StaleIfError:         cc.StaleIfError,
+		MustRevalidate:       cc.MustRevalidate || cc.ProxyRevalidate || cc.SMaxAge != -1,
+	}
+	f.IgnoreFields = append(f.IgnoreFields, cc.NoCacheFields...)
+	f.IgnoreFields = append(f.IgnoreFields, cc.PrivateFields...)
+	// 共享缓存不可保存no-store与private，
+	// no-cache表示每次都需要重新校验，也作为不可缓存处理
+	if cc.NoStore || cc.Private || cc.NoCache {
+		return f
+	}
+	date, hasDate := parseHTTPTime(header, headerDate)
+	lifetime := 0
+	switch {
+	case cc.SMaxAge != -1:
+		lifetime = cc.SMaxAge
+	case cc.MaxAge != -1:
+		lifetime = cc.MaxAge
+	case header.Get(headerExpires) != "":
+		// 无效的Expires（如0）表示已过期
+		expires, ok := parseHTTPTime(header, headerExpires)
+		if !ok {
+			return f
+		}
+		if !hasDate {
+			date = now
+		}
+		lifetime = int(expires.Sub(date) / time.Second)
+	}
+	if lifetime <= 0 {
+		return f
+	}
+
+	age := 0
+	if value := header.Get(headerAge); value != "" {
+		age = parseDeltaSeconds(value)
+	}
+	if hasDate {
+		apparentAge := int(now.Sub(date) / time.Second)
+		if apparentAge > age {
+			age = apparentAge
+		}
+	}
+	if age < lifetime {
+		f.TTL = lifetime - age
+	}
+	return f
+}
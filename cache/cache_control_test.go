@@ -0,0 +1,242 @@
+// Copyright 2020 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vicanso/elton"
+)
+
+func TestParseCacheControl(t *testing.T) {
+	assert := assert.New(t)
+
+	cc := ParseCacheControl("")
+	assert.Equal(&CacheControl{
+		MaxAge:               -1,
+		SMaxAge:              -1,
+		StaleWhileRevalidate: -1,
+		StaleIfError:         -1,
+	}, cc)
+
+	cc = ParseCacheControl(`Public, MAX-AGE=60, s-maxage="30", must-revalidate, proxy-revalidate, stale-while-revalidate=10, stale-if-error=600`)
+	assert.True(cc.Public)
+	assert.True(cc.MustRevalidate)
+	assert.True(cc.ProxyRevalidate)
+	assert.Equal(60, cc.MaxAge)
+	assert.Equal(30, cc.SMaxAge)
+	assert.Equal(10, cc.StaleWhileRevalidate)
+	assert.Equal(600, cc.StaleIfError)
+
+	// RFC 9111 5.2.2.4与5.2.2.7，指定字段的no-cache与private
+	cc = ParseCacheControl(`max-age=60, no-cache="set-cookie, X-Token", private="X-User"`)
+	assert.False(cc.NoCache)
+	assert.False(cc.Private)
+	assert.Equal([]string{"Set-Cookie", "X-Token"}, cc.NoCacheFields)
+	assert.Equal([]string{"X-User"}, cc.PrivateFields)
+
+	cc = ParseCacheControl("no-cache, no-store, private")
+	assert.True(cc.NoCache)
+	assert.True(cc.NoStore)
+	assert.True(cc.Private)
+
+	// 无效的delta-seconds作为过期处理，重复的指令使用第一个
+	cc = ParseCacheControl("max-age=-1, s-maxage=abc, max-age=60, stale-if-error=99999999999999999999")
+	assert.Equal(0, cc.MaxAge)
+	assert.Equal(0, cc.SMaxAge)
+	assert.Equal(maxDeltaSeconds, cc.StaleIfError)
+
+	assert.Equal(`a"b\c`, unquote(`"a\"b\\c"`))
+	assert.Equal("abc", unquote("abc"))
+}
+
+func TestGetFreshness(t *testing.T) {
+	now := time.Date(2020, 1, 2, 15, 4, 5, 0, time.UTC)
+	formatTime := func(d time.Duration) string {
+		return now.Add(d).Format(http.TimeFormat)
+	}
+	tests := []struct {
+		name           string
+		header         map[string]string
+		ttl            int
+		mustRevalidate bool
+		ignoreFields   []string
+	}{
+		{
+			name: "no cache-control",
+		},
+		{
+			name: "max-age",
+			header: map[string]string{
+				elton.HeaderCacheControl: "public, max-age=60",
+			},
+			ttl: 60,
+		},
+		{
+			name: "s-maxage overrides max-age",
+			header: map[string]string{
+				elton.HeaderCacheControl: "max-age=60, s-maxage=30",
+			},
+			ttl:            30,
+			mustRevalidate: true,
+		},
+		{
+			name: "s-maxage=0",
+			header: map[string]string{
+				elton.HeaderCacheControl: "max-age=60, s-maxage=0",
+			},
+			mustRevalidate: true,
+		},
+		{
+			name: "no-store",
+			header: map[string]string{
+				elton.HeaderCacheControl: "max-age=60, no-store",
+			},
+		},
+		{
+			name: "no-cache",
+			header: map[string]string{
+				elton.HeaderCacheControl: "max-age=60, no-cache",
+			},
+		},
+		{
+			name: "private",
+			header: map[string]string{
+				elton.HeaderCacheControl: "max-age=60, private",
+			},
+		},
+		{
+			name: "no-cache with field",
+			header: map[string]string{
+				elton.HeaderCacheControl: `max-age=60, no-cache="Set-Cookie"`,
+			},
+			ttl:          60,
+			ignoreFields: []string{"Set-Cookie"},
+		},
+		{
+			name: "must-revalidate",
+			header: map[string]string{
+				elton.HeaderCacheControl: "max-age=60, must-revalidate",
+			},
+			ttl:            60,
+			mustRevalidate: true,
+		},
+		{
+			name: "proxy-revalidate",
+			header: map[string]string{
+				elton.HeaderCacheControl: "max-age=60, proxy-revalidate",
+			},
+			ttl:            60,
+			mustRevalidate: true,
+		},
+		{
+			name: "age",
+			header: map[string]string{
+				elton.HeaderCacheControl: "max-age=60",
+				headerAge:                "20",
+			},
+			ttl: 40,
+		},
+		{
+			name: "age exceeds max-age",
+			header: map[string]string{
+				elton.HeaderCacheControl: "max-age=60",
+				headerAge:                "100",
+			},
+		},
+		{
+			name: "invalid age",
+			header: map[string]string{
+				elton.HeaderCacheControl: "max-age=60",
+				headerAge:                "-20",
+			},
+			ttl: 60,
+		},
+		{
+			name: "apparent age from date",
+			header: map[string]string{
+				elton.HeaderCacheControl: "max-age=60",
+				headerDate:               formatTime(-10 * time.Second),
+				headerAge:                "5",
+			},
+			ttl: 50,
+		},
+		{
+			name: "expires and date",
+			header: map[string]string{
+				headerDate:    formatTime(-10 * time.Second),
+				headerExpires: formatTime(50 * time.Second),
+			},
+			ttl: 50,
+		},
+		{
+			name: "expires without date",
+			header: map[string]string{
+				headerExpires: formatTime(30 * time.Second),
+			},
+			ttl: 30,
+		},
+		{
+			name: "max-age overrides expires",
+			header: map[string]string{
+				elton.HeaderCacheControl: "max-age=60",
+				headerExpires:            formatTime(30 * time.Second),
+			},
+			ttl: 60,
+		},
+		{
+			// RFC 9111 5.3，无效的Expires（如0）表示已过期
+			name: "invalid expires",
+			header: map[string]string{
+				headerExpires: "0",
+			},
+		},
+		{
+			name: "expired",
+			header: map[string]string{
+				headerExpires: formatTime(-30 * time.Second),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert := assert.New(t)
+			h := make(http.Header)
+			for key, value := range tt.header {
+				h.Set(key, value)
+			}
+			f := GetFreshness(h, now)
+			assert.Equal(tt.ttl, f.TTL)
+			assert.Equal(tt.mustRevalidate, f.MustRevalidate)
+			assert.Equal(tt.ignoreFields, f.IgnoreFields)
+			assert.Equal(-1, f.StaleWhileRevalidate)
+			assert.Equal(-1, f.StaleIfError)
+		})
+	}
+
+	t.Run("stale directives", func(t *testing.T) {
+		assert := assert.New(t)
+		h := make(http.Header)
+		h.Add(elton.HeaderCacheControl, "max-age=60")
+		h.Add(elton.HeaderCacheControl, "stale-while-revalidate=10, stale-if-error=600")
+		f := GetFreshness(h, now)
+		assert.Equal(60, f.TTL)
+		assert.Equal(10, f.StaleWhileRevalidate)
+		assert.Equal(600, f.StaleIfError)
+	})
+}
@@ -16,7 +16,9 @@ package cache
 
 import (
 	"crypto/sha256"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/vicanso/pike/config"
@@ -47,14 +49,274 @@ func TestDispatcher(t *testing.T) {
 			Size:       10,
 			Zone:       1024,
 			HitForPass: 10,
+			StatusTTL: []string{
+				"404:30s",
+				"502:5s",
+			},
 		},
 	}
 	dispatchers := NewDispatchers(cachesConfig)
 	disp := dispatchers.Get(name)
 	assert.NotNil(disp)
+	assert.Equal(map[int]int{
+		404: 30,
+		502: 5,
+	}, disp.StatusTTL)
 
 	key := []byte("abcd")
 	c1 := disp.GetHTTPCache(key)
 	c2 := disp.GetHTTPCache(key)
 	assert.Equal(c1, c2)
 }
+
+func TestDispatcherStats(t *testing.T) {
+	assert := assert.New(t)
+	name := "test"
+	cachesConfig := config.Caches{
+		&config.Cache{
+			Name:       name,
+			Size:       2,
+			Zone:       1024,
+			HitForPass: 10,
+			MaxMemory:  1,
+		},
+	}
+	dispatchers := NewDispatchers(cachesConfig)
+	disp := dispatchers.Get(name)
+	c := disp.GetHTTPCache([]byte("abcd"))
+	c.Cachable(10, &HTTPData{
+		RawBody: []byte("abcd"),
+	})
+
+	stats := dispatchers.Stats()[name]
+	assert.Equal(1, stats.Entries)
+	assert.Equal(4, stats.Bytes)
+	assert.Equal(1024*1024, stats.MaxBytes)
+	assert.Equal(0, stats.Waiters)
+	assert.Nil(stats.Waiting)
+
+	// 等待获取数据的请求数
+	c = disp.GetHTTPCache([]byte("efgh"))
+	c.Get()
+	go c.Get()
+	for c.Waiters() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	stats = disp.Stats()
+	assert.Equal(1, stats.Waiters)
+	assert.Equal(map[string]int{"efgh": 1}, stats.Waiting)
+	c.HitForPass(10)
+}
+
+func TestDispatcherPurge(t *testing.T) {
+	assert := assert.New(t)
+	disp := NewDispatcher(nil)
+	keys := []string{
+		"GET aslant.site /users/v1/me",
+		"GET aslant.site /users/v1/me?type=vip",
+		"GET aslant.site /books/v1",
+	}
+	for _, key := range keys {
+		disp.GetHTTPCache([]byte(key))
+	}
+	assert.Equal(1, disp.Purge(keys[0]))
+	assert.Equal(0, disp.Purge(keys[0]))
+	assert.Equal(2, disp.Stats().Entries)
+
+	assert.Equal(1, disp.PurgeBy(func(key string) bool {
+		return strings.Contains(key, "/users/")
+	}))
+	assert.Equal(1, disp.Stats().Entries)
+}
+
+func TestDispatcherBan(t *testing.T) {
+	assert := assert.New(t)
+	disp := NewDispatcher(nil)
+	keys := []string{
+		"GET aslant.site /users/v1/me",
+		"GET tiny.aslant.site /users/v1/me",
+		"GET aslant.site /books/v1",
+	}
+	for _, key := range keys {
+		disp.GetHTTPCache([]byte(key)).Cachable(60, &HTTPData{
+			RawBody: []byte("abcd"),
+		})
+	}
+	createdNano := disp.GetHTTPCache([]byte(keys[0])).getCreatedNano()
+	assert.NotNil(disp.Ban("aslant.site", "("))
+	assert.Nil(disp.Ban("aslant.site", "^/users/"))
+
+	assert.True(disp.isBanned(keys[0], createdNano))
+	assert.False(disp.isBanned(keys[1], createdNano))
+	assert.False(disp.isBanned(keys[2], createdNano))
+	assert.False(disp.isBanned(keys[0], time.Now().UnixNano()))
+
+	// ban之后（同一秒内）创建的缓存不受影响
+	hc := disp.GetHTTPCache([]byte(keys[0]))
+	assert.NotEqual(StatusCacheable, hc.GetStatus())
+	hc.Cachable(60, &HTTPData{
+		RawBody: []byte("abcd"),
+	})
+	assert.True(hc == disp.GetHTTPCache([]byte(keys[0])))
+	assert.Equal(StatusCacheable, hc.GetStatus())
+
+	// 清除过期缓存时，ban匹配的缓存也清除
+	assert.Nil(disp.Ban("", "^/books/"))
+	assert.Equal(1, disp.RemoveExpired())
+	assert.Empty(disp.bans)
+	assert.Equal(2, disp.Stats().Entries)
+}
+
+func TestDispatcherJanitorBan(t *testing.T) {
+	assert := assert.New(t)
+	disp := NewDispatcher(&config.Cache{
+		JanitorInterval: 10 * time.Millisecond,
+	})
+	defer disp.Close()
+	for _, key := range []string{"GET aslant.site /users/v1/me", "GET aslant.site /books/v1"} {
+		disp.GetHTTPCache([]byte(key)).Cachable(60, &HTTPData{
+			RawBody: []byte("abcd"),
+		})
+	}
+	assert.Nil(disp.Ban("aslant.site", "^/users/"))
+	time.Sleep(50 * time.Millisecond)
+	// janitor清除ban匹配的缓存
+	disp.banMu.RLock()
+	assert.Empty(disp.bans)
+	disp.banMu.RUnlock()
+	assert.Equal(1, disp.Stats().Entries)
+}
+
+func TestDispatcherInspect(t *testing.T) {
+	assert := assert.New(t)
+	disp := NewDispatcher(nil)
+	keys := []string{
+		"GET aslant.site /c",
+		"GET aslant.site /a",
+		"GET aslant.site /b",
+	}
+	for _, key := range keys {
+		disp.GetHTTPCache([]byte(key))
+	}
+	assert.Equal([]string{
+		"GET aslant.site /a",
+		"GET aslant.site /b",
+		"GET aslant.site /c",
+	}, disp.Keys("GET aslant.site"))
+	assert.Empty(disp.Keys("HEAD"))
+
+	infos, count := disp.List("", 1, 10)
+	assert.Equal(3, count)
+	assert.Equal(2, len(infos))
+	assert.Equal("GET aslant.site /b", infos[0].Key)
+	assert.Equal("unknown", infos[0].Status)
+
+	infos, count = disp.List("", 3, 10)
+	assert.Equal(3, count)
+	assert.Empty(infos)
+
+	assert.Nil(disp.Inspect("GET aslant.site /d", false))
+	assert.NotNil(disp.Inspect("GET aslant.site /a", false))
+}
+
+func TestDispatchersReload(t *testing.T) {
+	assert := assert.New(t)
+	var ds *Dispatchers
+	ds = ds.Reload(config.Caches{
+		&config.Cache{
+			Name: "a",
+			Size: 2,
+			Zone: 10,
+		},
+		&config.Cache{
+			Name: "b",
+			Size: 2,
+			Zone: 10,
+		},
+		&config.Cache{
+			Name: "c",
+		},
+	})
+	keys := []string{
+		"GET aslant.site /books/1",
+		"GET aslant.site /books/2",
+		"GET aslant.site /books/3",
+	}
+	for _, name := range []string{"a", "b"} {
+		d := ds.Get(name)
+		for _, key := range keys {
+			d.GetHTTPCache([]byte(key)).Cachable(60, &HTTPData{
+				RawBody: []byte("abcd"),
+			})
+		}
+		d.AddTags([]byte(keys[0]), "book")
+	}
+	a := ds.Get("a")
+	b := ds.Get("b")
+	hc := b.GetHTTPCache([]byte(keys[0]))
+
+	ds = ds.Reload(config.Caches{
+		&config.Cache{
+			Name:        "a",
+			Size:        2,
+			Zone:        10,
+			Description: "description",
+		},
+		&config.Cache{
+			Name:       "b",
+			Size:       5,
+			Zone:       10,
+			HitForPass: 10,
+		},
+	})
+	// 配置未变化则使用原有的dispatcher
+	assert.True(a == ds.Get("a"))
+	assert.Nil(ds.Get("c"))
+
+	// size变化则迁移缓存
+	nb := ds.Get("b")
+	assert.False(b == nb)
+	assert.Equal(10, nb.HitForPass)
+	assert.Equal(len(keys), nb.Stats().Entries)
+	assert.Equal(3*4, nb.Stats().Bytes)
+	assert.Equal(0, b.Stats().Entries)
+	assert.True(hc == nb.GetHTTPCache([]byte(keys[0])))
+	status, _ := hc.Get()
+	assert.Equal(StatusCacheable, status)
+	assert.Equal(uint64(len(keys)), nb.Counters().Store)
+	// 迁移后的缓存大小变化在新的lru中计算
+	hc.Cachable(60, &HTTPData{
+		RawBody: []byte("abcdefgh"),
+	})
+	assert.Equal(4*4, nb.Stats().Bytes)
+	assert.Equal(1, nb.PurgeByTag("book"))
+
+	// zone与size未变化，则共享原有的lru缓存
+	ds = ds.Reload(config.Caches{
+		&config.Cache{
+			Name:       "b",
+			Size:       5,
+			Zone:       10,
+			HitForPass: 20,
+		},
+	})
+	nnb := ds.Get("b")
+	assert.False(nb == nnb)
+	assert.Equal(20, nnb.HitForPass)
+	assert.Equal(len(keys)-1, nnb.Stats().Entries)
+
+	// 淘汰策略变化则迁移缓存
+	ds = ds.Reload(config.Caches{
+		&config.Cache{
+			Name:       "b",
+			Size:       5,
+			Zone:       10,
+			HitForPass: 20,
+			Eviction:   config.EvictionTinyLFU,
+		},
+	})
+	tb := ds.Get("b")
+	assert.IsType(&tinyLFUPolicy{}, tb.list[0].policy)
+	assert.Equal(len(keys)-1, tb.Stats().Entries)
+	assert.Equal(0, nnb.Stats().Entries)
+}
@@ -0,0 +1,110 @@
+// Copyright 2020 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// count-min sketch，以较少的内存估算key的访问频率，
+// 计数增加的次数达到样本数量时，所有计数减半，使得频率能反映最近的访问情况
+
+package cache
+
+const (
+	// 计数的行数
+	cmDepth = 4
+	// 计数的最大值
+	cmMaxCount = 15
+	// 样本数量为宽度的倍数
+	cmSampleFactor = 10
+	// 最小的宽度
+	cmMinWidth = 16
+)
+
+type cmSketch struct {
+	rows [cmDepth][]uint8
+	mask uint64
+	// 计数增加的次数
+	additions int
+	// 样本数量，计数增加的次数达到时计数减半
+	sampleSize int
+}
+
+// newCMSketch new a count-min sketch, the width is the power of two
+// which is not less than the capacity
+func newCMSketch(capacity int) *cmSketch {
+	width := cmMinWidth
+	for width < capacity {
+		width <<= 1
+	}
+	s := &cmSketch{
+		mask:       uint64(width - 1),
+		sampleSize: cmSampleFactor * width,
+	}
+	for i := range s.rows {
+		s.rows[i] = make([]uint8, width)
+	}
+	return s
+}
+
+// index get the index of row, it uses double hashing
+func (s *cmSketch) index(hash uint64, row int) uint64 {
+	h1 := hash
+	h2 := (hash >> 32) | (hash << 32)
+	return (h1 + uint64(row)*h2) & s.mask
+}
+
+// Increment increment the count of hash
+func (s *cmSketch) Increment(hash uint64) {
+	for i := range s.rows {
+		index := s.index(hash, i)
+		if s.rows[i][index] < cmMaxCount {
+			s.rows[i][index]++
+		}
+	}
+	s.additions++
+	if s.additions >= s.sampleSize {
+		s.reset()
+	}
+}
+
+// Estimate get the estimated count of hash
+func (s *cmSketch) Estimate(hash uint64) int {
+	count := uint8(cmMaxCount)
+	for i := range s.rows {
+		v := s.rows[i][s.index(hash, i)]
+		if v < count {
+			count = v
+		}
+	}
+	return int(count)
+}
+
+// clear reset all counts to zero
+func (s *cmSketch) clear() {
+	for i := range s.rows {
+		row := s.rows[i]
+		for j := range row {
+			row[j] = 0
+		}
+	}
+	s.additions = 0
+}
+
+// reset halve all counts
+func (s *cmSketch) reset() {
+	for i := range s.rows {
+		row := s.rows[i]
+		for j := range row {
+			row[j] >>= 1
+		}
+	}
+	s.additions /= 2
+}
@@ -0,0 +1,59 @@
+// Copyright 2020 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCMSketch(t *testing.T) {
+	assert := assert.New(t)
+	s := newCMSketch(10)
+	assert.Equal(uint64(cmMinWidth-1), s.mask)
+	assert.Equal(cmMinWidth*cmSampleFactor, s.sampleSize)
+
+	s = newCMSketch(1000)
+	assert.Equal(uint64(1023), s.mask)
+
+	hot := MemHashString("hot")
+	cold := MemHashString("cold")
+	for i := 0; i < 5; i++ {
+		s.Increment(hot)
+	}
+	s.Increment(cold)
+	assert.Equal(5, s.Estimate(hot))
+	assert.True(s.Estimate(cold) >= 1)
+	assert.Equal(0, s.Estimate(MemHashString("none")))
+
+	// 计数不超过最大值
+	for i := 0; i < 20; i++ {
+		s.Increment(hot)
+	}
+	assert.Equal(cmMaxCount, s.Estimate(hot))
+
+	// 达到样本数量时计数减半
+	additions := s.additions
+	for i := additions; i < s.sampleSize; i++ {
+		s.Increment(cold)
+	}
+	assert.Equal(s.sampleSize/2, s.additions)
+	assert.True(s.Estimate(hot) <= cmMaxCount/2+1)
+
+	s.clear()
+	assert.Equal(0, s.additions)
+	assert.Equal(0, s.Estimate(hot))
+}
@@ -0,0 +1,165 @@
+// Copyright 2020 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// 缓存的统计计数，如各状态的查询次数、缓存保存次数、淘汰次数等，
+// 计数均为原子操作，nil的Counters忽略所有计数
+
+package cache
+
+import (
+	"sync/atomic"
+)
+
+type (
+	// Counters the atomic counters of dispatcher
+	Counters struct {
+		fetching    uint64
+		hit         uint64
+		stale       uint64
+		hitForPass  uint64
+		pass        uint64
+		store       uint64
+		eviction    uint64
+		expiration  uint64
+		waiter      uint64
+		waitTimeout uint64
+		rejection   uint64
+	}
+	// CountersStats the stats of counters
+	CountersStats struct {
+		// 各状态的查询次数
+		Fetching   uint64 `json:"fetching"`
+		Hit        uint64 `json:"hit"`
+		Stale      uint64 `json:"stale"`
+		HitForPass uint64 `json:"hitForPass"`
+		Pass       uint64 `json:"pass"`
+		// 缓存保存的次数
+		Store uint64 `json:"store"`
+		// lru淘汰的缓存数量
+		Eviction uint64 `json:"eviction"`
+		// 过期清除的缓存数量
+		Expiration uint64 `json:"expiration"`
+		// 等待获取数据的请求数量（及等待超时的数量）
+		Waiter      uint64 `json:"waiter"`
+		WaitTimeout uint64 `json:"waitTimeout"`
+		// 未达到准入条件而不缓存的请求数量
+		Rejection uint64 `json:"rejection"`
+		// 命中率（hit与stale占所有查询的比例）
+		HitRatio float64 `json:"hitRatio"`
+	}
+)
+
+// addLookup add the count of lookup by status
+func (c *Counters) addLookup(status int) {
+	if c == nil {
+		return
+	}
+	switch status {
+	case StatusFetching:
+		atomic.AddUint64(&c.fetching, 1)
+	case StatusCacheable:
+		atomic.AddUint64(&c.hit, 1)
+	case StatusStale:
+		atomic.AddUint64(&c.stale, 1)
+	case StatusHitForPass:
+		atomic.AddUint64(&c.hitForPass, 1)
+	case StatusPassed:
+		atomic.AddUint64(&c.pass, 1)
+	}
+}
+
+func (c *Counters) addStore() {
+	if c == nil {
+		return
+	}
+	atomic.AddUint64(&c.store, 1)
+}
+
+func (c *Counters) addEviction() {
+	if c == nil {
+		return
+	}
+	atomic.AddUint64(&c.eviction, 1)
+}
+
+func (c *Counters) addExpiration(count int) {
+	if c == nil || count <= 0 {
+		return
+	}
+	atomic.AddUint64(&c.expiration, uint64(count))
+}
+
+func (c *Counters) addWaiter() {
+	if c == nil {
+		return
+	}
+	atomic.AddUint64(&c.waiter, 1)
+}
+
+func (c *Counters) addWaitTimeout() {
+	if c == nil {
+		return
+	}
+	atomic.AddUint64(&c.waitTimeout, 1)
+}
+
+func (c *Counters) addRejection() {
+	if c == nil {
+		return
+	}
+	atomic.AddUint64(&c.rejection, 1)
+}
+
+// Stats get the stats of counters
+func (c *Counters) Stats() *CountersStats {
+	if c == nil {
+		return &CountersStats{}
+	}
+	stats := &CountersStats{
+		Fetching:    atomic.LoadUint64(&c.fetching),
+		Hit:         atomic.LoadUint64(&c.hit),
+		Stale:       atomic.LoadUint64(&c.stale),
+		HitForPass:  atomic.LoadUint64(&c.hitForPass),
+		Pass:        atomic.LoadUint64(&c.pass),
+		Store:       atomic.LoadUint64(&c.store),
+		Eviction:    atomic.LoadUint64(&c.eviction),
+		Expiration:  atomic.LoadUint64(&c.expiration),
+		Waiter:      atomic.LoadUint64(&c.waiter),
+		WaitTimeout: atomic.LoadUint64(&c.waitTimeout),
+		Rejection:   atomic.LoadUint64(&c.rejection),
+	}
+	lookups := stats.Fetching + stats.Hit + stats.Stale + stats.HitForPass + stats.Pass
+	if lookups != 0 {
+		stats.HitRatio = float64(stats.Hit+stats.Stale) / float64(lookups)
+	}
+	return stats
+}
+
+// Fields get the fields of stats, it's used for writing to influxdb
+func (stats *CountersStats) Fields() map[string]interface{} {
+	return map[string]interface{}{
+		"fetching":    int64(stats.Fetching),
+		"hit":         int64(stats.Hit),
+		"stale":       int64(stats.Stale),
+		"hitForPass":  int64(stats.HitForPass),
+		"pass":        int64(stats.Pass),
+		"store":       int64(stats.Store),
+		"eviction":    int64(stats.Eviction),
+		"expiration":  int64(stats.Expiration),
+		"waiter":      int64(stats.Waiter),
+		"waitTimeout": int64(stats.WaitTimeout),
+		"rejection":   int64(stats.Rejection),
+		"hitRatio":    stats.HitRatio,
+	}
+}
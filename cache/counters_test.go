@@ -0,0 +1,91 @@
+// Copyright 2020 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vicanso/pike/config"
+)
+
+func TestCounters(t *testing.T) {
+	t.Run("nil counters", func(t *testing.T) {
+		assert := assert.New(t)
+		var c *Counters
+		c.addLookup(StatusFetching)
+		c.addStore()
+		c.addEviction()
+		c.addExpiration(1)
+		c.addWaiter()
+		c.addWaitTimeout()
+		assert.Equal(&CountersStats{}, c.Stats())
+	})
+
+	t.Run("dispatcher", func(t *testing.T) {
+		assert := assert.New(t)
+		d := NewDispatcher(&config.Cache{
+			Size: 1,
+			Zone: 2,
+		})
+		key := []byte("GET aslant.site /")
+		hc := d.GetHTTPCache(key)
+		status, _ := hc.Get()
+		assert.Equal(StatusFetching, status)
+
+		// 等待fetching的请求
+		wg := sync.WaitGroup{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			status, _ := d.GetHTTPCache(key).Get()
+			assert.Equal(StatusCacheable, status)
+		}()
+		for hc.Waiters() == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		hc.Cachable(60, &HTTPData{
+			RawBody: []byte("abcd"),
+		})
+		wg.Wait()
+
+		status, _ = d.GetHTTPCache(key).Get()
+		assert.Equal(StatusCacheable, status)
+
+		hitForPassKey := []byte("GET aslant.site /users/me")
+		d.GetHTTPCache(hitForPassKey).Get()
+		d.GetHTTPCache(hitForPassKey).HitForPass(-1)
+		d.AddPass()
+
+		// 超出lru数量淘汰最旧的缓存
+		d.GetHTTPCache([]byte("GET aslant.site /books"))
+		// 过期的缓存被清除
+		assert.Equal(1, d.RemoveExpired())
+
+		stats := d.Counters()
+		assert.Equal(uint64(2), stats.Fetching)
+		assert.Equal(uint64(2), stats.Hit)
+		assert.Equal(uint64(1), stats.Pass)
+		assert.Equal(uint64(1), stats.Store)
+		assert.Equal(uint64(1), stats.Waiter)
+		assert.Equal(uint64(1), stats.Eviction)
+		assert.Equal(uint64(1), stats.Expiration)
+		assert.Equal(0.4, stats.HitRatio)
+		assert.Equal(stats, d.Stats().Counters)
+		assert.Equal(int64(2), stats.Fields()["hit"])
+	})
+}
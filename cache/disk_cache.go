@@ -0,0 +1,515 @@
+// Copyright 2020 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// 二级磁盘缓存，保存从内存缓存中淘汰的数据，
+// 命中时重新加载至内存缓存中
+
+package cache
+
+import (
+	"bytes"
+	"container/list"
+	"encoding/gob"
+	"strings"
+	"sync"
+	"time"
+
+	badger "github.com/dgraph-io/badger"
+	"github.com/vicanso/pike/log"
+	"github.com/vicanso/pike/util"
+	"go.uber.org/zap"
+)
+
+const (
+	// 等待写入磁盘的缓存队列长度
+	diskQueueSize = 1024
+	// 缓存标签的key前缀，标签与缓存数据分开保存，启动时无需读取数据
+	diskTagsPrefix = "\x00tags\x00"
+)
+
+type (
+	// DiskCache disk cache backed by badger
+	DiskCache struct {
+		mu sync.Mutex
+		db *badger.DB
+		// MaxBytes is the maximum byte size of disk cache, zero means no limit
+		MaxBytes int
+		// TTL is the maximum ttl(seconds) of disk cache, zero means no limit
+		TTL int
+
+		// 按写入先后顺序保存的key，超出限制时删除最早写入的
+		ll    *list.List
+		items map[string]*list.Element
+		bytes int
+
+		queue  chan *diskCacheOp
+		done   chan struct{}
+		closed bool
+	}
+	diskCacheEntry struct {
+		key       string
+		size      int
+		expiredAt int
+		tags      []string
+		// 等待写入的操作，写入完成后为nil
+		op *diskCacheOp
+	}
+	// diskCacheOp the operation of disk cache, delete the key if item is nil
+	diskCacheOp struct {
+		key       string
+		item      *cacheItem
+		expiredAt int
+	}
+)
+
+// NewDiskCache new a disk cache
+func NewDiskCache(path string, maxBytes, ttl int) (dc *DiskCache, err error) {
+	options := badger.DefaultOptions(path)
+	options = options.WithLogger(log.BadgerLogger())
+	db, err := badger.Open(options)
+	if err != nil {
+		return
+	}
+	dc = &DiskCache{
+		db:       db,
+		MaxBytes: maxBytes,
+		TTL:      ttl,
+		ll:       list.New(),
+		items:    make(map[string]*list.Element),
+		queue:    make(chan *diskCacheOp, diskQueueSize),
+		done:     make(chan struct{}),
+	}
+	err = dc.loadIndex()
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	go dc.run()
+	return
+}
+
+// loadIndex load the index of saved caches, only the tags are read
+// (the keys of tags are sorted before the keys of caches)
+func (dc *DiskCache) loadIndex() error {
+	return dc.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		tagsOfKeys := make(map[string][]string)
+		for it.Rewind(); it.Valid(); it.Next() {
+			item := it.Item()
+			key := string(item.KeyCopy(nil))
+			if strings.HasPrefix(key, diskTagsPrefix) {
+				err := item.Value(func(buf []byte) error {
+					tagsOfKeys[key[len(diskTagsPrefix):]] = decodeDiskTags(buf)
+					return nil
+				})
+				if err != nil {
+					return err
+				}
+				continue
+			}
+			tags, ok := tagsOfKeys[key]
+			// 旧版本的标签保存在数据中，需要读取数据获取
+			if !ok {
+				err := item.Value(func(buf []byte) error {
+					ci := &cacheItem{}
+					err := gob.NewDecoder(bytes.NewReader(buf)).Decode(ci)
+					if err != nil {
+						return err
+					}
+					tags = ci.Tags
+					return nil
+				})
+				if err != nil {
+					return err
+				}
+			}
+			dc.add(key, int(item.EstimatedSize()), int(item.ExpiresAt()), tags)
+		}
+		return nil
+	})
+}
+
+// getDiskTagsKey get the key of tags which are saved separately
+func getDiskTagsKey(key string) []byte {
+	return []byte(diskTagsPrefix + key)
+}
+
+// encodeDiskTags encode the tags, they are joined by newline
+func encodeDiskTags(tags []string) []byte {
+	return []byte(strings.Join(tags, "\n"))
+}
+
+// decodeDiskTags decode the tags
+func decodeDiskTags(buf []byte) []string {
+	if len(buf) == 0 {
+		return nil
+	}
+	return strings.Split(string(buf), "\n")
+}
+
+// deleteDiskCache delete the cache data and its tags
+func deleteDiskCache(txn *badger.Txn, key string) error {
+	err := txn.Delete([]byte(key))
+	if err != nil {
+		return err
+	}
+	return txn.Delete(getDiskTagsKey(key))
+}
+
+// add add the key to index(the lock should be held)
+func (dc *DiskCache) add(key string, size, expiredAt int, tags []string) *diskCacheEntry {
+	dc.remove(key)
+	entry := &diskCacheEntry{
+		key:       key,
+		size:      size,
+		expiredAt: expiredAt,
+		tags:      tags,
+	}
+	dc.items[key] = dc.ll.PushBack(entry)
+	dc.bytes += size
+	return entry
+}
+
+// isPending check the operation is the pending write of key(the lock should be held),
+// it isn't pending if the key is removed or demoted again
+func (dc *DiskCache) isPending(op *diskCacheOp) bool {
+	ele, ok := dc.items[op.key]
+	return ok && ele.Value.(*diskCacheEntry).op == op
+}
+
+// remove remove the key from index(the lock should be held)
+func (dc *DiskCache) remove(key string) bool {
+	ele, ok := dc.items[key]
+	if !ok {
+		return false
+	}
+	dc.ll.Remove(ele)
+	delete(dc.items, key)
+	dc.bytes -= ele.Value.(*diskCacheEntry).size
+	return true
+}
+
+// run write or delete the disk cache one by one
+func (dc *DiskCache) run() {
+	defer close(dc.done)
+	for op := range dc.queue {
+		var err error
+		if op.item == nil {
+			err = dc.db.Update(func(txn *badger.Txn) error {
+				return deleteDiskCache(txn, op.key)
+			})
+		} else {
+			err = dc.set(op)
+		}
+		if err != nil {
+			log.Default().Error("update disk cache fail",
+				zap.String("key", op.key),
+				zap.Error(err),
+			)
+		}
+	}
+}
+
+// getExpiredAt get the expired time of cache item in disk(the lock should be held)
+func (dc *DiskCache) getExpiredAt(item *cacheItem, now int) int {
+	expiredAt := item.ExpiredAt + item.StaleWhileRevalidate
+	if item.StaleIfError > item.StaleWhileRevalidate {
+		expiredAt = item.ExpiredAt + item.StaleIfError
+	}
+	if dc.TTL != 0 && expiredAt > now+dc.TTL {
+		expiredAt = now + dc.TTL
+	}
+	return expiredAt
+}
+
+// set save the cache item of pending operation to badger,
+// and delete the oldest items if the byte size is over the limit.
+// The operation is dropped if the key has been removed(or demoted again) after queued.
+func (dc *DiskCache) set(op *diskCacheOp) (err error) {
+	key := op.key
+	dc.mu.Lock()
+	pending := dc.isPending(op)
+	expired := op.expiredAt <= int(time.Now().Unix())
+	if pending && expired {
+		dc.remove(key)
+	}
+	dc.mu.Unlock()
+	if !pending || expired {
+		return
+	}
+	buf := new(bytes.Buffer)
+	err = gob.NewEncoder(buf).Encode(op.item)
+	if err != nil {
+		dc.mu.Lock()
+		if dc.isPending(op) {
+			dc.remove(key)
+		}
+		dc.mu.Unlock()
+		return
+	}
+	ttl := time.Duration(op.expiredAt-int(time.Now().Unix())) * time.Second
+	entry := badger.NewEntry([]byte(key), buf.Bytes()).WithTTL(ttl)
+	tagsEntry := badger.NewEntry(getDiskTagsKey(key), encodeDiskTags(op.item.Tags)).WithTTL(ttl)
+	err = dc.db.Update(func(txn *badger.Txn) error {
+		err := txn.SetEntry(entry)
+		if err != nil {
+			return err
+		}
+		return txn.SetEntry(tagsEntry)
+	})
+
+	dc.mu.Lock()
+	// 写入过程中已被删除的，删除操作在队列中，由其删除磁盘数据
+	if !dc.isPending(op) {
+		dc.mu.Unlock()
+		return
+	}
+	if err != nil {
+		dc.remove(key)
+		dc.mu.Unlock()
+		return
+	}
+	current := dc.items[key].Value.(*diskCacheEntry)
+	current.op = nil
+	size := len(key) + buf.Len()
+	dc.bytes += size - current.size
+	current.size = size
+	removedKeys := make([]string, 0)
+	for dc.MaxBytes != 0 && dc.bytes > dc.MaxBytes && dc.ll.Len() != 0 {
+		oldest := dc.ll.Front().Value.(*diskCacheEntry)
+		dc.remove(oldest.key)
+		removedKeys = append(removedKeys, oldest.key)
+	}
+	dc.mu.Unlock()
+
+	if len(removedKeys) == 0 {
+		return
+	}
+	return dc.db.Update(func(txn *badger.Txn) error {
+		for _, k := range removedKeys {
+			err := deleteDiskCache(txn, k)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// push push the operation to queue, it will be dropped if the queue is full
+func (dc *DiskCache) push(op *diskCacheOp) bool {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	if dc.closed {
+		return false
+	}
+	select {
+	case dc.queue <- op:
+		return true
+	default:
+		return false
+	}
+}
+
+// Demote save the cacheable http cache to disk(async).
+// The key is indexed when it is queued, so it can be got or removed before written.
+func (dc *DiskCache) Demote(key string, hc *HTTPCache) bool {
+	item := hc.toCacheItem()
+	if item == nil {
+		return false
+	}
+	now := int(time.Now().Unix())
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	expiredAt := dc.getExpiredAt(item, now)
+	if expiredAt <= now {
+		return false
+	}
+	op := &diskCacheOp{
+		key:       key,
+		item:      item,
+		expiredAt: expiredAt,
+	}
+	// 仅有写入者在持有锁时添加，因此队列未满时可直接添加
+	if dc.closed || len(dc.queue) == cap(dc.queue) {
+		return false
+	}
+	// 写入前使用数据大小作为估算
+	dc.add(key, len(key)+item.Data.Size(), expiredAt, item.Tags).op = op
+	dc.queue <- op
+	return true
+}
+
+// Promote load the http cache from disk, and remove it from disk
+func (dc *DiskCache) Promote(key string, hc *HTTPCache) bool {
+	item, err := dc.get(key)
+	if err != nil {
+		log.Default().Error("get disk cache fail",
+			zap.String("key", key),
+			zap.Error(err),
+		)
+	}
+	if item == nil {
+		return false
+	}
+	hc.restore(item)
+	// 已加载至内存，从磁盘中删除
+	dc.push(&diskCacheOp{
+		key: key,
+	})
+	return true
+}
+
+// get get the cache item from badger
+func (dc *DiskCache) get(key string) (item *cacheItem, err error) {
+	dc.mu.Lock()
+	ele, ok := dc.items[key]
+	// 已关闭或不在索引中，则无需读取
+	if dc.closed || !ok {
+		dc.mu.Unlock()
+		return
+	}
+	entry := ele.Value.(*diskCacheEntry)
+	expired := entry.expiredAt <= int(time.Now().Unix())
+	dc.remove(key)
+	dc.mu.Unlock()
+	if expired {
+		return
+	}
+	// 未写入磁盘的直接使用队列中的数据（已从索引中删除，不会再写入）
+	if entry.op != nil {
+		return entry.op.item, nil
+	}
+
+	var buf []byte
+	err = dc.db.View(func(txn *badger.Txn) error {
+		v, err := txn.Get([]byte(key))
+		if err != nil {
+			return err
+		}
+		buf, err = v.ValueCopy(nil)
+		return err
+	})
+	if err == badger.ErrKeyNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return
+	}
+	item = &cacheItem{}
+	err = gob.NewDecoder(bytes.NewReader(buf)).Decode(item)
+	if err != nil {
+		return nil, err
+	}
+	return
+}
+
+// Remove remove the disk cache of key
+func (dc *DiskCache) Remove(key string) bool {
+	dc.mu.Lock()
+	removed := dc.remove(key)
+	dc.mu.Unlock()
+	if removed {
+		dc.push(&diskCacheOp{
+			key: key,
+		})
+	}
+	return removed
+}
+
+// RemoveBy remove the disk caches which match the function
+func (dc *DiskCache) RemoveBy(match func(key string) bool) (keys []string) {
+	return dc.removeBy(func(entry *diskCacheEntry) bool {
+		return match(entry.key)
+	})
+}
+
+// RemoveByTag remove the disk caches which have the tag
+func (dc *DiskCache) RemoveByTag(tag string) (keys []string) {
+	return dc.removeBy(func(entry *diskCacheEntry) bool {
+		return util.ContainesString(entry.tags, tag)
+	})
+}
+
+func (dc *DiskCache) removeBy(match func(entry *diskCacheEntry) bool) (keys []string) {
+	dc.mu.Lock()
+	for key, ele := range dc.items {
+		if match(ele.Value.(*diskCacheEntry)) {
+			dc.remove(key)
+			keys = append(keys, key)
+		}
+	}
+	dc.mu.Unlock()
+	for _, key := range keys {
+		dc.push(&diskCacheOp{
+			key: key,
+		})
+	}
+	return
+}
+
+// Has check the key is in the disk cache
+func (dc *DiskCache) Has(key string) bool {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	_, ok := dc.items[key]
+	return ok
+}
+
+// Len returns the number of items in the disk cache.
+func (dc *DiskCache) Len() int {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	return dc.ll.Len()
+}
+
+// Bytes returns the byte size of items in the disk cache.
+func (dc *DiskCache) Bytes() int {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	return dc.bytes
+}
+
+// setLimits set the max bytes and ttl of disk cache, the oldest items
+// are removed when the next item is saved if the byte size is over the limit
+func (dc *DiskCache) setLimits(maxBytes, ttl int) {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	dc.MaxBytes = maxBytes
+	dc.TTL = ttl
+}
+
+// getMaxBytes get the max bytes of disk cache
+func (dc *DiskCache) getMaxBytes() int {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	return dc.MaxBytes
+}
+
+// Close close the disk cache, the pending operations will be done before closing
+func (dc *DiskCache) Close() error {
+	dc.mu.Lock()
+	if dc.closed {
+		dc.mu.Unlock()
+		return nil
+	}
+	dc.closed = true
+	close(dc.queue)
+	dc.mu.Unlock()
+	<-dc.done
+	return dc.db.Close()
+}
@@ -0,0 +1,398 @@
+// Copyright 2020 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"bytes"
+	"container/list"
+	"encoding/gob"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	badger "github.com/dgraph-io/badger"
+	"github.com/stretchr/testify/assert"
+	"github.com/vicanso/pike/config"
+)
+
+// isDiskCacheWritten check all entries of disk cache have been written
+func isDiskCacheWritten(dc *DiskCache, count int) bool {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	if dc.ll.Len() != count || len(dc.queue) != 0 {
+		return false
+	}
+	for ele := dc.ll.Front(); ele != nil; ele = ele.Next() {
+		// 已从队列取出但仍在写入中
+		if ele.Value.(*diskCacheEntry).op != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// waitForDiskCache wait for the disk cache queue is empty and all entries are written
+func waitForDiskCache(dc *DiskCache, count int) {
+	for i := 0; i < 100; i++ {
+		if isDiskCacheWritten(dc, count) {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func newTestDiskCache(t *testing.T, maxBytes, ttl int) (*DiskCache, func()) {
+	dir, err := ioutil.TempDir("", "pike-disk-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dc, err := NewDiskCache(dir, maxBytes, ttl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dc, func() {
+		_ = dc.Close()
+		_ = os.RemoveAll(dir)
+	}
+}
+
+// newPausedDiskCache new a disk cache which shares the db, the operations
+// are queued until the returned function is called
+func newPausedDiskCache(dc *DiskCache) (*DiskCache, func()) {
+	paused := &DiskCache{
+		db:    dc.db,
+		ll:    list.New(),
+		items: make(map[string]*list.Element),
+		queue: make(chan *diskCacheOp, diskQueueSize),
+		done:  make(chan struct{}),
+	}
+	return paused, func() {
+		go paused.run()
+		close(paused.queue)
+		<-paused.done
+	}
+}
+
+// existsInDB check the key is saved in badger
+func existsInDB(dc *DiskCache, key string) bool {
+	err := dc.db.View(func(txn *badger.Txn) error {
+		_, err := txn.Get([]byte(key))
+		return err
+	})
+	return err == nil
+}
+
+func TestDiskCache(t *testing.T) {
+	t.Run("demote and promote", func(t *testing.T) {
+		assert := assert.New(t)
+		dc, done := newTestDiskCache(t, 0, 0)
+		defer done()
+
+		key := "abcd"
+		hc := NewHTTPCache()
+		// 非可缓存状态不保存
+		assert.False(dc.Demote(key, hc))
+
+		data := &HTTPData{
+			StatusCode: 200,
+			RawBody:    []byte("abcd"),
+			GzipBody:   []byte("gzip"),
+		}
+		hc.Cachable(10, data)
+		assert.True(dc.Demote(key, hc))
+		waitForDiskCache(dc, 1)
+		assert.Equal(1, dc.Len())
+		assert.NotEqual(0, dc.Bytes())
+		assert.True(dc.Has(key))
+
+		nhc := NewHTTPCache()
+		assert.True(dc.Promote(key, nhc))
+		status, nData := nhc.Get()
+		assert.Equal(StatusCacheable, status)
+		assert.Equal(data, nData)
+		assert.Equal(hc.expiredAt, nhc.expiredAt)
+		assert.Equal(data.Size(), nhc.Size())
+
+		// 加载后从磁盘中删除
+		assert.Equal(0, dc.Len())
+		assert.False(dc.Has(key))
+		assert.False(dc.Promote(key, NewHTTPCache()))
+	})
+
+	t.Run("max bytes", func(t *testing.T) {
+		assert := assert.New(t)
+		dc, done := newTestDiskCache(t, 0, 0)
+		defer done()
+
+		for index, key := range []string{"a", "b", "c"} {
+			hc := NewHTTPCache()
+			hc.Cachable(10, &HTTPData{
+				RawBody: make([]byte, 100),
+			})
+			dc.Demote(key, hc)
+			// 第三个写入后最早的被删除
+			count := index + 1
+			if count > 2 {
+				count = 2
+			}
+			waitForDiskCache(dc, count)
+			// 根据实际写入的大小设置仅可保存两个缓存
+			if index == 0 {
+				dc.mu.Lock()
+				dc.MaxBytes = 2 * dc.bytes
+				dc.mu.Unlock()
+			}
+		}
+		assert.Equal(2, dc.Len())
+		// 最早写入的被删除
+		assert.False(dc.Promote("a", NewHTTPCache()))
+		assert.True(dc.Promote("c", NewHTTPCache()))
+	})
+
+	t.Run("ttl", func(t *testing.T) {
+		assert := assert.New(t)
+		dc, done := newTestDiskCache(t, 0, 1)
+		defer done()
+
+		hc := NewHTTPCache()
+		hc.Cachable(10, &HTTPData{
+			RawBody: []byte("abcd"),
+		})
+		dc.Demote("a", hc)
+		waitForDiskCache(dc, 1)
+		assert.Equal(1, dc.Len())
+		time.Sleep(1100 * time.Millisecond)
+		assert.False(dc.Promote("a", NewHTTPCache()))
+	})
+
+	t.Run("remove", func(t *testing.T) {
+		assert := assert.New(t)
+		dc, done := newTestDiskCache(t, 0, 0)
+		defer done()
+
+		hc := NewHTTPCache()
+		hc.Cachable(10, &HTTPData{
+			RawBody: []byte("abcd"),
+		})
+		dc.Demote("a", hc)
+		waitForDiskCache(dc, 1)
+		assert.True(dc.Remove("a"))
+		assert.False(dc.Remove("a"))
+		assert.Equal(0, dc.Len())
+	})
+
+	t.Run("remove or promote before written", func(t *testing.T) {
+		assert := assert.New(t)
+		dc, done := newTestDiskCache(t, 0, 0)
+		defer done()
+		paused, resume := newPausedDiskCache(dc)
+
+		for _, key := range []string{"a", "b", "c", "d"} {
+			hc := NewHTTPCache()
+			hc.Cachable(10, &HTTPData{
+				RawBody: []byte("abcd"),
+			})
+			hc.addTags([]string{"tag:" + key})
+			assert.True(paused.Demote(key, hc))
+		}
+		// 写入前已添加至索引
+		assert.Equal(4, paused.Len())
+		assert.True(paused.Has("a"))
+		assert.True(paused.Remove("a"))
+		assert.Equal([]string{"b"}, paused.RemoveByTag("tag:b"))
+		nhc := NewHTTPCache()
+		assert.True(paused.Promote("c", nhc))
+		_, data := nhc.Get()
+		assert.Equal([]byte("abcd"), data.RawBody)
+		resume()
+
+		// 已删除或已加载的不再写入
+		for _, key := range []string{"a", "b", "c"} {
+			assert.False(existsInDB(dc, key), key)
+		}
+		assert.True(existsInDB(dc, "d"))
+		assert.Equal(1, paused.Len())
+		assert.Nil(paused.items["d"].Value.(*diskCacheEntry).op)
+	})
+
+	t.Run("remove by tag", func(t *testing.T) {
+		assert := assert.New(t)
+		dc, done := newTestDiskCache(t, 0, 0)
+		defer done()
+
+		for _, key := range []string{"a", "b"} {
+			hc := NewHTTPCache()
+			hc.Cachable(10, &HTTPData{
+				RawBody: []byte("abcd"),
+			})
+			hc.addTags([]string{"tag:" + key, "tags"})
+			dc.Demote(key, hc)
+		}
+		waitForDiskCache(dc, 2)
+		assert.Equal([]string{"a"}, dc.RemoveByTag("tag:a"))
+		assert.Equal(1, dc.Len())
+
+		// 加载时恢复标签
+		hc := NewHTTPCache()
+		assert.True(dc.Promote("b", hc))
+		assert.Equal([]string{"tag:b", "tags"}, hc.Tags())
+	})
+
+	t.Run("load index", func(t *testing.T) {
+		assert := assert.New(t)
+		dc, done := newTestDiskCache(t, 0, 0)
+		defer done()
+
+		hc := NewHTTPCache()
+		hc.Cachable(10, &HTTPData{
+			RawBody: []byte("abcd"),
+		})
+		hc.addTags([]string{"tag:a", "tags"})
+		dc.Demote("a", hc)
+		waitForDiskCache(dc, 1)
+		buf := new(bytes.Buffer)
+		assert.Nil(gob.NewEncoder(buf).Encode(&cacheItem{
+			ExpiredAt: int(time.Now().Unix()) + 10,
+			Tags:      []string{"tag:b"},
+			Data: &HTTPData{
+				RawBody: []byte("abcd"),
+			},
+		}))
+		assert.Nil(dc.db.Update(func(txn *badger.Txn) error {
+			// 标签单独保存，数据无需解码
+			err := txn.Set([]byte("a"), []byte("invalid"))
+			if err != nil {
+				return err
+			}
+			// 旧版本无单独保存的标签
+			return txn.Set([]byte("b"), buf.Bytes())
+		}))
+
+		loaded, resume := newPausedDiskCache(dc)
+		defer resume()
+		assert.Nil(loaded.loadIndex())
+		assert.Equal(2, loaded.Len())
+		assert.Equal([]string{"a"}, loaded.RemoveByTag("tag:a"))
+		assert.Equal([]string{"b"}, loaded.RemoveByTag("tag:b"))
+	})
+}
+
+func TestDispatcherDiskCache(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "pike-disk-cache")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	name := "test"
+	dispatchers := NewDispatchers(config.Caches{
+		&config.Cache{
+			Name:       name,
+			Size:       1,
+			Zone:       1,
+			HitForPass: 10,
+			DiskPath:   dir,
+			DiskSize:   1,
+		},
+	})
+	defer dispatchers.Close()
+	disp := dispatchers.Get(name)
+	assert.NotNil(disp.disk)
+
+	data := &HTTPData{
+		RawBody: []byte("abcd"),
+	}
+	disp.GetHTTPCache([]byte("a")).Cachable(10, data)
+	// 缓存数量超出限制，a被淘汰至磁盘缓存
+	disp.GetHTTPCache([]byte("b"))
+	waitForDiskCache(disp.disk, 1)
+	stats := disp.Stats()
+	assert.Equal(1, stats.Entries)
+	assert.Equal(1, stats.DiskEntries)
+	assert.Equal(1024*1024, stats.DiskMaxBytes)
+
+	// 重新从磁盘缓存中加载
+	status, nData := disp.GetHTTPCache([]byte("a")).Get()
+	assert.Equal(StatusCacheable, status)
+	assert.Equal(data, nData)
+	assert.Equal(data.Size(), disp.Stats().Bytes)
+}
+
+func TestDispatcherDiskCacheReload(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "pike-disk-cache")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+	name := "disk"
+	cacheConfig := config.Cache{
+		Name:     name,
+		Size:     1,
+		Zone:     1,
+		DiskPath: dir,
+		DiskSize: 1,
+	}
+	c1 := cacheConfig
+	dispatchers := NewDispatchers(config.Caches{
+		&c1,
+	})
+	disk := dispatchers.Get(name).disk
+	assert.NotNil(disk)
+
+	// 磁盘缓存配置未变化，继续使用原有的磁盘缓存
+	c2 := cacheConfig
+	c2.Size = 2
+	dispatchers = dispatchers.Reload(config.Caches{
+		&c2,
+	})
+	assert.True(disk == dispatchers.Get(name).disk)
+
+	// 磁盘缓存路径未变化，仅更新其限制
+	c3 := c2
+	c3.DiskSize = 2
+	c3.DiskTTL = 60
+	dispatchers = dispatchers.Reload(config.Caches{
+		&c3,
+	})
+	disp := dispatchers.Get(name)
+	assert.True(disk == disp.disk)
+	assert.Equal(2*1024*1024, disp.Stats().DiskMaxBytes)
+	assert.Equal(60, disk.TTL)
+	assert.Empty(dispatchers.stale)
+
+	// 磁盘缓存路径变化，新的dispatchers生效后才关闭原有的磁盘缓存
+	newDir, err := ioutil.TempDir("", "pike-disk-cache")
+	assert.Nil(err)
+	defer os.RemoveAll(newDir)
+	c4 := c3
+	c4.DiskPath = newDir
+	dispatchers = dispatchers.Reload(config.Caches{
+		&c4,
+	})
+	disp = dispatchers.Get(name)
+	assert.NotNil(disp.disk)
+	assert.False(disk == disp.disk)
+	assert.False(disk.closed)
+	dispatchers.CloseStale()
+	assert.True(disk.closed)
+	assert.Empty(dispatchers.stale)
+
+	// 删除的dispatcher在新的dispatchers生效后才关闭
+	disk = disp.disk
+	dispatchers = dispatchers.Reload(config.Caches{})
+	assert.Nil(dispatchers.Get(name))
+	assert.False(disk.closed)
+	dispatchers.CloseStale()
+	assert.True(disk.closed)
+}
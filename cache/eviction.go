@@ -0,0 +1,141 @@
+// Copyright 2020 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// 缓存的淘汰策略，缓存超出数量或内存限制时由淘汰策略选择需要淘汰的缓存：
+// lru淘汰最久未使用的缓存；
+// tinylfu（W-TinyLFU）根据访问频率判断新缓存能否替换已有缓存，避免一次性的大量访问（如爬虫）淘汰热点缓存；
+// arc根据访问情况自适应调整最近访问与频繁访问的缓存比例
+
+package cache
+
+import (
+	"container/list"
+
+	"github.com/vicanso/pike/config"
+)
+
+type (
+	// EvictionPolicy the eviction policy of http cache, it records the
+	// access of keys and selects the key to evict. It is not safe for concurrent access.
+	EvictionPolicy interface {
+		// Add records the key which is added
+		Add(key string)
+		// Access records the access of the key
+		Access(key string)
+		// Remove removes the key which is deleted(not evicted)
+		Remove(key string)
+		// Evict selects the key to evict and removes it
+		Evict() (key string, ok bool)
+		// Keys returns the keys from the coldest to the hottest
+		Keys() []string
+		// Len returns the count of keys
+		Len() int
+		// Clear removes all keys
+		Clear()
+	}
+	// policyItem the key of eviction policy and the segment it belongs to
+	policyItem struct {
+		key     string
+		segment int
+	}
+	// lruPolicy evict the least recently used key
+	lruPolicy struct {
+		ll    *list.List
+		items map[string]*list.Element
+	}
+)
+
+// NewEvictionPolicy new an eviction policy(lru, tinylfu or arc), the capacity
+// is the max entries of http cache, lru is used if the name is unknown
+func NewEvictionPolicy(name string, capacity int) EvictionPolicy {
+	if capacity <= 0 {
+		capacity = defaultZoneSize
+	}
+	switch name {
+	case config.EvictionTinyLFU:
+		return newTinyLFUPolicy(capacity)
+	case config.EvictionARC:
+		return newARCPolicy(capacity)
+	default:
+		return newLRUPolicy()
+	}
+}
+
+// appendKeys append the keys of list from back to front
+func appendKeys(keys []string, ll *list.List) []string {
+	for e := ll.Back(); e != nil; e = e.Prev() {
+		keys = append(keys, e.Value.(*policyItem).key)
+	}
+	return keys
+}
+
+func newLRUPolicy() *lruPolicy {
+	return &lruPolicy{
+		ll:    list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+// Add records the key which is added
+func (p *lruPolicy) Add(key string) {
+	if ele, ok := p.items[key]; ok {
+		p.ll.MoveToFront(ele)
+		return
+	}
+	p.items[key] = p.ll.PushFront(&policyItem{
+		key: key,
+	})
+}
+
+// Access records the access of the key
+func (p *lruPolicy) Access(key string) {
+	if ele, ok := p.items[key]; ok {
+		p.ll.MoveToFront(ele)
+	}
+}
+
+// Remove removes the key
+func (p *lruPolicy) Remove(key string) {
+	if ele, ok := p.items[key]; ok {
+		p.ll.Remove(ele)
+		delete(p.items, key)
+	}
+}
+
+// Evict evicts the least recently used key
+func (p *lruPolicy) Evict() (key string, ok bool) {
+	ele := p.ll.Back()
+	if ele == nil {
+		return
+	}
+	key = ele.Value.(*policyItem).key
+	p.Remove(key)
+	return key, true
+}
+
+// Keys returns the keys from the least recently used
+func (p *lruPolicy) Keys() []string {
+	return appendKeys(make([]string, 0, p.ll.Len()), p.ll)
+}
+
+// Len returns the count of keys
+func (p *lruPolicy) Len() int {
+	return p.ll.Len()
+}
+
+// Clear removes all keys
+func (p *lruPolicy) Clear() {
+	p.ll.Init()
+	p.items = make(map[string]*list.Element)
+}
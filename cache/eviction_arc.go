@@ -0,0 +1,176 @@
+// Copyright 2020 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// ARC（Adaptive Replacement Cache）淘汰策略，t1保存仅访问一次的缓存，t2保存多次访问的缓存，
+// b1与b2分别记录从t1与t2中淘汰的key（不保存数据），
+// 再次添加的key如果在b1中则增加t1的目标容量，在b2中则减少t1的目标容量
+
+package cache
+
+import (
+	"container/list"
+)
+
+const (
+	arcT1 = iota
+	arcT2
+	arcB1
+	arcB2
+)
+
+type arcPolicy struct {
+	capacity int
+	// t1的目标容量
+	p     int
+	lists [4]*list.List
+	items map[string]*list.Element
+}
+
+func newARCPolicy(capacity int) *arcPolicy {
+	p := &arcPolicy{
+		capacity: capacity,
+		items:    make(map[string]*list.Element),
+	}
+	for i := range p.lists {
+		p.lists[i] = list.New()
+	}
+	return p
+}
+
+// move move the element to the front of list
+func (p *arcPolicy) move(ele *list.Element, segment int) {
+	item := ele.Value.(*policyItem)
+	p.lists[item.segment].Remove(ele)
+	item.segment = segment
+	p.items[item.key] = p.lists[segment].PushFront(item)
+}
+
+// remove remove the element from list
+func (p *arcPolicy) remove(ele *list.Element) {
+	item := ele.Value.(*policyItem)
+	p.lists[item.segment].Remove(ele)
+	delete(p.items, item.key)
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// trim remove the oldest keys of b1 and b2, t1 + b1 should not be greater than
+// the capacity and the total count should not be greater than twice the capacity
+func (p *arcPolicy) trim() {
+	t1, t2, b1, b2 := p.lists[arcT1], p.lists[arcT2], p.lists[arcB1], p.lists[arcB2]
+	for b1.Len() != 0 && t1.Len()+b1.Len() > p.capacity {
+		p.remove(b1.Back())
+	}
+	for b2.Len() != 0 && t1.Len()+t2.Len()+b1.Len()+b2.Len() > 2*p.capacity {
+		p.remove(b2.Back())
+	}
+}
+
+// Add adds the key to t1, or t2 if it is in b1 or b2(and adjust the target size of t1)
+func (p *arcPolicy) Add(key string) {
+	ele, ok := p.items[key]
+	if !ok {
+		p.items[key] = p.lists[arcT1].PushFront(&policyItem{
+			key:     key,
+			segment: arcT1,
+		})
+		p.trim()
+		return
+	}
+	b1, b2 := p.lists[arcB1], p.lists[arcB2]
+	switch ele.Value.(*policyItem).segment {
+	case arcB1:
+		p.p = minInt(p.capacity, p.p+maxInt(b2.Len()/b1.Len(), 1))
+		p.move(ele, arcT2)
+	case arcB2:
+		p.p = maxInt(0, p.p-maxInt(b1.Len()/b2.Len(), 1))
+		p.move(ele, arcT2)
+	default:
+		p.Access(key)
+	}
+	p.trim()
+}
+
+// Access moves the key to the front of t2
+func (p *arcPolicy) Access(key string) {
+	ele, ok := p.items[key]
+	if !ok {
+		return
+	}
+	switch ele.Value.(*policyItem).segment {
+	case arcT1, arcT2:
+		p.move(ele, arcT2)
+	}
+}
+
+// Remove removes the key(include b1 and b2)
+func (p *arcPolicy) Remove(key string) {
+	if ele, ok := p.items[key]; ok {
+		p.remove(ele)
+	}
+}
+
+// Evict evicts the oldest key of t1 if its size is greater than the target size,
+// otherwise evicts the oldest key of t2, the evicted key is moved to b1 or b2
+func (p *arcPolicy) Evict() (key string, ok bool) {
+	t1, t2 := p.lists[arcT1], p.lists[arcT2]
+	var ele *list.Element
+	segment := arcB2
+	if t1.Len() != 0 && (t1.Len() > p.p || t2.Len() == 0) {
+		ele = t1.Back()
+		segment = arcB1
+	} else {
+		ele = t2.Back()
+	}
+	if ele == nil {
+		return
+	}
+	key = ele.Value.(*policyItem).key
+	p.move(ele, segment)
+	p.trim()
+	return key, true
+}
+
+// Keys returns the keys of t1 and t2
+func (p *arcPolicy) Keys() []string {
+	keys := make([]string, 0, p.Len())
+	keys = appendKeys(keys, p.lists[arcT1])
+	return appendKeys(keys, p.lists[arcT2])
+}
+
+// Len returns the count of keys in t1 and t2
+func (p *arcPolicy) Len() int {
+	return p.lists[arcT1].Len() + p.lists[arcT2].Len()
+}
+
+// Clear removes all keys
+func (p *arcPolicy) Clear() {
+	for _, l := range p.lists {
+		l.Init()
+	}
+	p.items = make(map[string]*list.Element)
+	p.p = 0
+}
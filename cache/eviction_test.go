@@ -0,0 +1,306 @@
+// Copyright 2020 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"bufio"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vicanso/pike/config"
+)
+
+var evictionPolicies = []string{
+	config.EvictionLRU,
+	config.EvictionTinyLFU,
+	config.EvictionARC,
+}
+
+// newZipfTrace new the trace of zipf distribution, the hot keys are accessed frequently
+func newZipfTrace(seed int64, count, keys int) []string {
+	r := rand.New(rand.NewSource(seed))
+	zipf := rand.NewZipf(r, 1.1, 1, uint64(keys-1))
+	trace := make([]string, count)
+	for i := range trace {
+		trace[i] = "GET aslant.site /books/" + strconv.FormatUint(zipf.Uint64(), 10)
+	}
+	return trace
+}
+
+// newScanTrace new the trace of zipf distribution with scans,
+// the scan accesses the keys which are only accessed once(such as crawler)
+func newScanTrace(seed int64, count, keys, scanEvery, scanSize int) []string {
+	trace := make([]string, 0, count+count/scanEvery*scanSize)
+	scanned := 0
+	for i, key := range newZipfTrace(seed, count, keys) {
+		trace = append(trace, key)
+		if i%scanEvery != scanEvery-1 {
+			continue
+		}
+		for j := 0; j < scanSize; j++ {
+			trace = append(trace, "GET aslant.site /scan/"+strconv.Itoa(scanned))
+			scanned++
+		}
+	}
+	return trace
+}
+
+// loadTrace load the recorded trace(one key per line) of file
+func loadTrace(file string) ([]string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	trace := make([]string, 0)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key := strings.TrimSpace(scanner.Text())
+		if key != "" {
+			trace = append(trace, key)
+		}
+	}
+	return trace, scanner.Err()
+}
+
+// getHitRatio get the hit ratio of the eviction policy for the trace
+func getHitRatio(eviction string, capacity int, trace []string) float64 {
+	c := NewHTTPCacheLRUWithPolicy(capacity, NewEvictionPolicy(eviction, capacity))
+	hits := 0
+	for _, key := range trace {
+		if _, ok := c.Get(key); ok {
+			hits++
+			continue
+		}
+		c.Add(key, NewHTTPCache())
+	}
+	return float64(hits) / float64(len(trace))
+}
+
+func TestNewEvictionPolicy(t *testing.T) {
+	assert := assert.New(t)
+	assert.IsType(&lruPolicy{}, NewEvictionPolicy("", 10))
+	assert.IsType(&lruPolicy{}, NewEvictionPolicy(config.EvictionLRU, 10))
+	assert.IsType(&tinyLFUPolicy{}, NewEvictionPolicy(config.EvictionTinyLFU, 10))
+	assert.IsType(&arcPolicy{}, NewEvictionPolicy(config.EvictionARC, 0))
+}
+
+func TestEvictionPolicy(t *testing.T) {
+	for _, eviction := range evictionPolicies {
+		t.Run(eviction, func(t *testing.T) {
+			assert := assert.New(t)
+			p := NewEvictionPolicy(eviction, 100)
+			_, ok := p.Evict()
+			assert.False(ok)
+
+			p.Add("a")
+			p.Add("b")
+			p.Add("c")
+			p.Access("a")
+			// 重复添加不影响数量
+			p.Add("a")
+			assert.Equal(3, p.Len())
+			assert.Equal(3, len(p.Keys()))
+			assert.Equal("a", p.Keys()[2])
+
+			p.Remove("c")
+			p.Remove("d")
+			assert.Equal(2, p.Len())
+			assert.NotContains(p.Keys(), "c")
+
+			key, ok := p.Evict()
+			assert.True(ok)
+			assert.Equal("b", key)
+			assert.Equal([]string{"a"}, p.Keys())
+
+			p.Clear()
+			assert.Equal(0, p.Len())
+			assert.Empty(p.Keys())
+		})
+	}
+}
+
+func TestTinyLFUPolicy(t *testing.T) {
+	assert := assert.New(t)
+	p := newTinyLFUPolicy(100)
+	assert.Equal(1, p.windowSize)
+	assert.Equal(79, p.protectedSize)
+
+	p.Add("a")
+	p.Add("b")
+	// window已满，a移至probation
+	assert.Equal(1, p.segments[tinyLFUWindow].Len())
+	assert.Equal(1, p.segments[tinyLFUProbation].Len())
+	// probation中的缓存再次访问移至protected
+	p.Access("a")
+	assert.Equal(1, p.segments[tinyLFUProtected].Len())
+
+	for i := 0; i < 5; i++ {
+		p.Access("b")
+	}
+	p.Add("c")
+	// window中的c访问频率低于probation中的b，因此淘汰c
+	key, ok := p.Evict()
+	assert.True(ok)
+	assert.Equal("c", key)
+
+	p.Add("d")
+	for i := 0; i < 10; i++ {
+		p.Access("d")
+	}
+	// window中的d访问频率高于probation中的b，因此淘汰b，d移至probation
+	key, ok = p.Evict()
+	assert.True(ok)
+	assert.Equal("b", key)
+	assert.Equal(tinyLFUProbation, p.items["d"].Value.(*policyItem).segment)
+}
+
+func TestARCPolicy(t *testing.T) {
+	assert := assert.New(t)
+	p := newARCPolicy(2)
+	p.Add("a")
+	p.Add("b")
+	p.Access("a")
+	assert.Equal(1, p.lists[arcT1].Len())
+	assert.Equal(1, p.lists[arcT2].Len())
+
+	// t1超出目标容量，淘汰t1中的b并记录至b1
+	key, ok := p.Evict()
+	assert.True(ok)
+	assert.Equal("b", key)
+	assert.Equal(1, p.lists[arcB1].Len())
+	assert.Equal(1, p.Len())
+
+	// b1中的key再次添加，增加t1的目标容量并保存至t2
+	p.Add("b")
+	assert.Equal(1, p.p)
+	assert.Equal(2, p.lists[arcT2].Len())
+	assert.Equal(0, p.lists[arcB1].Len())
+
+	key, ok = p.Evict()
+	assert.True(ok)
+	assert.Equal("a", key)
+	assert.Equal(1, p.lists[arcB2].Len())
+	p.Add("a")
+	assert.Equal(0, p.p)
+
+	// ghost的数量不超过容量的两倍
+	for i := 0; i < 10; i++ {
+		p.Add(strconv.Itoa(i))
+		p.Evict()
+	}
+	assert.True(len(p.items) <= 4)
+	assert.True(p.lists[arcT1].Len()+p.lists[arcB1].Len() <= 2)
+}
+
+func TestEvictionPolicyHitRatio(t *testing.T) {
+	assert := assert.New(t)
+	trace := newScanTrace(1, 50000, 5000, 5000, 2000)
+	lru := getHitRatio(config.EvictionLRU, 500, trace)
+	tinyLFU := getHitRatio(config.EvictionTinyLFU, 500, trace)
+	arc := getHitRatio(config.EvictionARC, 500, trace)
+	// 有大量一次性访问时，tinylfu与arc的命中率高于lru
+	assert.True(tinyLFU > lru)
+	assert.True(arc > lru)
+}
+
+func TestHTTPCacheLRUWithPolicy(t *testing.T) {
+	for _, eviction := range evictionPolicies {
+		t.Run(eviction, func(t *testing.T) {
+			assert := assert.New(t)
+			lru := NewHTTPCacheLRUWithPolicy(2, NewEvictionPolicy(eviction, 2))
+			evicted := make([]string, 0)
+			lru.OnEvicted = func(key string, _ *HTTPCache) {
+				evicted = append(evicted, key)
+			}
+			lru.FindOrCreate("a")
+			lru.FindOrCreate("b")
+			lru.FindOrCreate("c")
+			assert.Equal(2, lru.Len())
+			assert.Equal(1, len(evicted))
+			// 新添加的缓存不会被淘汰
+			_, ok := lru.Peek("c")
+			assert.True(ok)
+			assert.Equal(lru.Len(), len(lru.entries()))
+			assert.Equal(2, len(lru.removeAll()))
+			assert.Equal(0, lru.Len())
+		})
+	}
+}
+
+// BenchmarkEvictionPolicyHitRatio compare the hit ratios of eviction policies,
+// the trace file(one key per line) can be set by PIKE_CACHE_TRACE, such as:
+// PIKE_CACHE_TRACE=/tmp/trace.txt go test -run=none -bench=HitRatio ./cache/
+func BenchmarkEvictionPolicyHitRatio(b *testing.B) {
+	capacity := 1000
+	traces := []struct {
+		name  string
+		trace []string
+	}{
+		{
+			name:  "zipf",
+			trace: newZipfTrace(1, 100000, 10000),
+		},
+		{
+			name:  "scan",
+			trace: newScanTrace(1, 100000, 10000, 10000, 5000),
+		},
+	}
+	if file := os.Getenv("PIKE_CACHE_TRACE"); file != "" {
+		trace, err := loadTrace(file)
+		if err != nil {
+			b.Fatal(err)
+		}
+		traces = append(traces, struct {
+			name  string
+			trace []string
+		}{
+			name:  "recorded",
+			trace: trace,
+		})
+	}
+	for _, tt := range traces {
+		for _, eviction := range evictionPolicies {
+			b.Run(tt.name+"/"+eviction, func(b *testing.B) {
+				ratio := 0.0
+				for i := 0; i < b.N; i++ {
+					ratio = getHitRatio(eviction, capacity, tt.trace)
+				}
+				b.ReportMetric(ratio*100, "hit%")
+			})
+		}
+	}
+}
+
+func BenchmarkEvictionPolicy(b *testing.B) {
+	trace := newZipfTrace(1, 100000, 10000)
+	for _, eviction := range evictionPolicies {
+		b.Run(eviction, func(b *testing.B) {
+			c := NewHTTPCacheLRUWithPolicy(1000, NewEvictionPolicy(eviction, 1000))
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				key := trace[i%len(trace)]
+				if _, ok := c.Get(key); !ok {
+					c.Add(key, NewHTTPCache())
+				}
+			}
+		})
+	}
+}
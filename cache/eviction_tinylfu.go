@@ -0,0 +1,179 @@
+// Copyright 2020 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// W-TinyLFU淘汰策略，新的缓存先保存在window（lru，容量的1%）中，
+// 从window中淘汰的缓存与main中最旧的缓存比较访问频率（count-min sketch），频率较低的被淘汰。
+// main使用分段lru（probation与protected），probation中的缓存再次访问时移至protected
+
+package cache
+
+import (
+	"container/list"
+)
+
+const (
+	tinyLFUWindow = iota
+	tinyLFUProbation
+	tinyLFUProtected
+)
+
+const (
+	// window占容量的百分比
+	tinyLFUWindowPercent = 1
+	// protected占main的百分比
+	tinyLFUProtectedPercent = 80
+)
+
+type tinyLFUPolicy struct {
+	sketch *cmSketch
+	// window与protected的容量
+	windowSize    int
+	protectedSize int
+	segments      [3]*list.List
+	items         map[string]*list.Element
+}
+
+func newTinyLFUPolicy(capacity int) *tinyLFUPolicy {
+	windowSize := capacity * tinyLFUWindowPercent / 100
+	if windowSize < 1 {
+		windowSize = 1
+	}
+	p := &tinyLFUPolicy{
+		sketch:        newCMSketch(capacity),
+		windowSize:    windowSize,
+		protectedSize: (capacity - windowSize) * tinyLFUProtectedPercent / 100,
+		items:         make(map[string]*list.Element),
+	}
+	for i := range p.segments {
+		p.segments[i] = list.New()
+	}
+	return p
+}
+
+// frequency get the estimated access frequency of key
+func (p *tinyLFUPolicy) frequency(key string) int {
+	return p.sketch.Estimate(MemHashString(key))
+}
+
+// move move the element to the front of segment
+func (p *tinyLFUPolicy) move(ele *list.Element, segment int) {
+	item := ele.Value.(*policyItem)
+	p.segments[item.segment].Remove(ele)
+	item.segment = segment
+	p.items[item.key] = p.segments[segment].PushFront(item)
+}
+
+// Add adds the key to window, the oldest key of window
+// is moved to probation if the window is full
+func (p *tinyLFUPolicy) Add(key string) {
+	if _, ok := p.items[key]; ok {
+		p.Access(key)
+		return
+	}
+	p.sketch.Increment(MemHashString(key))
+	window := p.segments[tinyLFUWindow]
+	p.items[key] = window.PushFront(&policyItem{
+		key:     key,
+		segment: tinyLFUWindow,
+	})
+	for window.Len() > p.windowSize {
+		p.move(window.Back(), tinyLFUProbation)
+	}
+}
+
+// Access records the access of the key, the key of probation is moved to protected
+func (p *tinyLFUPolicy) Access(key string) {
+	p.sketch.Increment(MemHashString(key))
+	ele, ok := p.items[key]
+	if !ok {
+		return
+	}
+	switch ele.Value.(*policyItem).segment {
+	case tinyLFUProbation:
+		p.move(ele, tinyLFUProtected)
+		// protected超出容量时，最旧的移至probation
+		protected := p.segments[tinyLFUProtected]
+		for protected.Len() > p.protectedSize && protected.Len() != 0 {
+			p.move(protected.Back(), tinyLFUProbation)
+		}
+	default:
+		p.segments[ele.Value.(*policyItem).segment].MoveToFront(ele)
+	}
+}
+
+// Remove removes the key
+func (p *tinyLFUPolicy) Remove(key string) {
+	ele, ok := p.items[key]
+	if !ok {
+		return
+	}
+	p.segments[ele.Value.(*policyItem).segment].Remove(ele)
+	delete(p.items, key)
+}
+
+// Evict compares the oldest key of window(candidate) with the oldest key of main(victim),
+// the key which has lower frequency is evicted, and the candidate is moved to probation if it wins
+func (p *tinyLFUPolicy) Evict() (key string, ok bool) {
+	window := p.segments[tinyLFUWindow]
+	var candidate *list.Element
+	// window未满时，仅淘汰main中的缓存
+	if window.Len() >= p.windowSize {
+		candidate = window.Back()
+	}
+	victim := p.segments[tinyLFUProbation].Back()
+	if victim == nil {
+		victim = p.segments[tinyLFUProtected].Back()
+	}
+	if victim == nil {
+		victim = window.Back()
+		candidate = nil
+	}
+	if victim == nil {
+		return
+	}
+	evicted := victim
+	if candidate != nil {
+		candidateKey := candidate.Value.(*policyItem).key
+		victimKey := victim.Value.(*policyItem).key
+		if p.frequency(candidateKey) > p.frequency(victimKey) {
+			p.move(candidate, tinyLFUProbation)
+		} else {
+			evicted = candidate
+		}
+	}
+	key = evicted.Value.(*policyItem).key
+	p.Remove(key)
+	return key, true
+}
+
+// Keys returns the keys of probation, window and protected
+func (p *tinyLFUPolicy) Keys() []string {
+	keys := make([]string, 0, len(p.items))
+	keys = appendKeys(keys, p.segments[tinyLFUProbation])
+	keys = appendKeys(keys, p.segments[tinyLFUWindow])
+	return appendKeys(keys, p.segments[tinyLFUProtected])
+}
+
+// Len returns the count of keys
+func (p *tinyLFUPolicy) Len() int {
+	return len(p.items)
+}
+
+// Clear removes all keys, the frequency of sketch is kept
+func (p *tinyLFUPolicy) Clear() {
+	for _, segment := range p.segments {
+		segment.Init()
+	}
+	p.items = make(map[string]*list.Element)
+}
@@ -0,0 +1,118 @@
+// Copyright 2020 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// 缓存过期时间的索引（最小堆），过期时间变化时添加新的记录，
+// 旧的记录在取出时判断与缓存当前的过期时间不一致则忽略
+
+package cache
+
+import (
+	"container/heap"
+	"time"
+)
+
+const (
+	// 每次持有锁时最多处理的过期记录数量，避免长时间持有锁
+	expiryBatchSize = 128
+	// DefaultJanitorInterval the default interval of removing expired caches
+	DefaultJanitorInterval = 10 * time.Second
+)
+
+type (
+	expiryItem struct {
+		key      string
+		deadline int
+	}
+	// expiryHeap min heap of expiry items, it implements heap.Interface
+	expiryHeap []*expiryItem
+)
+
+func (h expiryHeap) Len() int {
+	return len(h)
+}
+
+func (h expiryHeap) Less(i, j int) bool {
+	return h[i].deadline < h[j].deadline
+}
+
+func (h expiryHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+}
+
+func (h *expiryHeap) Push(x interface{}) {
+	*h = append(*h, x.(*expiryItem))
+}
+
+func (h *expiryHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return item
+}
+
+// track add the deadline of entry to the expiry index(the lock should be held),
+// it is ignored if the deadline isn't changed
+func (c *HTTPCacheLRU) track(kv *entry, deadline int) {
+	if deadline == 0 || deadline == kv.deadline {
+		return
+	}
+	kv.deadline = deadline
+	heap.Push(&c.expiry, &expiryItem{
+		key:      kv.key,
+		deadline: deadline,
+	})
+}
+
+// expire update the deadline of the http cache in the expiry index
+func (c *HTTPCacheLRU) expire(key string, value *HTTPCache, deadline int) {
+	c.Lock()
+	defer c.Unlock()
+	kv, hit := c.cache[key]
+	// 如果缓存已被删除或替换，则忽略
+	if !hit || kv.value != value {
+		return
+	}
+	c.track(kv, deadline)
+}
+
+// removeExpired remove at most limit expired items of the expiry index(the lock should be held),
+// more is true if there may be more expired items
+func (c *HTTPCacheLRU) removeExpired(now, limit int) (count int, more bool) {
+	for i := 0; i < limit; i++ {
+		if len(c.expiry) == 0 || c.expiry[0].deadline >= now {
+			return count, false
+		}
+		item := heap.Pop(&c.expiry).(*expiryItem)
+		kv, hit := c.cache[item.key]
+		// 缓存已删除或过期时间已变化
+		if !hit || kv.deadline != item.deadline {
+			continue
+		}
+		kv.deadline = 0
+		deadline, removable := kv.value.expiry(now)
+		if !removable {
+			// 正在获取数据的缓存，稍后再检查
+			if deadline < now {
+				deadline = now + 1
+			}
+			c.track(kv, deadline)
+			continue
+		}
+		c.Remove(item.key)
+		count++
+	}
+	return count, true
+}
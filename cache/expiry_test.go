@@ -0,0 +1,150 @@
+// Copyright 2020 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"container/heap"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vicanso/pike/config"
+)
+
+func TestExpiryHeap(t *testing.T) {
+	assert := assert.New(t)
+	h := make(expiryHeap, 0)
+	for _, deadline := range []int{3, 1, 2} {
+		heap.Push(&h, &expiryItem{
+			key:      strconv.Itoa(deadline),
+			deadline: deadline,
+		})
+	}
+	result := make([]int, 0)
+	for h.Len() != 0 {
+		result = append(result, heap.Pop(&h).(*expiryItem).deadline)
+	}
+	assert.Equal([]int{1, 2, 3}, result)
+}
+
+func TestHTTPCacheLRURemoveExpired(t *testing.T) {
+	data := &HTTPData{
+		RawBody: []byte("abcd"),
+	}
+
+	t.Run("remove expired", func(t *testing.T) {
+		assert := assert.New(t)
+		lru := NewHTTPCacheLRU(10)
+		lru.FindOrCreate("a").Cachable(-1, data)
+		lru.FindOrCreate("b").Cachable(60, data)
+		lru.FindOrCreate("c").HitForPass(-1)
+		// 过期后在stale时长内的不清除
+		c := lru.FindOrCreate("d")
+		c.SetStaleWhileRevalidate(60)
+		c.Cachable(-1, data)
+		// 未设置过期时间的不在索引中
+		lru.FindOrCreate("e")
+
+		assert.Equal(4, lru.expiry.Len())
+		assert.Equal(2, lru.RemoveExpired())
+		assert.Equal(3, lru.Len())
+		_, ok := lru.Peek("b")
+		assert.True(ok)
+		_, ok = lru.Peek("d")
+		assert.True(ok)
+		assert.Equal(2, lru.expiry.Len())
+	})
+
+	t.Run("deadline changed", func(t *testing.T) {
+		assert := assert.New(t)
+		lru := NewHTTPCacheLRU(10)
+		hc := lru.FindOrCreate("a")
+		hc.Cachable(-1, data)
+		hc.Cachable(60, data)
+		// 旧的记录被忽略
+		assert.Equal(2, lru.expiry.Len())
+		assert.Equal(0, lru.RemoveExpired())
+		assert.Equal(1, lru.Len())
+		assert.Equal(1, lru.expiry.Len())
+
+		// 已删除的缓存记录被忽略
+		lru.FindOrCreate("b").Cachable(-1, data)
+		lru.Lock()
+		lru.Remove("b")
+		lru.Unlock()
+		assert.Equal(0, lru.RemoveExpired())
+	})
+
+	t.Run("fetching", func(t *testing.T) {
+		assert := assert.New(t)
+		lru := NewHTTPCacheLRU(10)
+		hc := lru.FindOrCreate("a")
+		hc.Cachable(-1, data)
+		// 过期后重新获取数据中
+		status, _ := hc.Get()
+		assert.Equal(StatusFetching, status)
+		assert.Equal(0, lru.RemoveExpired())
+		assert.Equal(1, lru.Len())
+		// 稍后再检查
+		assert.Equal(int(time.Now().Unix())+1, lru.expiry[0].deadline)
+	})
+
+	t.Run("batch", func(t *testing.T) {
+		assert := assert.New(t)
+		count := 3 * expiryBatchSize
+		lru := NewHTTPCacheLRU(count)
+		for i := 0; i < count; i++ {
+			lru.FindOrCreate(strconv.Itoa(i)).Cachable(-1, data)
+		}
+		assert.Equal(count, lru.RemoveExpired())
+		assert.Equal(0, lru.Len())
+		assert.Equal(0, lru.expiry.Len())
+	})
+
+	t.Run("attach", func(t *testing.T) {
+		assert := assert.New(t)
+		hc := NewHTTPCache()
+		hc.Cachable(-1, data)
+		lru := NewHTTPCacheLRU(10)
+		assert.True(lru.attach("a", hc))
+		assert.Equal(1, lru.RemoveExpired())
+	})
+}
+
+func TestDispatcherJanitor(t *testing.T) {
+	assert := assert.New(t)
+	cacheConfig := &config.Cache{
+		JanitorInterval: 10 * time.Millisecond,
+	}
+	d := NewDispatcher(cacheConfig)
+	defer d.Close()
+	d.GetHTTPCache([]byte("GET aslant.site /books")).HitForPass(-1)
+	d.GetHTTPCache([]byte("GET aslant.site /users")).HitForPass(60)
+	for i := 0; i < 100 && d.Stats().Entries != 1; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(1, d.Stats().Entries)
+	assert.Equal(uint64(1), d.Counters().Expiration)
+
+	// 重新加载后由新的dispatcher清除
+	newConfig := *cacheConfig
+	newConfig.JanitorInterval = time.Minute
+	nd := d.reload(&newConfig)
+	defer nd.Close()
+	_, ok := <-d.janitorDone
+	assert.False(ok)
+	assert.Equal(time.Minute, nd.janitorInterval)
+}
@@ -19,7 +19,9 @@ package cache
 
 import (
 	"bytes"
+	"errors"
 	"net/http"
+	"net/textproto"
 	"strconv"
 	"strings"
 	"sync"
@@ -40,6 +42,8 @@ const (
 	StatusCacheable
 	// StatusPassed pass status
 	StatusPassed
+	// StatusStale stale status(expired but still can be used)
+	StatusStale
 )
 
 const (
@@ -47,9 +51,21 @@ const (
 	statusHitForPassDesc = "hitForPass"
 	statusCacheableDesc  = "cacheable"
 	statusPassedDesc     = "passed"
+	statusStaleDesc      = "stale"
 	statusUnknownDesc    = "unknown"
 )
 
+var (
+	// ErrWaitTimeout wait for the fetching result timeout
+	ErrWaitTimeout = errors.New("wait for fetching timeout")
+)
+
+const (
+	headerVary = "Vary"
+	// 每个缓存最多保存的variant数量，避免请求头变化过多导致缓存过大
+	maxVariants = 64
+)
+
 type (
 	// HTTPHeader http header
 	HTTPHeader [][]byte
@@ -72,6 +88,64 @@ type (
 		data      *HTTPData
 		createdAt int
 		expiredAt int
+		// 创建时间（纳秒），用于判断缓存是否在ban之前创建
+		createdNano int64
+		// 响应头中Vary的字段（已排除Accept-Encoding）
+		vary []string
+		// 根据vary字段对应的请求头值保存的缓存
+		variants map[string]*HTTPCache
+		// 是否为variant缓存
+		isVariant bool
+		// 过期后仍可使用的时长（此时会在后台刷新缓存）
+		staleWhileRevalidate int
+		// 是否正在刷新缓存
+		revalidating bool
+		// 过期后在获取数据出错时仍可使用的时长
+		staleIfError int
+		// 缓存数据占用的字节数（不包括variant），保存在arena时为其占用的字节数
+		size int
+		// 缓存数据占用字节数变化时的回调
+		onResize func(delta int)
+		// 缓存过期时间变化时的回调（参数为包括stale时长的过期时间）
+		onExpire func(deadline int)
+		// 缓存的标签（surrogate key），用于按标签清除缓存
+		tags []string
+		// dispatcher的统计计数
+		counters *Counters
+		// 缓存数据的page存储，为nil时数据保存在堆中（data）
+		arena *arena
+		// 缓存数据在page存储中的位置
+		ref arenaRef
+		// 是否已从缓存中删除，删除后的数据保存在堆中
+		released bool
+		// 从其它存储（如磁盘缓存）加载数据时不为nil，加载完成后关闭
+		loading chan struct{}
+	}
+	// HTTPCacheInfo the information of http cache
+	HTTPCacheInfo struct {
+		Key      string      `json:"key"`
+		Status   string      `json:"status"`
+		Age      int         `json:"age"`
+		TTL      int         `json:"ttl"`
+		Size     int         `json:"size"`
+		RawSize  int         `json:"rawSize"`
+		GzipSize int         `json:"gzipSize"`
+		BrSize   int         `json:"brSize"`
+		Vary     []string    `json:"vary,omitempty"`
+		Variants int         `json:"variants,omitempty"`
+		Tags     []string    `json:"tags,omitempty"`
+		Waiters  int         `json:"waiters,omitempty"`
+		Headers  []string    `json:"headers,omitempty"`
+		Header   http.Header `json:"header,omitempty"`
+	}
+	// cacheItem the cacheable data of http cache, it's used for saving to other storage
+	cacheItem struct {
+		CreatedAt            int
+		ExpiredAt            int
+		StaleWhileRevalidate int
+		StaleIfError         int
+		Tags                 []string
+		Data                 *HTTPData
 	}
 )
 
@@ -85,13 +159,105 @@ func StatusString(status int) string {
 		return statusCacheableDesc
 	case StatusPassed:
 		return statusPassedDesc
+	case StatusStale:
+		return statusStaleDesc
 	default:
 		return statusUnknownDesc
 	}
 }
 
-// SetResponse set response
+// Size get the byte size of http data, include headers and bodies
+func (httpData *HTTPData) Size() int {
+	if httpData == nil {
+		return 0
+	}
+	size := len(httpData.RawBody) + len(httpData.GzipBody) + len(httpData.BrBody)
+	for _, header := range httpData.Headers {
+		for _, item := range header {
+			size += len(item)
+		}
+	}
+	return size
+}
+
+// DelHeaders delete the headers of http data, the names should be canonical
+func (httpData *HTTPData) DelHeaders(names ...string) {
+	if len(names) == 0 {
+		return
+	}
+	headers := make(HTTPHeaders, 0, len(httpData.Headers))
+	for _, header := range httpData.Headers {
+		if !util.ContainesString(names, http.CanonicalHeaderKey(string(header[0]))) {
+			headers = append(headers, header)
+		}
+	}
+	httpData.Headers = headers
+}
+
+// Header get the http header of http data
+func (httpData *HTTPData) Header() http.Header {
+	header := make(http.Header)
+	for _, item := range httpData.Headers {
+		header.Add(string(item[0]), string(item[1]))
+	}
+	return header
+}
+
+// Refresh returns a new http data which headers are updated by the header of 304 response,
+// the bodies are shared with the original http data.
+func (httpData *HTTPData) Refresh(header http.Header) *HTTPData {
+	merged := httpData.Header()
+	for key, values := range header {
+		// 304响应无数据，因此忽略数据相关的响应头
+		if key == elton.HeaderContentEncoding || key == elton.HeaderContentLength {
+			continue
+		}
+		merged[key] = values
+	}
+	return &HTTPData{
+		Headers:    NewHTTPHeaders(merged),
+		StatusCode: httpData.StatusCode,
+		GzipBody:   httpData.GzipBody,
+		BrBody:     httpData.BrBody,
+		RawBody:    httpData.RawBody,
+	}
+}
+
+// getRawBody get the raw body of http data, decompress from gzip body if the raw body is empty.
+// It returns false if the raw body can't be got(only br body).
+func (httpData *HTTPData) getRawBody() ([]byte, bool) {
+	if len(httpData.RawBody) != 0 {
+		return httpData.RawBody, true
+	}
+	if len(httpData.GzipBody) != 0 {
+		rawBody, err := util.Gunzip(httpData.GzipBody)
+		if err != nil {
+			return nil, false
+		}
+		return rawBody, true
+	}
+	// 仅有br数据时无法获取原始数据
+	if len(httpData.BrBody) != 0 {
+		return nil, false
+	}
+	return nil, true
+}
+
+// setHeaders set the headers of http data to response
+func (httpData *HTTPData) setHeaders(c *elton.Context) {
+	for _, httpHeader := range httpData.Headers {
+		c.SetHeader(util.ByteSliceToString(httpHeader[0]), util.ByteSliceToString(httpHeader[1]))
+	}
+	if httpData.StatusCode == http.StatusOK {
+		c.SetHeader(headerAcceptRanges, "bytes")
+	}
+}
+
+// SetResponse set response, the partial content will be set if the request has Range header
 func (httpData *HTTPData) SetResponse(c *elton.Context) {
+	if httpData.setRangeResponse(c) {
+		return
+	}
 	c.StatusCode = httpData.StatusCode
 	acceptEncoding := c.GetRequestHeader(elton.HeaderAcceptEncoding)
 	var buf *bytes.Buffer
@@ -113,9 +279,7 @@ func (httpData *HTTPData) SetResponse(c *elton.Context) {
 		}
 		buf = bytes.NewBuffer(rawBody)
 	}
-	for _, httpHeader := range httpData.Headers {
-		c.SetHeader(util.ByteSliceToString(httpHeader[0]), util.ByteSliceToString(httpHeader[1]))
-	}
+	httpData.setHeaders(c)
 	c.SetHeader(elton.HeaderContentLength, strconv.Itoa(buf.Len()))
 	c.SetHeader(elton.HeaderContentEncoding, encoding)
 	c.BodyBuffer = buf
@@ -152,30 +316,137 @@ func NewHTTPHeaders(header http.Header, ignoreHeaders ...string) (headers HTTPHe
 	return
 }
 
+// ParseVary parse the vary header of response, the Accept-Encoding will be ignored
+// because the compression is handled by pike. If the vary is "*", it returns ["*"].
+func ParseVary(header http.Header) (vary []string) {
+	for _, value := range header[headerVary] {
+		for _, item := range strings.Split(value, ",") {
+			name := strings.TrimSpace(item)
+			if name == "" {
+				continue
+			}
+			if name == "*" {
+				return []string{name}
+			}
+			name = textproto.CanonicalMIMEHeaderKey(name)
+			if name == elton.HeaderAcceptEncoding {
+				continue
+			}
+			vary = append(vary, name)
+		}
+	}
+	return
+}
+
+// getVariantKey get the variant key of vary from request header
+func getVariantKey(vary []string, header http.Header) string {
+	var b strings.Builder
+	for _, name := range vary {
+		b.WriteString(strings.Join(header[name], ","))
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+func isSameVary(v1, v2 []string) bool {
+	if len(v1) != len(v2) {
+		return false
+	}
+	for index, item := range v1 {
+		if v2[index] != item {
+			return false
+		}
+	}
+	return true
+}
+
 // NewHTTPCache new a http cache
 func NewHTTPCache() *HTTPCache {
 	return &HTTPCache{}
 }
 
+func newVariantHTTPCache() *HTTPCache {
+	return &HTTPCache{
+		isVariant: true,
+	}
+}
+
 // Get get http cache
 func (hc *HTTPCache) Get() (status int, data *HTTPData) {
+	status, data, _ = hc.GetWithTimeout(0)
+	return
+}
+
+// GetWithTimeout get http cache, if the http cache is fetching, it will wait for
+// the result until timeout(zero means no timeout), and ErrWaitTimeout will be returned
+func (hc *HTTPCache) GetWithTimeout(timeout time.Duration) (status int, data *HTTPData, err error) {
 	status, done, data := hc.get()
-	if done != nil {
-		// TODO 后续再考虑是否需要添加timeout
+	if done == nil {
+		hc.counters.addLookup(status)
+		return
+	}
+	hc.counters.addWaiter()
+	if timeout <= 0 {
 		<-done
-		status = hc.status
-		data = hc.data
+	} else {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		select {
+		case <-done:
+		case <-timer.C:
+			hc.removeWaiter(done)
+			hc.counters.addWaitTimeout()
+			err = ErrWaitTimeout
+			return
+		}
 	}
+	hc.mu.Lock()
+	status = hc.status
+	data = hc.getData()
+	hc.mu.Unlock()
+	hc.counters.addLookup(status)
 	return
 }
 
+// removeWaiter remove the waiter from http cache
+func (hc *HTTPCache) removeWaiter(done chan struct{}) {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	for index, ch := range hc.chans {
+		if ch == done {
+			hc.chans = append(hc.chans[:index], hc.chans[index+1:]...)
+			return
+		}
+	}
+}
+
+// Waiters get the count of requests waiting for the fetching result, include its variants
+func (hc *HTTPCache) Waiters() int {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	count := len(hc.chans)
+	for _, variant := range hc.variants {
+		variant.mu.Lock()
+		count += len(variant.chans)
+		variant.mu.Unlock()
+	}
+	return count
+}
+
 // get get http cache
 func (hc *HTTPCache) get() (status int, done chan struct{}, data *HTTPData) {
 	hc.mu.Lock()
 	defer hc.mu.Unlock()
 	now := int(time.Now().Unix())
-	// 如果缓存已过期，设置为StatusUnknown
-	if hc.expiredAt != 0 && hc.expiredAt < now {
+	// 如果是fetching状态，则无需判断是否过期（过期缓存正在重新获取）
+	if hc.status != StatusFetching && hc.expiredAt != 0 && hc.expiredAt < now {
+		// 如果在stale-while-revalidate的时间内，则返回过期的数据
+		if hc.status == StatusCacheable && hc.expiredAt+hc.staleWhileRevalidate >= now {
+			status = StatusStale
+			data = hc.getData()
+			return
+		}
+		// 如果缓存已过期，设置为StatusUnknown
 		hc.status = StatusUnknown
 	}
 	// 如果是fetching，则相同的请求需要等待完成
@@ -195,34 +466,399 @@ func (hc *HTTPCache) get() (status int, done chan struct{}, data *HTTPData) {
 	// 因为有可能在函数调用完成后，刚好缓存过期了，如果此时不返回status与data
 	// 当其它goroutin获取锁之后，有可能刚好重置数据
 	if status == StatusCacheable {
-		data = hc.data
+		data = hc.getData()
 	}
 	return
 }
 
+// GetVariant get the variant http cache of the request header,
+// if the http cache doesn't have vary or it is expired, returns itself.
+func (hc *HTTPCache) GetVariant(header http.Header) *HTTPCache {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	if len(hc.vary) == 0 {
+		return hc
+	}
+	now := int(time.Now().Unix())
+	// vary已过期，需要重新获取数据以确认vary
+	if hc.expiredAt != 0 && hc.expiredAt < now {
+		return hc
+	}
+	key := getVariantKey(hc.vary, header)
+	variant, ok := hc.variants[key]
+	if ok {
+		return variant
+	}
+	variant = newVariantHTTPCache()
+	variant.counters = hc.counters
+	// 如果variant过多，则返回不保存的缓存（相当于不使用缓存）
+	if len(hc.variants) >= maxVariants {
+		return variant
+	}
+	variant.onResize = hc.onResize
+	variant.arena = hc.arena
+	hc.variants[key] = variant
+	return variant
+}
+
+// Vary set the vary of http cache, and returns the variant http cache of the request header.
+// The status of returned variant is fetching, it should be set to cachable or hit for pass.
+// If the http cache is a variant, returns itself.
+func (hc *HTTPCache) Vary(ttl int, vary []string, header http.Header) *HTTPCache {
+	if hc.isVariant {
+		return hc
+	}
+	hc.mu.Lock()
+	hc.setCreatedAt(time.Now())
+	hc.expiredAt = hc.createdAt + ttl
+	delta := -hc.size
+	// vary未变化则保留原有的缓存
+	if !isSameVary(hc.vary, vary) || hc.variants == nil {
+		delta -= hc.removeVariants()
+		hc.variants = make(map[string]*HTTPCache)
+	}
+	hc.vary = vary
+	// 等待中的请求由于无法确认其对应的variant，直接设置为hit for pass
+	hc.status = StatusHitForPass
+	hc.setData(nil)
+	hc.size = 0
+	for _, ch := range hc.chans {
+		close(ch)
+	}
+	hc.chans = nil
+
+	key := getVariantKey(vary, header)
+	if prev, ok := hc.variants[key]; ok {
+		delta -= prev.detach()
+	}
+	variant := newVariantHTTPCache()
+	variant.status = StatusFetching
+	variant.onResize = hc.onResize
+	variant.counters = hc.counters
+	variant.arena = hc.arena
+	hc.variants[key] = variant
+	hc.mu.Unlock()
+
+	hc.resize(delta)
+	hc.expire()
+	return variant
+}
+
 // HitForPass set the http cache hit for pass
 func (hc *HTTPCache) HitForPass(ttl int) {
 	hc.mu.Lock()
-	defer hc.mu.Unlock()
 	hc.expiredAt = int(time.Now().Unix()) + ttl
 	hc.status = StatusHitForPass
+	hc.revalidating = false
+	hc.staleWhileRevalidate = 0
+	hc.staleIfError = 0
+	delta := -hc.size - hc.removeVariants()
+	hc.setData(nil)
+	hc.size = 0
+	hc.vary = nil
 	for _, ch := range hc.chans {
-		ch <- struct{}{}
+		close(ch)
 	}
+	hc.chans = nil
+	hc.mu.Unlock()
+
+	hc.resize(delta)
+	hc.expire()
 }
 
 // Cachable set the http cache cachable
 func (hc *HTTPCache) Cachable(ttl int, httpData *HTTPData) {
 	hc.mu.Lock()
-	defer hc.mu.Unlock()
-	hc.createdAt = int(time.Now().Unix())
+	hc.setCreatedAt(time.Now())
 	hc.expiredAt = hc.createdAt + ttl
 	hc.status = StatusCacheable
+	delta := -hc.size - hc.removeVariants()
+	hc.vary = nil
 
-	hc.data = httpData
+	hc.revalidating = false
+	hc.size = hc.setData(httpData)
+	delta += hc.size
 	for _, ch := range hc.chans {
-		ch <- struct{}{}
+		close(ch)
+	}
+	hc.chans = nil
+	hc.mu.Unlock()
+
+	hc.counters.addStore()
+	hc.resize(delta)
+	hc.expire()
+}
+
+// removeVariants remove all variants of http cache(the lock should be held),
+// returns the byte size of them
+func (hc *HTTPCache) removeVariants() int {
+	size := 0
+	for _, variant := range hc.variants {
+		size += variant.detach()
+	}
+	hc.variants = nil
+	return size
+}
+
+// detach detach the variant from http cache, returns its byte size
+func (hc *HTTPCache) detach() int {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	hc.onResize = nil
+	hc.released = true
+	hc.freeData()
+	return hc.size
+}
+
+// hasData check the http cache has data(the lock should be held)
+func (hc *HTTPCache) hasData() bool {
+	return hc.data != nil || hc.ref.length != 0
+}
+
+// getData get the data of http cache(the lock should be held),
+// the data of arena is the view of page, it should not be modified
+func (hc *HTTPCache) getData() *HTTPData {
+	if hc.ref.length != 0 {
+		return hc.arena.load(hc.ref)
+	}
+	return hc.data
+}
+
+// setData set the data of http cache(the lock should be held), it is saved to
+// arena if the arena is set, otherwise(or the data is too large) it is saved in heap.
+// It returns the byte size of data, which is the aligned size if it is saved to arena
+func (hc *HTTPCache) setData(data *HTTPData) int {
+	hc.freeData()
+	hc.data = data
+	if data == nil {
+		return 0
+	}
+	if hc.arena != nil && !hc.released {
+		if ref, ok := hc.arena.store(data, hc); ok {
+			hc.ref = ref
+			hc.data = nil
+			return int(ref.size)
+		}
+	}
+	return data.Size()
+}
+
+// freeData release the data of arena(the lock should be held)
+func (hc *HTTPCache) freeData() {
+	if hc.ref.length == 0 {
+		return
 	}
+	hc.arena.release(hc.ref)
+	hc.ref = arenaRef{}
+	hc.data = nil
+}
+
+// setArena set the arena of http cache and its variants,
+// the data is moved to the new arena(or heap if it is nil)
+func (hc *HTTPCache) setArena(a *arena) {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	for _, variant := range hc.variants {
+		variant.setArena(a)
+	}
+	if hc.arena == a {
+		return
+	}
+	data := hc.getData()
+	hc.freeData()
+	hc.arena = a
+	hc.size = hc.setData(data)
+}
+
+// relocate move the data of http cache to the current page of arena,
+// it is called when the arena is compacted
+func (hc *HTTPCache) relocate(a *arena) {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	// 数据已释放或已迁移至其它存储
+	if hc.arena != a || hc.ref.length == 0 {
+		return
+	}
+	hc.ref = a.move(hc.ref, hc)
+}
+
+// release release the data of arena when the http cache is removed,
+// the data of heap is kept for the requests which are using it
+func (hc *HTTPCache) release() {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	hc.released = true
+	hc.freeData()
+	for _, variant := range hc.variants {
+		variant.release()
+	}
+}
+
+// setOnResize set the resize event of http cache and its variants
+func (hc *HTTPCache) setOnResize(fn func(delta int)) {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	hc.onResize = fn
+	for _, variant := range hc.variants {
+		variant.mu.Lock()
+		variant.onResize = fn
+		variant.mu.Unlock()
+	}
+}
+
+// resize call the resize event if the byte size of cache is changed
+func (hc *HTTPCache) resize(delta int) {
+	if delta == 0 {
+		return
+	}
+	hc.mu.Lock()
+	onResize := hc.onResize
+	hc.mu.Unlock()
+	if onResize != nil {
+		onResize(delta)
+	}
+}
+
+// setOnExpire set the expire event of http cache, the variants don't have it
+// because the expiry of http cache includes them
+func (hc *HTTPCache) setOnExpire(fn func(deadline int)) {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	hc.onExpire = fn
+}
+
+// expire call the expire event with the deadline of http cache
+func (hc *HTTPCache) expire() {
+	hc.mu.Lock()
+	onExpire := hc.onExpire
+	deadline := hc.deadline()
+	hc.mu.Unlock()
+	if onExpire != nil && deadline != 0 {
+		onExpire(deadline)
+	}
+}
+
+// deadline get the expired time(the stale time is included) of http cache,
+// returns 0 if it doesn't have expired time. The lock should be held.
+func (hc *HTTPCache) deadline() int {
+	if hc.expiredAt == 0 {
+		return 0
+	}
+	stale := hc.staleWhileRevalidate
+	if hc.staleIfError > stale {
+		stale = hc.staleIfError
+	}
+	return hc.expiredAt + stale
+}
+
+// expiry get the deadline of http cache and check it can be removed,
+// the fetching http cache can't be removed even if it is expired
+func (hc *HTTPCache) expiry(now int) (deadline int, removable bool) {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	deadline = hc.deadline()
+	return deadline, hc.status != StatusFetching && deadline != 0 && deadline < now
+}
+
+// addTags add the tags to http cache, returns the tags which are not exists
+func (hc *HTTPCache) addTags(tags []string) (added []string) {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	for _, tag := range tags {
+		if tag == "" || util.ContainesString(hc.tags, tag) || util.ContainesString(added, tag) {
+			continue
+		}
+		added = append(added, tag)
+	}
+	hc.tags = append(hc.tags, added...)
+	return
+}
+
+// Tags get the tags of http cache
+func (hc *HTTPCache) Tags() []string {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	return hc.tags
+}
+
+// Size get the byte size of http cache, include its variants
+func (hc *HTTPCache) Size() int {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	size := hc.size
+	for _, variant := range hc.variants {
+		variant.mu.Lock()
+		size += variant.size
+		variant.mu.Unlock()
+	}
+	return size
+}
+
+// SetStaleWhileRevalidate set the stale while revalidate ttl of http cache,
+// it should be called before cachable.
+func (hc *HTTPCache) SetStaleWhileRevalidate(ttl int) {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	hc.staleWhileRevalidate = ttl
+}
+
+// SetStaleIfError set the stale if error ttl of http cache,
+// it should be called before cachable.
+func (hc *HTTPCache) SetStaleIfError(ttl int) {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	hc.staleIfError = ttl
+}
+
+// FallbackToStale get the stale data when fetching fail,
+// if the stale data is available, the status of http cache will be set to cachable(expired).
+// It returns nil if there isn't available stale data.
+func (hc *HTTPCache) FallbackToStale() *HTTPData {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	now := int(time.Now().Unix())
+	if !hc.hasData() || hc.expiredAt == 0 || hc.expiredAt+hc.staleIfError < now {
+		return nil
+	}
+	// 恢复为可缓存状态，等待中的请求则可使用过期的数据
+	hc.status = StatusCacheable
+	hc.revalidating = false
+	for _, ch := range hc.chans {
+		close(ch)
+	}
+	hc.chans = nil
+	return hc.getData()
+}
+
+// Validators get the ETag and Last-Modified of the cached data(may be expired),
+// they are used for conditional request to revalidate the cache.
+func (hc *HTTPCache) Validators() (etag, lastModified string) {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	if !hc.hasData() {
+		return
+	}
+	header := hc.getData().Header()
+	return header.Get(elton.HeaderETag), header.Get(elton.HeaderLastModified)
+}
+
+// Data get the cached data(may be expired)
+func (hc *HTTPCache) Data() *HTTPData {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	return hc.getData()
+}
+
+// Revalidate set the http cache to revalidating,
+// returns false if it is revalidating by other request.
+func (hc *HTTPCache) Revalidate() bool {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	if hc.revalidating {
+		return false
+	}
+	hc.revalidating = true
+	return true
 }
 
 // Age get the http cache's age
@@ -230,16 +866,223 @@ func (hc *HTTPCache) Age() int {
 	return int(time.Now().Unix()) - hc.createdAt
 }
 
+// Info get the information of http cache,
+// the header values will be returned if withHeader is true
+func (hc *HTTPCache) Info(withHeader bool) *HTTPCacheInfo {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	now := int(time.Now().Unix())
+	info := &HTTPCacheInfo{
+		Status:   StatusString(hc.status),
+		Size:     hc.size,
+		Vary:     hc.vary,
+		Variants: len(hc.variants),
+		Tags:     hc.tags,
+		Waiters:  len(hc.chans),
+	}
+	if hc.createdAt != 0 {
+		info.Age = now - hc.createdAt
+	}
+	if hc.expiredAt != 0 {
+		info.TTL = hc.expiredAt - now
+	}
+	data := hc.getData()
+	if data == nil {
+		return info
+	}
+	info.RawSize = len(data.RawBody)
+	info.GzipSize = len(data.GzipBody)
+	info.BrSize = len(data.BrBody)
+	if withHeader {
+		info.Header = make(http.Header)
+	}
+	for _, header := range data.Headers {
+		key := string(header[0])
+		if withHeader {
+			info.Header.Add(key, string(header[1]))
+		}
+		if !util.ContainesString(info.Headers, key) {
+			info.Headers = append(info.Headers, key)
+		}
+	}
+	return info
+}
+
+// CreatedAt get the created time(unix seconds) of http cache
+func (hc *HTTPCache) CreatedAt() int {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	return hc.createdAt
+}
+
+// getCreatedNano get the created time(unix nanoseconds) of http cache
+func (hc *HTTPCache) getCreatedNano() int64 {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	return hc.createdNano
+}
+
+// setCreatedAt set the created time of http cache(the lock should be held)
+func (hc *HTTPCache) setCreatedAt(now time.Time) {
+	hc.createdAt = int(now.Unix())
+	hc.createdNano = now.UnixNano()
+}
+
 // GetStatus get http cache status
 func (hc *HTTPCache) GetStatus() int {
 	return hc.status
 }
 
-// IsExpired the cache is expired
+// IsExpired the cache is expired(the stale time is included)
 func (hc *HTTPCache) IsExpired() bool {
-	if hc.expiredAt == 0 {
-		return false
+	deadline := hc.deadline()
+	return deadline != 0 && deadline < int(time.Now().Unix())
+}
+
+// toCacheItem convert the http cache to cache item,
+// returns nil if the http cache is not cacheable or is expired
+func (hc *HTTPCache) toCacheItem() *cacheItem {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	// variant的数据保存在主缓存中，不单独处理
+	if hc.isVariant {
+		return nil
 	}
-	now := int(time.Now().Unix())
-	return hc.expiredAt < now
+	return hc.getCacheItem()
+}
+
+// getCacheItem get the cache item of http cache(the lock should be held),
+// returns nil if the http cache is not cacheable or is expired
+func (hc *HTTPCache) getCacheItem() *cacheItem {
+	if hc.status != StatusCacheable || !hc.hasData() || hc.IsExpired() {
+		return nil
+	}
+	return &cacheItem{
+		CreatedAt:            hc.createdAt,
+		ExpiredAt:            hc.expiredAt,
+		StaleWhileRevalidate: hc.staleWhileRevalidate,
+		StaleIfError:         hc.staleIfError,
+		Tags:                 hc.tags,
+		Data:                 hc.getData(),
+	}
+}
+
+// toVariantItems convert the http cache which has vary to cache item(without data)
+// and the cache items of its cacheable variants(the key is variant key),
+// returns nil if the http cache doesn't have vary or it is expired
+func (hc *HTTPCache) toVariantItems() (item *cacheItem, vary []string, variants map[string]*cacheItem) {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	if len(hc.vary) == 0 || hc.IsExpired() {
+		return
+	}
+	variants = make(map[string]*cacheItem)
+	for key, variant := range hc.variants {
+		variant.mu.Lock()
+		variantItem := variant.getCacheItem()
+		variant.mu.Unlock()
+		if variantItem != nil {
+			variants[key] = variantItem
+		}
+	}
+	item = &cacheItem{
+		CreatedAt: hc.createdAt,
+		ExpiredAt: hc.expiredAt,
+		Tags:      hc.tags,
+	}
+	return item, hc.vary, variants
+}
+
+// restoreVariants restore the http cache which has vary and its variants from cache items,
+// it should be called before the http cache is used
+func (hc *HTTPCache) restoreVariants(item *cacheItem, vary []string, variants map[string]*cacheItem) {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	// 与Vary一致，主缓存的状态为hit for pass
+	hc.status = StatusHitForPass
+	hc.createdAt = item.CreatedAt
+	hc.createdNano = int64(item.CreatedAt) * int64(time.Second)
+	hc.expiredAt = item.ExpiredAt
+	hc.tags = item.Tags
+	hc.vary = vary
+	hc.variants = make(map[string]*HTTPCache)
+	for key, variantItem := range variants {
+		variant := newVariantHTTPCache()
+		variant.counters = hc.counters
+		variant.arena = hc.arena
+		variant.onResize = hc.onResize
+		variant.restore(variantItem)
+		hc.variants[key] = variant
+	}
+}
+
+// restore restore the http cache from cache item,
+// it should be called before the http cache is used
+func (hc *HTTPCache) restore(item *cacheItem) {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	hc.status = StatusCacheable
+	hc.createdAt = item.CreatedAt
+	// 仅有秒级的创建时间，按该秒的开始时间处理
+	hc.createdNano = int64(item.CreatedAt) * int64(time.Second)
+	hc.expiredAt = item.ExpiredAt
+	hc.staleWhileRevalidate = item.StaleWhileRevalidate
+	hc.staleIfError = item.StaleIfError
+	hc.tags = item.Tags
+	hc.size = hc.setData(item.Data)
+}
+
+// fill fill the http cache with the cache item of other node,
+// the waiting requests will get the cachable data
+func (hc *HTTPCache) fill(item *cacheItem) {
+	hc.mu.Lock()
+	hc.status = StatusCacheable
+	hc.createdAt = item.CreatedAt
+	// 仅有秒级的创建时间，按该秒的开始时间处理
+	hc.createdNano = int64(item.CreatedAt) * int64(time.Second)
+	hc.expiredAt = item.ExpiredAt
+	hc.staleWhileRevalidate = item.StaleWhileRevalidate
+	hc.staleIfError = item.StaleIfError
+	delta := -hc.size - hc.removeVariants()
+	hc.vary = nil
+
+	hc.revalidating = false
+	hc.size = hc.setData(item.Data)
+	delta += hc.size
+	for _, ch := range hc.chans {
+		close(ch)
+	}
+	hc.chans = nil
+	hc.mu.Unlock()
+
+	hc.counters.addStore()
+	hc.resize(delta)
+	hc.expire()
+}
+
+// waitLoaded wait for the data of http cache is loaded from other storage
+func (hc *HTTPCache) waitLoaded() {
+	hc.mu.Lock()
+	loading := hc.loading
+	hc.mu.Unlock()
+	if loading != nil {
+		<-loading
+	}
+}
+
+// loaded mark the data of http cache is loaded, the waiting requests continue
+func (hc *HTTPCache) loaded() {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	if hc.loading != nil {
+		close(hc.loading)
+		hc.loading = nil
+	}
+}
+
+// IsVariant check the http cache is the variant of vary
+func (hc *HTTPCache) IsVariant() bool {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	return hc.isVariant
 }
@@ -13,25 +13,46 @@
 // limitations under the License.
 
 // copy from https://github.com/golang/groupcache/blob/master/lru/lru.go
-// 此模块中主要实现lru方式的HTTP缓存，避免缓存过大占用过多内存
+// 此模块中主要实现HTTP缓存的存储，超出限制时由淘汰策略（默认为lru）选择淘汰的缓存，避免缓存过大占用过多内存
 
 package cache
 
 import (
-	"container/list"
 	"sync"
+	"time"
 )
 
-// HTTPCacheLRU is an LRU cache. It is not safe for concurrent access.
+// HTTPCacheLRU is a cache which evicts the entry selected by the
+// eviction policy(lru by default). It is not safe for concurrent access.
 type HTTPCacheLRU struct {
 	// 用于保证每个dispatcher的操作，避免同时操作lru cache
 	mu sync.Mutex
 	// MaxEntries is the maximum number of cache entries before
 	// an item is evicted. Zero means no limit.
 	MaxEntries int
+	// MaxBytes is the maximum byte size of cache entries before
+	// an item is evicted. Zero means no limit.
+	MaxBytes int
+	// OnEvicted optionally specifies a callback function to be
+	// executed when an entry is evicted because of the limit.
+	OnEvicted func(key string, value *HTTPCache)
+	// Loader optionally specifies a function to load the data
+	// of http cache when it's created, it is called without the lock.
+	Loader func(key string, value *HTTPCache)
 
-	ll    *list.List
-	cache map[string]*list.Element
+	// 淘汰策略
+	policy EvictionPolicy
+	cache  map[string]*entry
+	// 当前缓存数据占用的字节数
+	bytes int
+	// 标签对应的缓存key
+	tags map[string]map[string]bool
+	// 缓存过期时间的索引
+	expiry expiryHeap
+	// 缓存数据的page存储，nil表示数据保存在堆中
+	arena *arena
+	// 统计计数（由dispatcher设置）
+	counters *Counters
 }
 
 // Iterator iterator function
@@ -40,15 +61,26 @@ type Iterator func(key string, value *HTTPCache)
 type entry struct {
 	key   string
 	value *HTTPCache
+	// 该缓存已计算的字节数
+	size int
+	// 该缓存的标签
+	tags []string
+	// 该缓存在过期索引中的过期时间
+	deadline int
 }
 
 // NewHTTPCacheLRU creates a new Cache.
 // If maxEntries is zero, the cache has no limit and it's assumed
 // that eviction is done by the caller.
 func NewHTTPCacheLRU(maxEntries int) *HTTPCacheLRU {
+	return NewHTTPCacheLRUWithPolicy(maxEntries, newLRUPolicy())
+}
+
+// NewHTTPCacheLRUWithPolicy creates a new Cache with the eviction policy.
+func NewHTTPCacheLRUWithPolicy(maxEntries int, policy EvictionPolicy) *HTTPCacheLRU {
 	return &HTTPCacheLRU{
 		MaxEntries: maxEntries,
-		ll:         list.New(),
+		policy:     policy,
 	}
 }
 
@@ -66,31 +98,179 @@ func (c *HTTPCacheLRU) Unlock() {
 // 需要注意，lru其它方法中并没有锁的处理
 func (c *HTTPCacheLRU) FindOrCreate(key string) *HTTPCache {
 	c.Lock()
-	defer c.Unlock()
 	cache, ok := c.Get(key)
-	if !ok {
-		cache = NewHTTPCache()
-		c.Add(key, cache)
+	if ok {
+		c.Unlock()
+		// 数据加载中的缓存需要等待加载完成
+		cache.waitLoaded()
+		return cache
+	}
+	cache = NewHTTPCache()
+	cache.counters = c.counters
+	cache.arena = c.arena
+	cache.onResize = func(delta int) {
+		c.resize(key, cache, delta)
+	}
+	cache.onExpire = func(deadline int) {
+		c.expire(key, cache, deadline)
 	}
+	loader := c.Loader
+	if loader != nil {
+		cache.loading = make(chan struct{})
+	}
+	c.Add(key, cache)
+	c.Unlock()
+	if loader == nil {
+		return cache
+	}
+
+	// 从其它存储中加载缓存数据（如磁盘缓存），
+	// 加载时不持有锁，避免阻塞其它key的请求，相同key的请求则等待加载完成
+	loader(key, cache)
+	c.Lock()
+	kv, hit := c.cache[key]
+	// 加载过程中已被删除或替换的则忽略
+	if hit && kv.value == cache {
+		c.addTags(kv, cache.Tags())
+		c.addBytes(kv, cache.Size())
+		deadline, _ := cache.expiry(0)
+		c.track(kv, deadline)
+	}
+	c.Unlock()
+	cache.loaded()
 	return cache
 }
 
+// attach add the http cache which is moved from other lru cache,
+// it will be ignored if the key exists, returns true if it is added
+func (c *HTTPCacheLRU) attach(key string, value *HTTPCache) bool {
+	c.Lock()
+	defer c.Unlock()
+	if _, ok := c.cache[key]; ok {
+		return false
+	}
+	value.setOnResize(func(delta int) {
+		c.resize(key, value, delta)
+	})
+	value.setOnExpire(func(deadline int) {
+		c.expire(key, value, deadline)
+	})
+	value.setArena(c.arena)
+	c.Add(key, value)
+	kv := c.cache[key]
+	c.addTags(kv, value.Tags())
+	c.addBytes(kv, value.Size())
+	deadline, _ := value.expiry(0)
+	c.track(kv, deadline)
+	return true
+}
+
+// AddTags add the tags to the http cache of key
+func (c *HTTPCacheLRU) AddTags(key string, tags ...string) {
+	c.Lock()
+	defer c.Unlock()
+	kv, hit := c.cache[key]
+	if !hit {
+		return
+	}
+	c.addTags(kv, kv.value.addTags(tags))
+}
+
+// addTags add the tags of entry to index
+func (c *HTTPCacheLRU) addTags(kv *entry, tags []string) {
+	if kv == nil || len(tags) == 0 {
+		return
+	}
+	if c.tags == nil {
+		c.tags = make(map[string]map[string]bool)
+	}
+	for _, tag := range tags {
+		keys, ok := c.tags[tag]
+		if !ok {
+			keys = make(map[string]bool)
+			c.tags[tag] = keys
+		}
+		keys[kv.key] = true
+	}
+	kv.tags = append(kv.tags, tags...)
+}
+
+// removeTags remove the tags of entry from index
+func (c *HTTPCacheLRU) removeTags(kv *entry) {
+	for _, tag := range kv.tags {
+		keys := c.tags[tag]
+		delete(keys, kv.key)
+		if len(keys) == 0 {
+			delete(c.tags, tag)
+		}
+	}
+	kv.tags = nil
+}
+
+// RemoveByTag remove the caches which have the tag
+func (c *HTTPCacheLRU) RemoveByTag(tag string) (keys []string) {
+	c.Lock()
+	defer c.Unlock()
+	for key := range c.tags[tag] {
+		keys = append(keys, key)
+	}
+	for _, key := range keys {
+		c.Remove(key)
+	}
+	return
+}
+
+// resize update the byte size of the http cache,
+// and remove the oldest items if the byte size is over the limit
+func (c *HTTPCacheLRU) resize(key string, value *HTTPCache, delta int) {
+	c.Lock()
+	defer c.Unlock()
+	kv, hit := c.cache[key]
+	// 如果缓存已被删除或替换，则忽略
+	if !hit || kv.value != value {
+		return
+	}
+	c.addBytes(kv, delta)
+}
+
+// addBytes add the byte size of the entry,
+// and evict the items if the byte size is over the limit
+func (c *HTTPCacheLRU) addBytes(kv *entry, delta int) {
+	if kv == nil || delta == 0 {
+		return
+	}
+	kv.size += delta
+	c.bytes += delta
+	for c.MaxBytes != 0 && c.bytes > c.MaxBytes {
+		if !c.evict() {
+			break
+		}
+	}
+}
+
 // Add adds a value to the cache.
 func (c *HTTPCacheLRU) Add(key string, value *HTTPCache) {
 	if c.cache == nil {
-		c.cache = make(map[string]*list.Element)
-		c.ll = list.New()
+		c.cache = make(map[string]*entry)
 	}
-	if ee, ok := c.cache[key]; ok {
-		c.ll.MoveToFront(ee)
-		ee.Value.(*entry).value = value
+	if kv, ok := c.cache[key]; ok {
+		c.policy.Access(key)
+		c.bytes -= kv.size
+		c.removeTags(kv)
+		if kv.value != value {
+			kv.value.release()
+		}
+		kv.value = value
+		kv.size = 0
+		kv.deadline = 0
 		return
 	}
-	ele := c.ll.PushFront(&entry{key, value})
-	c.cache[key] = ele
-	if c.MaxEntries != 0 && c.ll.Len() > c.MaxEntries {
-		c.RemoveOldest()
+	// 先淘汰再添加，避免新添加的缓存被淘汰
+	if c.MaxEntries != 0 && len(c.cache) >= c.MaxEntries {
+		c.evict()
 	}
+	c.cache[key] = &entry{key: key, value: value}
+	c.policy.Add(key)
 }
 
 // Get looks up a key's value from the cache.
@@ -98,72 +278,164 @@ func (c *HTTPCacheLRU) Get(key string) (value *HTTPCache, ok bool) {
 	if c.cache == nil {
 		return
 	}
-	if ele, hit := c.cache[key]; hit {
-		c.ll.MoveToFront(ele)
-		return ele.Value.(*entry).value, true
+	if kv, hit := c.cache[key]; hit {
+		c.policy.Access(key)
+		return kv.value, true
+	}
+	return
+}
+
+// Peek looks up a key's value from the cache without updating the recent-ness.
+func (c *HTTPCacheLRU) Peek(key string) (value *HTTPCache, ok bool) {
+	if c.cache == nil {
+		return
+	}
+	if kv, hit := c.cache[key]; hit {
+		return kv.value, true
 	}
 	return
 }
 
+// Keys returns the keys of the cache.
+func (c *HTTPCacheLRU) Keys() []string {
+	keys := make([]string, 0, len(c.cache))
+	for key := range c.cache {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
 // Remove removes the provided key from the cache.
 func (c *HTTPCacheLRU) Remove(key string) {
 	if c.cache == nil {
 		return
 	}
-	if ele, hit := c.cache[key]; hit {
-		c.removeElement(ele)
+	if kv, hit := c.cache[key]; hit {
+		c.policy.Remove(key)
+		c.deleteEntry(kv)
+		kv.value.release()
 	}
 }
 
-// RemoveOldest removes the oldest item from the cache.
+// RemoveOldest removes the item selected by the eviction policy from
+// the cache, it's the oldest item for lru.
 func (c *HTTPCacheLRU) RemoveOldest() {
+	c.evict()
+}
+
+// evict evicts the item selected by the eviction policy,
+// returns false if there is no item to evict
+func (c *HTTPCacheLRU) evict() bool {
 	if c.cache == nil {
-		return
+		return false
 	}
-	ele := c.ll.Back()
-	if ele != nil {
-		c.removeElement(ele)
+	key, ok := c.policy.Evict()
+	if !ok {
+		return false
+	}
+	kv, hit := c.cache[key]
+	if !hit {
+		return true
+	}
+	c.deleteEntry(kv)
+	c.counters.addEviction()
+	if c.OnEvicted != nil {
+		c.OnEvicted(kv.key, kv.value)
 	}
+	// 淘汰的缓存保存至磁盘后再释放
+	kv.value.release()
+	return true
 }
 
-func (c *HTTPCacheLRU) removeElement(e *list.Element) {
-	c.ll.Remove(e)
-	kv := e.Value.(*entry)
+// deleteEntry delete the entry from cache, the key of eviction policy isn't removed
+func (c *HTTPCacheLRU) deleteEntry(kv *entry) {
 	delete(c.cache, kv.key)
+	c.bytes -= kv.size
+	c.removeTags(kv)
 }
 
-// Len returns the number of items in the cache.
-func (c *HTTPCacheLRU) Len() int {
+// removeAll removes all items and returns them from the coldest to the hottest.
+func (c *HTTPCacheLRU) removeAll() (items []*entry) {
+	items = c.entries()
+	c.Clear()
+	return
+}
+
+// entries get the items of cache from the coldest to the hottest(oldest to newest for lru)
+func (c *HTTPCacheLRU) entries() (items []*entry) {
 	if c.cache == nil {
-		return 0
+		return
 	}
-	return c.ll.Len()
+	keys := c.policy.Keys()
+	items = make([]*entry, 0, len(keys))
+	for _, key := range keys {
+		if kv, ok := c.cache[key]; ok {
+			items = append(items, kv)
+		}
+	}
+	return
+}
+
+// Len returns the number of items in the cache.
+func (c *HTTPCacheLRU) Len() int {
+	return len(c.cache)
+}
+
+// Bytes returns the byte size of items in the cache.
+func (c *HTTPCacheLRU) Bytes() int {
+	return c.bytes
 }
 
 // Clear purges all stored items from the cache.
 func (c *HTTPCacheLRU) Clear() {
-	c.ll = nil
+	c.policy.Clear()
 	c.cache = nil
+	c.bytes = 0
+	c.tags = nil
+	c.expiry = nil
 }
 
 // ForEach for each
 func (c *HTTPCacheLRU) ForEach(fn Iterator) {
-	for _, e := range c.cache {
-		kv := e.Value.(*entry)
+	for _, kv := range c.cache {
 		fn(kv.key, kv.value)
 	}
 }
 
-// RemoveExpired remove expired cache
-func (c *HTTPCacheLRU) RemoveExpired() int {
+// RemoveBy remove the caches which match the function
+func (c *HTTPCacheLRU) RemoveBy(match func(key string) bool) (keys []string) {
+	return c.removeBy(func(key string, _ *HTTPCache) bool {
+		return match(key)
+	})
+}
+
+// removeBy remove the http caches which match the function of key and http cache
+func (c *HTTPCacheLRU) removeBy(match func(key string, value *HTTPCache) bool) (keys []string) {
 	c.Lock()
 	defer c.Unlock()
-	count := 0
-	c.ForEach(func(key string, item *HTTPCache) {
-		if item.IsExpired() {
+	c.ForEach(func(key string, value *HTTPCache) {
+		if match(key, value) {
 			c.Remove(key)
-			count++
+			keys = append(keys, key)
 		}
 	})
+	return
+}
+
+// RemoveExpired remove expired cache by the expiry index,
+// the lock is released after each batch to avoid blocking other requests
+func (c *HTTPCacheLRU) RemoveExpired() int {
+	now := int(time.Now().Unix())
+	count := 0
+	for {
+		c.Lock()
+		removed, more := c.removeExpired(now, expiryBatchSize)
+		c.Unlock()
+		count += removed
+		if !more {
+			break
+		}
+	}
+	c.counters.addExpiration(count)
 	return count
 }
@@ -15,7 +15,9 @@
 package cache
 
 import (
+	"net/http"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -60,8 +62,156 @@ func TestHTTPCacheLRU(t *testing.T) {
 	assert.NotNil(v)
 
 	// 设置该缓存为过期
-	v.expiredAt = 1
+	v.HitForPass(-1)
 	lru.RemoveExpired()
 	_, ok = lru.Get(key1)
 	assert.False(ok)
 }
+
+func TestHTTPCacheLRUMaxBytes(t *testing.T) {
+	assert := assert.New(t)
+	lru := NewHTTPCacheLRU(10)
+	lru.MaxBytes = 10
+
+	c1 := lru.FindOrCreate("a")
+	c1.Cachable(10, &HTTPData{
+		RawBody: []byte("123456"),
+	})
+	assert.Equal(6, lru.Bytes())
+	assert.Equal(6, c1.Size())
+
+	// 更新缓存数据时，字节数也更新
+	c1.Cachable(10, &HTTPData{
+		RawBody: []byte("1234"),
+	})
+	assert.Equal(4, lru.Bytes())
+
+	c2 := lru.FindOrCreate("b")
+	c2.Cachable(10, &HTTPData{
+		RawBody: []byte("12345"),
+	})
+	assert.Equal(9, lru.Bytes())
+	assert.Equal(2, lru.Len())
+
+	// 超出字节数限制，最旧的缓存被删除
+	c3 := lru.FindOrCreate("c")
+	c3.Cachable(10, &HTTPData{
+		RawBody: []byte("123"),
+	})
+	assert.Equal(8, lru.Bytes())
+	assert.Equal(2, lru.Len())
+	_, ok := lru.Get("a")
+	assert.False(ok)
+
+	// 已删除的缓存再更新不影响字节数
+	c1.Cachable(10, &HTTPData{
+		RawBody: []byte("123"),
+	})
+	assert.Equal(8, lru.Bytes())
+
+	c2.HitForPass(10)
+	assert.Equal(3, lru.Bytes())
+
+	lru.Remove("c")
+	assert.Equal(0, lru.Bytes())
+}
+
+func TestHTTPCacheLRUVaryBytes(t *testing.T) {
+	assert := assert.New(t)
+	lru := NewHTTPCacheLRU(10)
+	c := lru.FindOrCreate("a")
+	header := make(http.Header)
+	header.Set("Accept-Language", "zh")
+	variant := c.Vary(10, []string{"Accept-Language"}, header)
+	variant.Cachable(10, &HTTPData{
+		RawBody: []byte("1234"),
+	})
+	assert.Equal(4, lru.Bytes())
+	assert.Equal(4, c.Size())
+
+	// 缓存不再有vary时，variant的字节数被删除
+	c.Cachable(10, &HTTPData{
+		RawBody: []byte("12"),
+	})
+	assert.Equal(2, lru.Bytes())
+	variant.Cachable(10, &HTTPData{
+		RawBody: []byte("123456"),
+	})
+	assert.Equal(2, lru.Bytes())
+}
+
+func TestHTTPCacheLRUTags(t *testing.T) {
+	assert := assert.New(t)
+	lru := NewHTTPCacheLRU(2)
+	lru.FindOrCreate("a")
+	lru.FindOrCreate("b")
+	lru.AddTags("a", "product:1", "products")
+	lru.AddTags("a", "products")
+	lru.AddTags("b", "products")
+	// 不存在的缓存忽略
+	lru.AddTags("c", "products")
+	assert.Equal([]string{"product:1", "products"}, lru.cache["a"].value.Tags())
+	assert.Equal(2, len(lru.tags["products"]))
+
+	assert.Equal([]string{"a"}, lru.RemoveByTag("product:1"))
+	_, ok := lru.Get("a")
+	assert.False(ok)
+	assert.Equal(1, len(lru.tags["products"]))
+	assert.Nil(lru.tags["product:1"])
+
+	// 淘汰的缓存其标签也删除
+	lru.FindOrCreate("c")
+	lru.FindOrCreate("d")
+	assert.Nil(lru.tags["products"])
+	assert.Empty(lru.RemoveByTag("products"))
+}
+
+func TestHTTPCacheLRULoader(t *testing.T) {
+	assert := assert.New(t)
+	lru := NewHTTPCacheLRU(10)
+	start := make(chan struct{})
+	resume := make(chan struct{})
+	lru.Loader = func(key string, value *HTTPCache) {
+		if key != "a" {
+			return
+		}
+		close(start)
+		<-resume
+		value.restore(&cacheItem{
+			CreatedAt: int(time.Now().Unix()),
+			ExpiredAt: int(time.Now().Unix()) + 60,
+			Tags:      []string{"tag"},
+			Data: &HTTPData{
+				RawBody: []byte("abcd"),
+			},
+		})
+	}
+	done := make(chan *HTTPCache)
+	go func() {
+		done <- lru.FindOrCreate("a")
+	}()
+	<-start
+
+	// 加载时不阻塞其它key
+	b := lru.FindOrCreate("b")
+	assert.Equal(StatusUnknown, b.GetStatus())
+	// 相同key等待加载完成
+	waiting := make(chan *HTTPCache)
+	go func() {
+		waiting <- lru.FindOrCreate("a")
+	}()
+	select {
+	case <-waiting:
+		assert.Fail("should wait for loading")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(resume)
+	a := <-done
+	assert.Equal(a, <-waiting)
+	status, data := a.Get()
+	assert.Equal(StatusCacheable, status)
+	assert.Equal([]byte("abcd"), data.RawBody)
+	assert.Equal(4, lru.bytes)
+	assert.Equal(1, len(lru.expiry))
+	assert.Equal([]string{"a"}, lru.RemoveByTag("tag"))
+}
@@ -33,6 +33,7 @@ func TestStatusString(t *testing.T) {
 	assert.Equal(statusHitForPassDesc, StatusString(StatusHitForPass))
 	assert.Equal(statusCacheableDesc, StatusString(StatusCacheable))
 	assert.Equal(statusPassedDesc, StatusString(StatusPassed))
+	assert.Equal(statusStaleDesc, StatusString(StatusStale))
 	assert.Equal(statusUnknownDesc, StatusString(StatusUnknown))
 }
 
@@ -60,6 +61,143 @@ func TestHTTPHeaders(t *testing.T) {
 	assert.Equal("3", fieldB)
 }
 
+func TestHTTPDataSize(t *testing.T) {
+	assert := assert.New(t)
+	var httpData *HTTPData
+	assert.Equal(0, httpData.Size())
+
+	header := make(http.Header)
+	header.Add("Abc", "12")
+	httpData = &HTTPData{
+		Headers:  NewHTTPHeaders(header),
+		RawBody:  []byte("abcd"),
+		GzipBody: []byte("ab"),
+		BrBody:   []byte("a"),
+	}
+	assert.Equal(12, httpData.Size())
+}
+
+func TestHTTPDataRefresh(t *testing.T) {
+	assert := assert.New(t)
+	header := make(http.Header)
+	header.Set(elton.HeaderETag, `"123"`)
+	header.Set(elton.HeaderCacheControl, "max-age=10")
+	header.Set(elton.HeaderContentType, "text/plain")
+	data := &HTTPData{
+		StatusCode: 200,
+		Headers:    NewHTTPHeaders(header),
+		RawBody:    []byte("abcd"),
+		GzipBody:   []byte("gzip"),
+	}
+
+	notModifiedHeader := make(http.Header)
+	notModifiedHeader.Set(elton.HeaderCacheControl, "max-age=60")
+	notModifiedHeader.Set(elton.HeaderContentLength, "0")
+	nData := data.Refresh(notModifiedHeader)
+	assert.Equal(200, nData.StatusCode)
+	assert.Equal(data.RawBody, nData.RawBody)
+	assert.Equal(data.GzipBody, nData.GzipBody)
+	nHeader := nData.Header()
+	assert.Equal("max-age=60", nHeader.Get(elton.HeaderCacheControl))
+	assert.Equal(`"123"`, nHeader.Get(elton.HeaderETag))
+	assert.Equal("text/plain", nHeader.Get(elton.HeaderContentType))
+	assert.Empty(nHeader.Get(elton.HeaderContentLength))
+	// 原有数据不变
+	assert.Equal("max-age=10", data.Header().Get(elton.HeaderCacheControl))
+
+	hc := NewHTTPCache()
+	etag, lastModified := hc.Validators()
+	assert.Empty(etag)
+	assert.Empty(lastModified)
+	hc.Cachable(10, data)
+	etag, lastModified = hc.Validators()
+	assert.Equal(`"123"`, etag)
+	assert.Empty(lastModified)
+	assert.Equal(data, hc.Data())
+}
+
+func TestHTTPCacheInfo(t *testing.T) {
+	assert := assert.New(t)
+	hc := NewHTTPCache()
+	info := hc.Info(true)
+	assert.Equal("unknown", info.Status)
+	assert.Equal(0, info.TTL)
+
+	header := make(http.Header)
+	header.Add("A", "1")
+	header.Add("A", "2")
+	hc.Cachable(10, &HTTPData{
+		Headers: NewHTTPHeaders(header),
+		BrBody:  []byte("abc"),
+	})
+	hc.addTags([]string{"tag"})
+	info = hc.Info(false)
+	assert.Equal("cacheable", info.Status)
+	assert.Equal(10, info.TTL)
+	assert.Equal(3, info.BrSize)
+	assert.Equal([]string{"A"}, info.Headers)
+	assert.Equal([]string{"tag"}, info.Tags)
+	assert.Nil(info.Header)
+
+	info = hc.Info(true)
+	assert.Equal([]string{"1", "2"}, info.Header["A"])
+}
+
+func TestParseVary(t *testing.T) {
+	assert := assert.New(t)
+	header := make(http.Header)
+	assert.Empty(ParseVary(header))
+
+	header.Set("Vary", "accept-language, Accept-Encoding")
+	header.Add("Vary", "X-Device")
+	assert.Equal([]string{"Accept-Language", "X-Device"}, ParseVary(header))
+
+	header.Set("Vary", "Accept-Language, *")
+	assert.Equal([]string{"*"}, ParseVary(header))
+}
+
+func TestHTTPCacheVary(t *testing.T) {
+	assert := assert.New(t)
+	hc := NewHTTPCache()
+	zhHeader := make(http.Header)
+	zhHeader.Set("Accept-Language", "zh")
+	enHeader := make(http.Header)
+	enHeader.Set("Accept-Language", "en")
+
+	// 未有vary时返回其本身
+	assert.Equal(hc, hc.GetVariant(zhHeader))
+	status, _ := hc.Get()
+	assert.Equal(StatusFetching, status)
+
+	vary := []string{"Accept-Language"}
+	zh := hc.Vary(300, vary, zhHeader)
+	assert.NotEqual(hc, zh)
+	assert.Equal(StatusFetching, zh.GetStatus())
+	// variant的vary返回其本身
+	assert.Equal(zh, zh.Vary(300, vary, zhHeader))
+	zh.Cachable(300, &HTTPData{
+		RawBody: []byte("zh"),
+	})
+
+	assert.Equal(zh, hc.GetVariant(zhHeader))
+	en := hc.GetVariant(enHeader)
+	assert.NotEqual(zh, en)
+	status, _ = en.Get()
+	assert.Equal(StatusFetching, status)
+
+	status, data := hc.GetVariant(zhHeader).Get()
+	assert.Equal(StatusCacheable, status)
+	assert.Equal([]byte("zh"), data.RawBody)
+
+	// vary过期后，返回其本身
+	hc.expiredAt = 1
+	assert.Equal(hc, hc.GetVariant(zhHeader))
+
+	// 不再有vary的响应
+	hc.Cachable(300, &HTTPData{})
+	assert.Equal(hc, hc.GetVariant(zhHeader))
+}
+
 func TestHTTPCache(t *testing.T) {
 	t.Run("fetching", func(t *testing.T) {
 		assert := assert.New(t)
@@ -92,6 +230,32 @@ func TestHTTPCache(t *testing.T) {
 		assert.Nil(data)
 	})
 
+	t.Run("wait timeout", func(t *testing.T) {
+		assert := assert.New(t)
+		hc := NewHTTPCache()
+		status, _ := hc.Get()
+		assert.Equal(StatusFetching, status)
+
+		// 等待超时后从等待列表中删除
+		_, data, err := hc.GetWithTimeout(10 * time.Millisecond)
+		assert.Equal(ErrWaitTimeout, err)
+		assert.Nil(data)
+		assert.Equal(0, hc.Waiters())
+
+		done := make(chan bool)
+		go func() {
+			status, _, err := hc.GetWithTimeout(time.Second)
+			done <- err == nil && status == StatusHitForPass
+		}()
+		for hc.Waiters() == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		assert.Equal(1, hc.Waiters())
+		hc.HitForPass(300)
+		assert.True(<-done)
+		assert.Equal(0, hc.Waiters())
+	})
+
 	t.Run("cachable", func(t *testing.T) {
 		assert := assert.New(t)
 		hc := NewHTTPCache()
@@ -133,6 +297,75 @@ func TestHTTPCache(t *testing.T) {
 		assert.Nil(data)
 	})
 
+	t.Run("stale while revalidate", func(t *testing.T) {
+		assert := assert.New(t)
+		hc := NewHTTPCache()
+		status, _ := hc.Get()
+		assert.Equal(StatusFetching, status)
+		hc.SetStaleWhileRevalidate(10)
+		hc.Cachable(300, &HTTPData{
+			RawBody: []byte("raw body"),
+		})
+
+		// 过期但仍在stale-while-revalidate时间内
+		hc.expiredAt = int(time.Now().Unix()) - 1
+		assert.False(hc.IsExpired())
+		status, data := hc.Get()
+		assert.Equal(StatusStale, status)
+		assert.Equal([]byte("raw body"), data.RawBody)
+		assert.True(hc.Revalidate())
+		assert.False(hc.Revalidate())
+
+		// 刷新缓存后
+		hc.Cachable(300, &HTTPData{})
+		status, _ = hc.Get()
+		assert.Equal(StatusCacheable, status)
+		assert.True(hc.Revalidate())
+
+		// 超过stale-while-revalidate时间
+		hc.expiredAt = int(time.Now().Unix()) - 11
+		assert.True(hc.IsExpired())
+		status, _ = hc.Get()
+		assert.Equal(StatusFetching, status)
+	})
+
+	t.Run("fallback to stale", func(t *testing.T) {
+		assert := assert.New(t)
+		hc := NewHTTPCache()
+		_, _ = hc.Get()
+		// 无缓存数据
+		assert.Nil(hc.FallbackToStale())
+
+		hc.SetStaleIfError(10)
+		hc.Cachable(300, &HTTPData{
+			RawBody: []byte("raw body"),
+		})
+		hc.expiredAt = int(time.Now().Unix()) - 1
+		assert.False(hc.IsExpired())
+		status, _ := hc.Get()
+		assert.Equal(StatusFetching, status)
+
+		go func() {
+			time.Sleep(time.Millisecond)
+			data := hc.FallbackToStale()
+			assert.Equal([]byte("raw body"), data.RawBody)
+		}()
+		// 等待中的请求使用过期的数据
+		status, data := hc.Get()
+		assert.Equal(StatusCacheable, status)
+		assert.Equal([]byte("raw body"), data.RawBody)
+
+		// 超过stale-if-error时间
+		hc.expiredAt = int(time.Now().Unix()) - 11
+		assert.True(hc.IsExpired())
+		assert.Nil(hc.FallbackToStale())
+
+		// hit for pass之后不再有过期数据
+		hc.expiredAt = int(time.Now().Unix()) - 1
+		hc.HitForPass(300)
+		assert.Nil(hc.FallbackToStale())
+	})
+
 	t.Run("get age", func(t *testing.T) {
 		assert := assert.New(t)
 		age := 10
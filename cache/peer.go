@@ -0,0 +1,82 @@
+// Copyright 2020 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// 集群节点之间传输的http缓存，仅传输可缓存的数据（不包括vary的缓存）
+
+package cache
+
+import (
+	"encoding/gob"
+	"errors"
+	"io"
+)
+
+var (
+	// ErrHTTPCacheNotFound the cacheable http cache of key is not found
+	ErrHTTPCacheNotFound = errors.New("http cache is not found")
+	// ErrHTTPCacheExpired the http cache is expired or banned
+	ErrHTTPCacheExpired = errors.New("http cache is expired")
+	// ErrHTTPCacheIsVariant the variant http cache can't be filled
+	ErrHTTPCacheIsVariant = errors.New("http cache is variant")
+)
+
+// WriteHTTPCache write the cacheable http cache of key to writer,
+// ErrHTTPCacheNotFound will be returned if it isn't cacheable
+func (d *Dispatcher) WriteHTTPCache(w io.Writer, key string) error {
+	lru := d.getLRU([]byte(key))
+	lru.Lock()
+	hc, ok := lru.Get(key)
+	lru.Unlock()
+	if !ok {
+		return ErrHTTPCacheNotFound
+	}
+	item := hc.toCacheItem()
+	if item == nil || d.isBanned(key, hc.getCreatedNano()) {
+		return ErrHTTPCacheNotFound
+	}
+	return gob.NewEncoder(w).Encode(item)
+}
+
+// ReadHTTPCache read the http cache of key from reader and fill it to hc.
+// If hc is nil, the http cache of dispatcher is used, and it is not replaced by older data.
+func (d *Dispatcher) ReadHTTPCache(r io.Reader, key string, hc *HTTPCache) error {
+	item := &cacheItem{}
+	err := gob.NewDecoder(r).Decode(item)
+	if err != nil {
+		return err
+	}
+	if item.Data == nil {
+		return ErrHTTPCacheNotFound
+	}
+	tmp := NewHTTPCache()
+	tmp.restore(item)
+	if tmp.IsExpired() || d.isBanned(key, tmp.getCreatedNano()) {
+		return ErrHTTPCacheExpired
+	}
+	if hc == nil {
+		hc = d.GetHTTPCache([]byte(key))
+		// 已有更新的缓存则忽略
+		if current := hc.toCacheItem(); current != nil && current.CreatedAt >= item.CreatedAt {
+			return nil
+		}
+	}
+	if hc.IsVariant() {
+		return ErrHTTPCacheIsVariant
+	}
+	hc.fill(item)
+	if len(item.Tags) != 0 {
+		d.AddTags([]byte(key), item.Tags...)
+	}
+	return nil
+}
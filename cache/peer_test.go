@@ -0,0 +1,122 @@
+// Copyright 2020 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vicanso/pike/config"
+)
+
+func TestPeerHTTPCache(t *testing.T) {
+	key := "GET aslant.site /books/1"
+	newHTTPData := func(body string) *HTTPData {
+		return &HTTPData{
+			StatusCode: http.StatusOK,
+			RawBody:    []byte(body),
+		}
+	}
+
+	t.Run("write and read", func(t *testing.T) {
+		assert := assert.New(t)
+		d := NewDispatcher(&config.Cache{})
+		buf := new(bytes.Buffer)
+		assert.Equal(ErrHTTPCacheNotFound, d.WriteHTTPCache(buf, key))
+		// fetching的缓存不可获取
+		hc := d.GetHTTPCache([]byte(key))
+		assert.Equal(ErrHTTPCacheNotFound, d.WriteHTTPCache(buf, key))
+
+		hc.SetStaleIfError(30)
+		hc.Cachable(60, newHTTPData("book 1"))
+		d.AddTags([]byte(key), "books")
+		assert.Nil(d.WriteHTTPCache(buf, key))
+
+		nd := NewDispatcher(&config.Cache{})
+		nhc := nd.GetHTTPCache([]byte(key))
+		status, _ := nhc.Get()
+		assert.Equal(StatusFetching, status)
+		done := make(chan struct{})
+		// 等待中的请求获取填充的数据
+		go func() {
+			status, data := nhc.Get()
+			assert.Equal(StatusCacheable, status)
+			assert.Equal([]byte("book 1"), data.RawBody)
+			close(done)
+		}()
+		time.Sleep(10 * time.Millisecond)
+		assert.Nil(nd.ReadHTTPCache(buf, key, nhc))
+		<-done
+		assert.Equal(hc.CreatedAt(), nhc.CreatedAt())
+		assert.Equal(len("book 1"), nd.Stats().Bytes)
+		assert.Equal(1, nd.PurgeByTag("books"))
+	})
+
+	t.Run("read without http cache", func(t *testing.T) {
+		assert := assert.New(t)
+		d := NewDispatcher(&config.Cache{})
+		d.GetHTTPCache([]byte(key)).Cachable(60, newHTTPData("book 1"))
+		buf := new(bytes.Buffer)
+		assert.Nil(d.WriteHTTPCache(buf, key))
+
+		nd := NewDispatcher(&config.Cache{})
+		// 已有更新的缓存不会被替换
+		time.Sleep(time.Second)
+		nd.GetHTTPCache([]byte(key)).Cachable(60, newHTTPData("new book 1"))
+		assert.Nil(nd.ReadHTTPCache(bytes.NewReader(buf.Bytes()), key, nil))
+		_, data := nd.GetHTTPCache([]byte(key)).Get()
+		assert.Equal([]byte("new book 1"), data.RawBody)
+
+		nd = NewDispatcher(&config.Cache{})
+		assert.Nil(nd.ReadHTTPCache(bytes.NewReader(buf.Bytes()), key, nil))
+		status, data := nd.GetHTTPCache([]byte(key)).Get()
+		assert.Equal(StatusCacheable, status)
+		assert.Equal([]byte("book 1"), data.RawBody)
+	})
+
+	t.Run("read expired or banned", func(t *testing.T) {
+		assert := assert.New(t)
+		d := NewDispatcher(&config.Cache{})
+		d.GetHTTPCache([]byte(key)).Cachable(60, newHTTPData("book 1"))
+		buf := new(bytes.Buffer)
+		assert.Nil(d.WriteHTTPCache(buf, key))
+
+		nd := NewDispatcher(&config.Cache{})
+		assert.Nil(nd.Ban("", "^/books"))
+		assert.Equal(ErrHTTPCacheExpired, nd.ReadHTTPCache(buf, key, nil))
+
+		buf.Reset()
+		createdAt := int(time.Now().Unix()) - 120
+		assert.Nil(gob.NewEncoder(buf).Encode(&cacheItem{
+			CreatedAt: createdAt,
+			ExpiredAt: createdAt + 60,
+			Data:      newHTTPData("book 1"),
+		}))
+		assert.Equal(ErrHTTPCacheExpired, NewDispatcher(&config.Cache{}).ReadHTTPCache(buf, key, nil))
+	})
+
+	t.Run("read to variant", func(t *testing.T) {
+		assert := assert.New(t)
+		d := NewDispatcher(&config.Cache{})
+		d.GetHTTPCache([]byte(key)).Cachable(60, newHTTPData("book 1"))
+		buf := new(bytes.Buffer)
+		assert.Nil(d.WriteHTTPCache(buf, key))
+		assert.Equal(ErrHTTPCacheIsVariant, d.ReadHTTPCache(buf, key, newVariantHTTPCache()))
+	})
+}
@@ -0,0 +1,239 @@
+// Copyright 2020 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// 根据请求的Range从缓存数据中返回部分内容（206），
+// 支持单个与多个range（multipart/byteranges）以及If-Range
+
+package cache
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+
+	"github.com/vicanso/elton"
+)
+
+const (
+	// HeaderRange the range request header
+	HeaderRange   = "Range"
+	headerIfRange = "If-Range"
+
+	headerAcceptRanges = "Accept-Ranges"
+	headerContentRange = "Content-Range"
+
+	// 单个请求最多支持的range数量，避免过多的range导致响应数据过大
+	maxRanges = 16
+)
+
+var (
+	errInvalidRange = errors.New("invalid range")
+	errNoOverlap    = errors.New("invalid range: failed to overlap")
+)
+
+type httpRange struct {
+	start  int
+	length int
+}
+
+func (r httpRange) contentRange(size int) string {
+	return fmt.Sprintf("bytes %d-%d/%d", r.start, r.start+r.length-1, size)
+}
+
+// parseRange parse the Range header, the ranges which do not overlap the size are ignored,
+// and errNoOverlap will be returned if all ranges are ignored.
+func parseRange(s string, size int) ([]httpRange, error) {
+	const b = "bytes="
+	if !strings.HasPrefix(s, b) {
+		return nil, errInvalidRange
+	}
+	ranges := make([]httpRange, 0)
+	noOverlap := false
+	for _, ra := range strings.Split(s[len(b):], ",") {
+		ra = strings.TrimSpace(ra)
+		if ra == "" {
+			continue
+		}
+		i := strings.Index(ra, "-")
+		if i < 0 {
+			return nil, errInvalidRange
+		}
+		start, end := strings.TrimSpace(ra[:i]), strings.TrimSpace(ra[i+1:])
+		var r httpRange
+		if start == "" {
+			// 如果无开始位置，则表示获取最后N个字节，如-500
+			i, err := strconv.Atoi(end)
+			if err != nil || i < 0 {
+				return nil, errInvalidRange
+			}
+			if i == 0 {
+				noOverlap = true
+				continue
+			}
+			if i > size {
+				i = size
+			}
+			r.start = size - i
+			r.length = size - r.start
+		} else {
+			i, err := strconv.Atoi(start)
+			if err != nil || i < 0 {
+				return nil, errInvalidRange
+			}
+			if i >= size {
+				noOverlap = true
+				continue
+			}
+			r.start = i
+			if end == "" {
+				// 无结束位置，则表示获取至结尾，如500-
+				r.length = size - r.start
+			} else {
+				i, err := strconv.Atoi(end)
+				if err != nil || r.start > i {
+					return nil, errInvalidRange
+				}
+				if i >= size {
+					i = size - 1
+				}
+				r.length = i - r.start + 1
+			}
+		}
+		ranges = append(ranges, r)
+	}
+	if len(ranges) > maxRanges {
+		return nil, errInvalidRange
+	}
+	if noOverlap && len(ranges) == 0 {
+		return nil, errNoOverlap
+	}
+	return ranges, nil
+}
+
+// ifRangeMatch check the If-Range of request is match the response,
+// the etag is compared with strong comparison.
+func ifRangeMatch(ifRange string, header http.Header) bool {
+	if ifRange == "" {
+		return true
+	}
+	// etag
+	if strings.HasPrefix(ifRange, `"`) || strings.HasPrefix(ifRange, "W/") {
+		etag := header.Get(elton.HeaderETag)
+		return etag != "" && !strings.HasPrefix(etag, "W/") && etag == ifRange
+	}
+	lastModified := header.Get(elton.HeaderLastModified)
+	if lastModified == "" {
+		return false
+	}
+	t1, err := http.ParseTime(ifRange)
+	if err != nil {
+		return false
+	}
+	t2, err := http.ParseTime(lastModified)
+	if err != nil {
+		return false
+	}
+	return t1.Equal(t2)
+}
+
+// setRangeResponse set the partial content response if the request has Range header,
+// it returns false if the range should be ignored(the full content should be returned).
+func (httpData *HTTPData) setRangeResponse(c *elton.Context) bool {
+	rangeHeader := c.GetRequestHeader(HeaderRange)
+	if httpData.StatusCode != http.StatusOK || rangeHeader == "" {
+		return false
+	}
+	header := httpData.Header()
+	if !ifRangeMatch(c.GetRequestHeader(headerIfRange), header) {
+		return false
+	}
+	body, ok := httpData.getRawBody()
+	if !ok {
+		return false
+	}
+	size := len(body)
+	ranges, err := parseRange(rangeHeader, size)
+	if err == errNoOverlap {
+		httpData.setHeaders(c)
+		c.StatusCode = http.StatusRequestedRangeNotSatisfiable
+		c.SetHeader(headerContentRange, "bytes */"+strconv.Itoa(size))
+		c.SetHeader(elton.HeaderContentLength, "0")
+		c.SetHeader(elton.HeaderContentEncoding, "")
+		c.BodyBuffer = new(bytes.Buffer)
+		return true
+	}
+	if err != nil || len(ranges) == 0 {
+		return false
+	}
+	sendSize := 0
+	for _, ra := range ranges {
+		sendSize += ra.length
+	}
+	// 如果range的总长度大于数据长度，则直接返回完整数据
+	if sendSize > size {
+		return false
+	}
+
+	// 先生成响应数据，成功后才设置响应头，避免返回完整数据时响应头不匹配
+	var buf *bytes.Buffer
+	contentRange := ""
+	contentType := ""
+	if len(ranges) == 1 {
+		ra := ranges[0]
+		contentRange = ra.contentRange(size)
+		buf = bytes.NewBuffer(body[ra.start : ra.start+ra.length])
+	} else {
+		buf = new(bytes.Buffer)
+		w := multipart.NewWriter(buf)
+		partContentType := header.Get(elton.HeaderContentType)
+		for _, ra := range ranges {
+			partHeader := make(textproto.MIMEHeader)
+			if partContentType != "" {
+				partHeader.Set(elton.HeaderContentType, partContentType)
+			}
+			partHeader.Set(headerContentRange, ra.contentRange(size))
+			part, err := w.CreatePart(partHeader)
+			if err != nil {
+				return false
+			}
+			_, err = part.Write(body[ra.start : ra.start+ra.length])
+			if err != nil {
+				return false
+			}
+		}
+		err = w.Close()
+		if err != nil {
+			return false
+		}
+		contentType = "multipart/byteranges; boundary=" + w.Boundary()
+	}
+
+	httpData.setHeaders(c)
+	if contentRange != "" {
+		c.SetHeader(headerContentRange, contentRange)
+	}
+	if contentType != "" {
+		c.SetHeader(elton.HeaderContentType, contentType)
+	}
+	c.StatusCode = http.StatusPartialContent
+	c.SetHeader(elton.HeaderContentLength, strconv.Itoa(buf.Len()))
+	c.SetHeader(elton.HeaderContentEncoding, "")
+	c.BodyBuffer = buf
+	return true
+}
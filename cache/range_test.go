@@ -0,0 +1,241 @@
+// Copyright 2020 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vicanso/elton"
+	"github.com/vicanso/pike/util"
+)
+
+func TestParseRange(t *testing.T) {
+	assert := assert.New(t)
+	size := 10
+	tests := []struct {
+		value  string
+		ranges []httpRange
+		err    error
+	}{
+		{
+			value: "bytes=0-4",
+			ranges: []httpRange{
+				{start: 0, length: 5},
+			},
+		},
+		{
+			value: "bytes=5-",
+			ranges: []httpRange{
+				{start: 5, length: 5},
+			},
+		},
+		{
+			value: "bytes=-3",
+			ranges: []httpRange{
+				{start: 7, length: 3},
+			},
+		},
+		{
+			value: "bytes=-20",
+			ranges: []httpRange{
+				{start: 0, length: 10},
+			},
+		},
+		{
+			value: "bytes=8-20",
+			ranges: []httpRange{
+				{start: 8, length: 2},
+			},
+		},
+		{
+			value: "bytes=0-1, 4-5,20-30",
+			ranges: []httpRange{
+				{start: 0, length: 2},
+				{start: 4, length: 2},
+			},
+		},
+		{
+			value: "bytes=10-",
+			err:   errNoOverlap,
+		},
+		{
+			value: "bytes=-0",
+			err:   errNoOverlap,
+		},
+		{
+			value: "items=0-1",
+			err:   errInvalidRange,
+		},
+		{
+			value: "bytes=5-1",
+			err:   errInvalidRange,
+		},
+		{
+			value: "bytes=a-1",
+			err:   errInvalidRange,
+		},
+		{
+			value: "bytes=1",
+			err:   errInvalidRange,
+		},
+		{
+			value: "bytes=" + strings.Repeat("0-1,", maxRanges+1),
+			err:   errInvalidRange,
+		},
+	}
+	for _, tt := range tests {
+		ranges, err := parseRange(tt.value, size)
+		assert.Equal(tt.err, err, tt.value)
+		if tt.err == nil {
+			assert.Equal(tt.ranges, ranges, tt.value)
+		}
+	}
+	assert.Equal("bytes 0-4/10", httpRange{start: 0, length: 5}.contentRange(size))
+}
+
+func TestIfRangeMatch(t *testing.T) {
+	assert := assert.New(t)
+	lastModified := "Mon, 02 Jan 2006 15:04:05 GMT"
+	header := make(http.Header)
+	header.Set(elton.HeaderETag, `"123"`)
+	header.Set(elton.HeaderLastModified, lastModified)
+
+	assert.True(ifRangeMatch("", header))
+	assert.True(ifRangeMatch(`"123"`, header))
+	assert.False(ifRangeMatch(`"456"`, header))
+	assert.False(ifRangeMatch(`W/"123"`, header))
+	assert.True(ifRangeMatch(lastModified, header))
+	assert.False(ifRangeMatch("Mon, 02 Jan 2006 15:04:06 GMT", header))
+	assert.False(ifRangeMatch("abcd", header))
+
+	// 弱etag不可用于range请求
+	header.Set(elton.HeaderETag, `W/"123"`)
+	assert.False(ifRangeMatch(`W/"123"`, header))
+}
+
+func TestSetRangeResponse(t *testing.T) {
+	header := make(http.Header)
+	header.Set(elton.HeaderContentType, "text/plain")
+	header.Set(elton.HeaderETag, `"123"`)
+	body := []byte("0123456789")
+	newContext := func(rangeValue, ifRange string) *elton.Context {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set(elton.HeaderAcceptEncoding, "gzip")
+		req.Header.Set(HeaderRange, rangeValue)
+		req.Header.Set(headerIfRange, ifRange)
+		return elton.NewContext(httptest.NewRecorder(), req)
+	}
+
+	t.Run("single range", func(t *testing.T) {
+		assert := assert.New(t)
+		gzipBody, _ := util.Gzip(body, 0)
+		// 从gzip数据中解压
+		httpData := &HTTPData{
+			StatusCode: http.StatusOK,
+			Headers:    NewHTTPHeaders(header),
+			GzipBody:   gzipBody,
+		}
+		c := newContext("bytes=2-4", "")
+		httpData.SetResponse(c)
+		assert.Equal(http.StatusPartialContent, c.StatusCode)
+		assert.Equal("234", c.BodyBuffer.String())
+		assert.Equal("bytes 2-4/10", c.GetHeader(headerContentRange))
+		assert.Equal("3", c.GetHeader(elton.HeaderContentLength))
+		assert.Equal("bytes", c.GetHeader(headerAcceptRanges))
+		assert.Empty(c.GetHeader(elton.HeaderContentEncoding))
+	})
+
+	t.Run("multi range", func(t *testing.T) {
+		assert := assert.New(t)
+		httpData := &HTTPData{
+			StatusCode: http.StatusOK,
+			Headers:    NewHTTPHeaders(header),
+			RawBody:    body,
+		}
+		c := newContext("bytes=0-1,-2", `"123"`)
+		httpData.SetResponse(c)
+		assert.Equal(http.StatusPartialContent, c.StatusCode)
+		mediaType, params, err := mime.ParseMediaType(c.GetHeader(elton.HeaderContentType))
+		assert.Nil(err)
+		assert.Equal("multipart/byteranges", mediaType)
+
+		r := multipart.NewReader(c.BodyBuffer, params["boundary"])
+		expected := [][]string{
+			{"bytes 0-1/10", "01"},
+			{"bytes 8-9/10", "89"},
+		}
+		for _, item := range expected {
+			part, err := r.NextPart()
+			assert.Nil(err)
+			assert.Equal("text/plain", part.Header.Get(elton.HeaderContentType))
+			assert.Equal(item[0], part.Header.Get(headerContentRange))
+			buf, _ := ioutil.ReadAll(part)
+			assert.Equal(item[1], string(buf))
+		}
+		_, err = r.NextPart()
+		assert.NotNil(err)
+	})
+
+	t.Run("not satisfiable", func(t *testing.T) {
+		assert := assert.New(t)
+		httpData := &HTTPData{
+			StatusCode: http.StatusOK,
+			Headers:    NewHTTPHeaders(header),
+			RawBody:    body,
+		}
+		c := newContext("bytes=20-", "")
+		httpData.SetResponse(c)
+		assert.Equal(http.StatusRequestedRangeNotSatisfiable, c.StatusCode)
+		assert.Equal("bytes */10", c.GetHeader(headerContentRange))
+		assert.Equal(0, c.BodyBuffer.Len())
+	})
+
+	t.Run("full content", func(t *testing.T) {
+		assert := assert.New(t)
+		httpData := &HTTPData{
+			StatusCode: http.StatusOK,
+			Headers:    NewHTTPHeaders(header),
+			RawBody:    body,
+		}
+		// if-range不匹配、range无效或range总长度超出数据长度，均返回完整数据
+		for _, item := range [][]string{
+			{"bytes=0-1", `"456"`},
+			{"items=0-1", ""},
+			{"bytes=0-8,1-9", ""},
+		} {
+			c := newContext(item[0], item[1])
+			httpData.SetResponse(c)
+			assert.Equal(http.StatusOK, c.StatusCode)
+			assert.Equal(body, c.BodyBuffer.Bytes())
+			assert.Empty(c.GetHeader(headerContentRange))
+			assert.Equal("text/plain", c.GetHeader(elton.HeaderContentType))
+			assert.Equal("bytes", c.GetHeader(headerAcceptRanges))
+		}
+
+		// 非200的响应不支持range
+		httpData.StatusCode = http.StatusNotFound
+		c := newContext("bytes=0-1", "")
+		httpData.SetResponse(c)
+		assert.Equal(http.StatusNotFound, c.StatusCode)
+		assert.Empty(c.GetHeader(headerAcceptRanges))
+	})
+}
@@ -0,0 +1,242 @@
+// Copyright 2020 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// 缓存快照，将可缓存的http缓存保存至文件，
+// 程序重启时从快照中恢复，避免重启后大量请求转发至upstream
+
+package cache
+
+import (
+	"bufio"
+	"encoding/gob"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/vicanso/pike/log"
+	"go.uber.org/zap"
+)
+
+const (
+	snapshotVersion = 1
+)
+
+var (
+	errSnapshotVersion = errors.New("snapshot version is not supported")
+)
+
+type (
+	// snapshotHeader the header of snapshot, it's the first item of snapshot
+	snapshotHeader struct {
+		Version   int
+		CreatedAt int
+	}
+	// snapshotItem the http cache of snapshot
+	snapshotItem struct {
+		Key  string
+		Item *cacheItem
+		// 有vary的缓存保存其vary与各variant（Item不包括数据）
+		Vary     []string
+		Variants map[string]*cacheItem
+	}
+)
+
+// WriteSnapshot write the cacheable http caches to writer,
+// returns the count of written http caches
+func (d *Dispatcher) WriteSnapshot(w io.Writer) (count int, err error) {
+	bw := bufio.NewWriter(w)
+	enc := gob.NewEncoder(bw)
+	err = enc.Encode(&snapshotHeader{
+		Version:   snapshotVersion,
+		CreatedAt: int(time.Now().Unix()),
+	})
+	if err != nil {
+		return
+	}
+	for _, lruCache := range d.list {
+		lruCache.Lock()
+		items := lruCache.entries()
+		lruCache.Unlock()
+		// 按从旧至新的顺序保存，恢复时保持lru的顺序
+		for _, item := range items {
+			si := &snapshotItem{
+				Key:  item.key,
+				Item: item.value.toCacheItem(),
+			}
+			if si.Item == nil {
+				si.Item, si.Vary, si.Variants = item.value.toVariantItems()
+				if len(si.Variants) == 0 {
+					continue
+				}
+			}
+			err = enc.Encode(si)
+			if err != nil {
+				return
+			}
+			count++
+		}
+	}
+	err = bw.Flush()
+	return
+}
+
+// ReadSnapshot read the http caches from reader, the expired http cache
+// and the key which exists are ignored, returns the count of restored http caches
+func (d *Dispatcher) ReadSnapshot(r io.Reader) (count int, err error) {
+	dec := gob.NewDecoder(bufio.NewReader(r))
+	header := &snapshotHeader{}
+	err = dec.Decode(header)
+	if err != nil {
+		return
+	}
+	if header.Version != snapshotVersion {
+		err = errSnapshotVersion
+		return
+	}
+	for {
+		item := &snapshotItem{}
+		err = dec.Decode(item)
+		if err == io.EOF {
+			err = nil
+			return
+		}
+		if err != nil {
+			return
+		}
+		if item.Item == nil {
+			continue
+		}
+		hc := NewHTTPCache()
+		hc.counters = d.counters
+		switch {
+		case len(item.Variants) != 0:
+			hc.restoreVariants(item.Item, item.Vary, item.Variants)
+		case item.Item.Data != nil:
+			hc.restore(item.Item)
+		default:
+			continue
+		}
+		if hc.IsExpired() {
+			continue
+		}
+		if d.getLRU([]byte(item.Key)).attach(item.Key, hc) {
+			count++
+		}
+	}
+}
+
+// SaveSnapshot save the snapshot of http caches to file, the snapshot is written
+// to a temporary file first and then renamed, returns the count of saved http caches
+func (d *Dispatcher) SaveSnapshot(file string) (count int, err error) {
+	err = os.MkdirAll(filepath.Dir(file), 0755)
+	if err != nil {
+		return
+	}
+	tmpFile := file + ".tmp"
+	f, err := os.Create(tmpFile)
+	if err != nil {
+		return
+	}
+	count, err = d.WriteSnapshot(f)
+	closeErr := f.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmpFile)
+		return
+	}
+	err = os.Rename(tmpFile, file)
+	return
+}
+
+// LoadSnapshot load the http caches from snapshot file,
+// returns the count of restored http caches
+func (d *Dispatcher) LoadSnapshot(file string) (count int, err error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	return d.ReadSnapshot(f)
+}
+
+// SaveSnapshots save the snapshots of the dispatchers which have snapshot path,
+// the error is only logged
+func (ds *Dispatchers) SaveSnapshots() {
+	if ds == nil {
+		return
+	}
+	for name, d := range ds.dispatchers {
+		if d.SnapshotPath == "" {
+			continue
+		}
+		startedAt := time.Now()
+		count, err := d.SaveSnapshot(d.SnapshotPath)
+		if err != nil {
+			log.Default().Error("save cache snapshot fail",
+				zap.String("name", name),
+				zap.String("path", d.SnapshotPath),
+				zap.Error(err),
+			)
+			continue
+		}
+		log.Default().Info("save cache snapshot success",
+			zap.String("name", name),
+			zap.String("path", d.SnapshotPath),
+			zap.Int("count", count),
+			zap.Duration("use", time.Since(startedAt)),
+		)
+	}
+}
+
+// loadSnapshotOfPath load the snapshot if the dispatcher has snapshot path,
+// the snapshot which doesn't exist is ignored and the error is only logged
+func (d *Dispatcher) loadSnapshotOfPath(name string) {
+	if d.SnapshotPath == "" {
+		return
+	}
+	startedAt := time.Now()
+	count, err := d.LoadSnapshot(d.SnapshotPath)
+	if os.IsNotExist(err) {
+		return
+	}
+	if err != nil {
+		log.Default().Error("load cache snapshot fail",
+			zap.String("name", name),
+			zap.String("path", d.SnapshotPath),
+			zap.Error(err),
+		)
+		return
+	}
+	log.Default().Info("load cache snapshot success",
+		zap.String("name", name),
+		zap.String("path", d.SnapshotPath),
+		zap.Int("count", count),
+		zap.Duration("use", time.Since(startedAt)),
+	)
+}
+
+// LoadSnapshots load the snapshots of the dispatchers which have snapshot path,
+// the snapshot which doesn't exist is ignored and the error is only logged
+func (ds *Dispatchers) LoadSnapshots() {
+	if ds == nil {
+		return
+	}
+	for name, d := range ds.dispatchers {
+		d.loadSnapshotOfPath(name)
+	}
+}
@@ -0,0 +1,263 @@
+// Copyright 2020 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vicanso/pike/config"
+)
+
+func TestSnapshot(t *testing.T) {
+	newDispatcher := func() *Dispatcher {
+		return NewDispatcher(&config.Cache{
+			Zone: 10,
+			Size: 2,
+		})
+	}
+	newHTTPData := func(body string) *HTTPData {
+		header := make(http.Header)
+		header.Set("Content-Type", "text/plain")
+		return &HTTPData{
+			Headers:    NewHTTPHeaders(header),
+			StatusCode: http.StatusOK,
+			RawBody:    []byte(body),
+			GzipBody:   []byte("gzip " + body),
+			BrBody:     []byte("br " + body),
+		}
+	}
+
+	t.Run("write and read", func(t *testing.T) {
+		assert := assert.New(t)
+		d := newDispatcher()
+		d.GetHTTPCache([]byte("GET aslant.site /books/1")).Cachable(60, newHTTPData("book 1"))
+		d.GetHTTPCache([]byte("GET aslant.site /books/2")).Cachable(60, newHTTPData("book 2"))
+		d.AddTags([]byte("GET aslant.site /books/2"), "books")
+		// hit for pass与fetching的缓存不保存
+		d.GetHTTPCache([]byte("GET aslant.site /users/me")).HitForPass(60)
+		d.GetHTTPCache([]byte("GET aslant.site /fetching"))
+
+		buf := new(bytes.Buffer)
+		count, err := d.WriteSnapshot(buf)
+		assert.Nil(err)
+		assert.Equal(2, count)
+
+		nd := newDispatcher()
+		// 已存在的缓存不会被覆盖
+		nd.GetHTTPCache([]byte("GET aslant.site /books/1")).Cachable(60, newHTTPData("new book 1"))
+		count, err = nd.ReadSnapshot(buf)
+		assert.Nil(err)
+		assert.Equal(1, count)
+
+		status, data := nd.GetHTTPCache([]byte("GET aslant.site /books/1")).Get()
+		assert.Equal(StatusCacheable, status)
+		assert.Equal([]byte("new book 1"), data.RawBody)
+
+		hc := nd.GetHTTPCache([]byte("GET aslant.site /books/2"))
+		status, data = hc.Get()
+		assert.Equal(StatusCacheable, status)
+		assert.Equal(http.StatusOK, data.StatusCode)
+		assert.Equal("text/plain", data.Header().Get("Content-Type"))
+		assert.Equal([]byte("book 2"), data.RawBody)
+		assert.Equal([]byte("gzip book 2"), data.GzipBody)
+		assert.Equal([]byte("br book 2"), data.BrBody)
+		assert.True(hc.Age() < 2)
+		assert.Equal(1, nd.PurgeByTag("books"))
+
+		stats := nd.Stats()
+		assert.Equal(1, stats.Entries)
+		assert.Equal(newHTTPData("new book 1").Size(), stats.Bytes)
+	})
+
+	t.Run("vary", func(t *testing.T) {
+		assert := assert.New(t)
+		d := newDispatcher()
+		key := []byte("GET aslant.site /books")
+		vary := []string{"Accept-Language"}
+		zhHeader := make(http.Header)
+		zhHeader.Set("Accept-Language", "zh")
+		enHeader := make(http.Header)
+		enHeader.Set("Accept-Language", "en")
+		frHeader := make(http.Header)
+		frHeader.Set("Accept-Language", "fr")
+		hc := d.GetHTTPCache(key)
+		hc.Vary(60, vary, zhHeader).Cachable(60, newHTTPData("zh books"))
+		hc.GetVariant(enHeader).Cachable(60, newHTTPData("en books"))
+		// hit for pass的variant不保存
+		hc.GetVariant(frHeader).HitForPass(60)
+		// 没有可缓存variant的不保存
+		d.GetHTTPCache([]byte("GET aslant.site /users")).Vary(60, vary, zhHeader).HitForPass(60)
+
+		buf := new(bytes.Buffer)
+		count, err := d.WriteSnapshot(buf)
+		assert.Nil(err)
+		assert.Equal(1, count)
+
+		nd := NewDispatcher(&config.Cache{
+			Zone:    10,
+			Size:    2,
+			Storage: config.StorageArena,
+		})
+		defer nd.Close()
+		count, err = nd.ReadSnapshot(buf)
+		assert.Nil(err)
+		assert.Equal(1, count)
+
+		nhc := nd.GetHTTPCache(key)
+		assert.Equal(StatusHitForPass, nhc.GetStatus())
+		status, data := nhc.GetVariant(zhHeader).Get()
+		assert.Equal(StatusCacheable, status)
+		assert.Equal([]byte("zh books"), data.RawBody)
+		status, data = nhc.GetVariant(enHeader).Get()
+		assert.Equal(StatusCacheable, status)
+		assert.Equal([]byte("en books"), data.RawBody)
+		// variant的数据保存在arena中，并计算其占用的字节数
+		variant := nhc.GetVariant(enHeader)
+		assert.NotEqual(int32(0), variant.ref.length)
+		assert.Equal(nhc.Size(), nd.Stats().Bytes)
+		assert.True(nd.Stats().Bytes > 0)
+
+		assert.NotEqual(StatusCacheable, nhc.GetVariant(frHeader).GetStatus())
+	})
+
+	t.Run("skip expired", func(t *testing.T) {
+		assert := assert.New(t)
+		now := int(time.Now().Unix())
+		buf := new(bytes.Buffer)
+		enc := gob.NewEncoder(buf)
+		assert.Nil(enc.Encode(&snapshotHeader{
+			Version:   snapshotVersion,
+			CreatedAt: now,
+		}))
+		assert.Nil(enc.Encode(&snapshotItem{
+			Key: "GET aslant.site /expired",
+			Item: &cacheItem{
+				CreatedAt: now - 120,
+				ExpiredAt: now - 60,
+				Data:      newHTTPData("expired"),
+			},
+		}))
+		// 已过期但仍在stale-if-error时间内
+		assert.Nil(enc.Encode(&snapshotItem{
+			Key: "GET aslant.site /stale",
+			Item: &cacheItem{
+				CreatedAt:    now - 120,
+				ExpiredAt:    now - 60,
+				StaleIfError: 600,
+				Data:         newHTTPData("stale"),
+			},
+		}))
+
+		d := newDispatcher()
+		count, err := d.ReadSnapshot(buf)
+		assert.Nil(err)
+		assert.Equal(1, count)
+		assert.Nil(d.Inspect("GET aslant.site /expired", false))
+		assert.NotNil(d.Inspect("GET aslant.site /stale", false))
+	})
+
+	t.Run("invalid version", func(t *testing.T) {
+		assert := assert.New(t)
+		buf := new(bytes.Buffer)
+		assert.Nil(gob.NewEncoder(buf).Encode(&snapshotHeader{
+			Version: snapshotVersion + 1,
+		}))
+		_, err := newDispatcher().ReadSnapshot(buf)
+		assert.Equal(errSnapshotVersion, err)
+	})
+
+	t.Run("save and load", func(t *testing.T) {
+		assert := assert.New(t)
+		dir, err := ioutil.TempDir("", "pike-snapshot")
+		assert.Nil(err)
+		defer os.RemoveAll(dir)
+		file := filepath.Join(dir, "caches", "a.snapshot")
+
+		ds := NewDispatchers(config.Caches{
+			&config.Cache{
+				Name:         "a",
+				SnapshotPath: file,
+			},
+		})
+		// 快照不存在时忽略
+		ds.LoadSnapshots()
+		ds.Get("a").GetHTTPCache([]byte("GET aslant.site /books/1")).Cachable(60, newHTTPData("book 1"))
+		ds.SaveSnapshots()
+		_, err = os.Stat(file + ".tmp")
+		assert.True(os.IsNotExist(err))
+
+		nds := NewDispatchers(config.Caches{
+			&config.Cache{
+				Name:         "a",
+				SnapshotPath: file,
+			},
+		})
+		nds.LoadSnapshots()
+		assert.Equal(1, nds.Get("a").Stats().Entries)
+
+		_, err = nds.Get("a").LoadSnapshot(filepath.Join(dir, "b.snapshot"))
+		assert.True(os.IsNotExist(err))
+	})
+
+	t.Run("load by reload", func(t *testing.T) {
+		assert := assert.New(t)
+		dir, err := ioutil.TempDir("", "pike-snapshot")
+		assert.Nil(err)
+		defer os.RemoveAll(dir)
+		fileA := filepath.Join(dir, "a.snapshot")
+		fileB := filepath.Join(dir, "b.snapshot")
+		for _, file := range []string{fileA, fileB} {
+			d := newDispatcher()
+			d.GetHTTPCache([]byte("GET aslant.site /books/1")).Cachable(60, newHTTPData("book 1"))
+			_, err = d.SaveSnapshot(file)
+			assert.Nil(err)
+		}
+
+		// 首次加载从快照中恢复
+		var ds *Dispatchers
+		ds = ds.Reload(config.Caches{
+			&config.Cache{
+				Name:         "a",
+				SnapshotPath: fileA,
+			},
+		})
+		assert.Equal(1, ds.Get("a").Stats().Entries)
+		ds.Get("a").Purge("GET aslant.site /books/1")
+
+		// 新增的缓存从快照中恢复，已有的不再重新加载
+		ds = ds.Reload(config.Caches{
+			&config.Cache{
+				Name:         "a",
+				SnapshotPath: fileA,
+			},
+			&config.Cache{
+				Name:         "b",
+				SnapshotPath: fileB,
+			},
+		})
+		assert.Equal(0, ds.Get("a").Stats().Entries)
+		assert.Equal(1, ds.Get("b").Stats().Entries)
+		ds.CloseStale()
+		ds.Close()
+	})
+}
@@ -0,0 +1,476 @@
+// Copyright 2020 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cluster shares the http caches between pike nodes.
+// Each key is owned by one node of the consistent hash ring, the other nodes
+// get the http cache from the owner before fetching from upstream,
+// and push the http cache which is fetched from upstream to the owner.
+package cluster
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vicanso/pike/cache"
+	"github.com/vicanso/pike/log"
+	"go.uber.org/zap"
+)
+
+const (
+	// PeerPath the path prefix of peer request
+	PeerPath = "/pike-peer/caches/"
+	// HeaderToken the header of peer token
+	HeaderToken = "X-Pike-Peer-Token"
+
+	defaultTimeout = time.Second
+	// 节点的心跳间隔，超过三个间隔未刷新的节点则认为已下线
+	heartbeatInterval = 10 * time.Second
+	nodeTTL           = 3 * heartbeatInterval
+	// 请求节点失败后，在此时间内不再请求该节点
+	failBackoff = 10 * time.Second
+)
+
+type (
+	// Registry the registry of nodes
+	Registry interface {
+		// RegisterNode register the node(or refresh it)
+		RegisterNode(addr string) error
+		// UnregisterNode unregister the node
+		UnregisterNode(addr string) error
+		// GetNodes get the nodes which are refreshed in ttl
+		GetNodes(ttl time.Duration) ([]string, error)
+	}
+	// Options the options of cluster
+	Options struct {
+		// Addr the listen address of peer server
+		Addr string
+		// Self the address of current node which other nodes can access
+		Self string
+		// Peers the static addresses of nodes
+		Peers []string
+		// Replicas the virtual nodes of each node in the hash ring
+		Replicas int
+		// Timeout the timeout of peer request
+		Timeout time.Duration
+		// Token the token of peer request, all peer requests are rejected if it is empty
+		Token string
+		// Registry the registry of nodes, current node isn't registered if it is nil
+		Registry Registry
+	}
+	// Cluster the cluster of pike nodes
+	Cluster struct {
+		opts   Options
+		client *http.Client
+		server *http.Server
+		done   chan struct{}
+
+		mu          sync.RWMutex
+		ring        *Ring
+		dispatchers *cache.Dispatchers
+		// 集群节点的ip，仅接受这些ip推送的缓存
+		memberIPs map[string]bool
+		// 请求失败的节点及其失败时间
+		failures map[string]time.Time
+	}
+	// Peer the peer of cache, it gets and pushes the http cache of the owner node
+	Peer struct {
+		cluster    *Cluster
+		name       string
+		dispatcher *cache.Dispatcher
+	}
+)
+
+// New new a cluster, the static peers and current node are added to the ring
+func New(opts Options) *Cluster {
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	c := &Cluster{
+		opts: opts,
+		client: &http.Client{
+			Timeout: timeout,
+		},
+		done:     make(chan struct{}),
+		failures: make(map[string]time.Time),
+	}
+	c.SetNodes(opts.Peers...)
+	return c
+}
+
+// SetNodes set the nodes of ring, current node is always included
+func (c *Cluster) SetNodes(nodes ...string) {
+	ring := NewRing(c.opts.Replicas, append([]string{c.opts.Self}, nodes...)...)
+	memberIPs := resolveIPs(ring.Nodes())
+	c.mu.Lock()
+	prev := c.ring
+	c.ring = ring
+	c.memberIPs = memberIPs
+	c.mu.Unlock()
+	if prev != nil && strings.Join(prev.Nodes(), ",") != strings.Join(ring.Nodes(), ",") {
+		log.Default().Info("cluster nodes change",
+			zap.Strings("nodes", ring.Nodes()),
+		)
+	}
+}
+
+// resolveIPs get the ips of nodes, the host of node is resolved if it isn't ip
+func resolveIPs(nodes []string) map[string]bool {
+	ips := make(map[string]bool)
+	for _, node := range nodes {
+		host, _, err := net.SplitHostPort(node)
+		if err != nil {
+			continue
+		}
+		if ip := net.ParseIP(host); ip != nil {
+			ips[ip.String()] = true
+			continue
+		}
+		addrs, err := net.LookupHost(host)
+		if err != nil {
+			log.Default().Warn("resolve cluster node fail",
+				zap.String("node", node),
+				zap.Error(err),
+			)
+			continue
+		}
+		for _, addr := range addrs {
+			if ip := net.ParseIP(addr); ip != nil {
+				ips[ip.String()] = true
+			}
+		}
+	}
+	return ips
+}
+
+// isMember check the remote address of request is the node of cluster
+func (c *Cluster) isMember(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.memberIPs[ip.String()]
+}
+
+// validToken check the token of request, the tokens are compared in constant time
+// (by their digests, so the length of token isn't leaked)
+func (c *Cluster) validToken(token string) bool {
+	if c.opts.Token == "" {
+		return false
+	}
+	expected := sha256.Sum256([]byte(c.opts.Token))
+	actual := sha256.Sum256([]byte(token))
+	return subtle.ConstantTimeCompare(expected[:], actual[:]) == 1
+}
+
+// Nodes get the nodes of cluster
+func (c *Cluster) Nodes() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.ring.Nodes()
+}
+
+// Owner get the owner node of key, self is true if the owner is current node
+func (c *Cluster) Owner(key string) (addr string, self bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	addr = c.ring.Get(key)
+	return addr, addr == c.opts.Self
+}
+
+// SetDispatchers set the dispatchers of peer server
+func (c *Cluster) SetDispatchers(dispatchers *cache.Dispatchers) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.dispatchers = dispatchers
+}
+
+func (c *Cluster) getDispatcher(name string) *cache.Dispatcher {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.dispatchers == nil {
+		return nil
+	}
+	return c.dispatchers.Get(name)
+}
+
+// available check the node is available(not failed recently)
+func (c *Cluster) available(addr string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	failedAt, ok := c.failures[addr]
+	return !ok || time.Since(failedAt) > failBackoff
+}
+
+// setFailure record the failure of node
+func (c *Cluster) setFailure(addr string, err error) {
+	c.mu.Lock()
+	c.failures[addr] = time.Now()
+	c.mu.Unlock()
+	log.Default().Warn("request peer fail",
+		zap.String("addr", addr),
+		zap.Error(err),
+	)
+}
+
+// Refresh register current node and refresh the nodes of ring
+func (c *Cluster) Refresh() error {
+	nodes := c.opts.Peers
+	registry := c.opts.Registry
+	if registry != nil {
+		err := registry.RegisterNode(c.opts.Self)
+		if err != nil {
+			return err
+		}
+		registered, err := registry.GetNodes(nodeTTL)
+		if err != nil {
+			return err
+		}
+		nodes = append(registered, nodes...)
+	}
+	c.SetNodes(nodes...)
+	return nil
+}
+
+// Start start the peer server and refresh the nodes periodically
+func (c *Cluster) Start() {
+	c.server = &http.Server{
+		Addr:    c.opts.Addr,
+		Handler: c,
+	}
+	go func() {
+		log.Default().Info("peer server listening",
+			zap.String("addr", c.opts.Addr),
+		)
+		err := c.server.ListenAndServe()
+		if err != nil && err != http.ErrServerClosed {
+			log.Default().Error("peer server listen fail",
+				zap.String("addr", c.opts.Addr),
+				zap.Error(err),
+			)
+		}
+	}()
+	go func() {
+		ticker := time.NewTicker(heartbeatInterval)
+		defer ticker.Stop()
+		for {
+			err := c.Refresh()
+			if err != nil {
+				log.Default().Error("refresh cluster nodes fail",
+					zap.Error(err),
+				)
+			}
+			select {
+			case <-c.done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Close close the peer server and unregister current node
+func (c *Cluster) Close() (err error) {
+	close(c.done)
+	if c.server != nil {
+		err = c.server.Close()
+	}
+	if c.opts.Registry != nil {
+		unregisterErr := c.opts.Registry.UnregisterNode(c.opts.Self)
+		if err == nil {
+			err = unregisterErr
+		}
+	}
+	return
+}
+
+// newRequest new a peer request of the http cache
+func (c *Cluster) newRequest(method, addr, name, key string, body io.Reader) (*http.Request, error) {
+	uri := "http://" + addr + PeerPath + url.PathEscape(name) + "?key=" + url.QueryEscape(key)
+	req, err := http.NewRequest(method, uri, body)
+	if err != nil {
+		return nil, err
+	}
+	if c.opts.Token != "" {
+		req.Header.Set(HeaderToken, c.opts.Token)
+	}
+	return req, nil
+}
+
+// do do the peer request, the failure of node is recorded if it fails
+func (c *Cluster) do(addr string, req *http.Request) (*http.Response, error) {
+	resp, err := c.client.Do(req)
+	if err == nil && resp.StatusCode >= http.StatusInternalServerError {
+		resp.Body.Close()
+		err = errors.New("status:" + resp.Status)
+	}
+	if err != nil {
+		c.setFailure(addr, err)
+		return nil, err
+	}
+	return resp, nil
+}
+
+// get get the http cache of key from node and fill it to hc
+func (c *Cluster) get(addr, name, key string, dispatcher *cache.Dispatcher, hc *cache.HTTPCache) error {
+	req, err := c.newRequest(http.MethodGet, addr, name, key, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.do(addr, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return cache.ErrHTTPCacheNotFound
+	}
+	return dispatcher.ReadHTTPCache(resp.Body, key, hc)
+}
+
+// put put the http cache of key to node
+func (c *Cluster) put(addr, name, key string, body io.Reader) error {
+	req, err := c.newRequest(http.MethodPut, addr, name, key, body)
+	if err != nil {
+		return err
+	}
+	resp, err := c.do(addr, req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		return errors.New("status:" + resp.Status)
+	}
+	return nil
+}
+
+// ServeHTTP serve the peer request, GET returns the http cache of key(404 if not found)
+// and PUT saves the http cache of key(only the nodes of cluster can put)
+func (c *Cluster) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if !c.validToken(req.Header.Get(HeaderToken)) {
+		http.Error(w, "token is invalid", http.StatusForbidden)
+		return
+	}
+	if !strings.HasPrefix(req.URL.Path, PeerPath) {
+		http.NotFound(w, req)
+		return
+	}
+	name := req.URL.Path[len(PeerPath):]
+	key := req.URL.Query().Get("key")
+	dispatcher := c.getDispatcher(name)
+	if dispatcher == nil || key == "" {
+		http.NotFound(w, req)
+		return
+	}
+	switch req.Method {
+	case http.MethodGet:
+		buf := new(bytes.Buffer)
+		err := dispatcher.WriteHTTPCache(buf, key)
+		if err == cache.ErrHTTPCacheNotFound {
+			http.NotFound(w, req)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		_, _ = w.Write(buf.Bytes())
+	case http.MethodPut:
+		if !c.isMember(req.RemoteAddr) {
+			http.Error(w, "node is not the member of cluster", http.StatusForbidden)
+			return
+		}
+		err := dispatcher.ReadHTTPCache(req.Body, key, nil)
+		// 过期的缓存直接忽略
+		if err != nil && err != cache.ErrHTTPCacheExpired {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "method is not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// Peer get the peer of cache, returns nil if the cluster or dispatcher is nil
+func (c *Cluster) Peer(name string, dispatcher *cache.Dispatcher) *Peer {
+	if c == nil || dispatcher == nil {
+		return nil
+	}
+	return &Peer{
+		cluster:    c,
+		name:       name,
+		dispatcher: dispatcher,
+	}
+}
+
+// Fill get the http cache of key from the owner node and fill it to hc,
+// returns false if current node is the owner or the http cache isn't got
+func (p *Peer) Fill(key string, hc *cache.HTTPCache) bool {
+	if p == nil || hc.IsVariant() {
+		return false
+	}
+	c := p.cluster
+	addr, self := c.Owner(key)
+	if self || addr == "" || !c.available(addr) {
+		return false
+	}
+	err := c.get(addr, p.name, key, p.dispatcher, hc)
+	return err == nil
+}
+
+// Push push the http cache of key to the owner node in background
+func (p *Peer) Push(key string) {
+	if p == nil {
+		return
+	}
+	c := p.cluster
+	addr, self := c.Owner(key)
+	if self || addr == "" || !c.available(addr) {
+		return
+	}
+	go func() {
+		buf := new(bytes.Buffer)
+		// 不可缓存（如有vary）的则不推送
+		if p.dispatcher.WriteHTTPCache(buf, key) != nil {
+			return
+		}
+		err := c.put(addr, p.name, key, buf)
+		if err != nil {
+			log.Default().Warn("push http cache to peer fail",
+				zap.String("addr", addr),
+				zap.String("name", p.name),
+				zap.String("key", key),
+				zap.Error(err),
+			)
+		}
+	}()
+}
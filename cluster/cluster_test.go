@@ -0,0 +1,294 @@
+// Copyright 2020 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vicanso/pike/cache"
+	"github.com/vicanso/pike/config"
+)
+
+type testRegistry struct {
+	nodes []string
+	err   error
+}
+
+func (r *testRegistry) RegisterNode(addr string) error {
+	if r.err != nil {
+		return r.err
+	}
+	r.nodes = append(r.nodes, addr)
+	return nil
+}
+
+func (r *testRegistry) UnregisterNode(addr string) error {
+	nodes := make([]string, 0)
+	for _, node := range r.nodes {
+		if node != addr {
+			nodes = append(nodes, node)
+		}
+	}
+	r.nodes = nodes
+	return nil
+}
+
+func (r *testRegistry) GetNodes(_ time.Duration) ([]string, error) {
+	return r.nodes, nil
+}
+
+func newTestDispatchers() *cache.Dispatchers {
+	return cache.NewDispatchers(config.Caches{
+		{
+			Name: "default",
+		},
+	})
+}
+
+// newTestCluster new a cluster which is served by http test server
+func newTestCluster(token string) (*Cluster, *httptest.Server) {
+	var c *Cluster
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		c.ServeHTTP(w, req)
+	}))
+	c = New(Options{
+		Self:  strings.TrimPrefix(ts.URL, "http://"),
+		Token: token,
+	})
+	c.SetDispatchers(newTestDispatchers())
+	return c, ts
+}
+
+// getOwnedKey get the key(has the prefix) which is owned by the node
+func getOwnedKey(c *Cluster, node, prefix string) string {
+	for i := 0; ; i++ {
+		key := prefix + strconv.Itoa(i)
+		if addr, _ := c.Owner(key); addr == node {
+			return key
+		}
+	}
+}
+
+func TestCluster(t *testing.T) {
+	assert := assert.New(t)
+	registry := &testRegistry{}
+	c := New(Options{
+		Self:     "192.168.1.1:3016",
+		Peers:    []string{"192.168.1.2:3016"},
+		Registry: registry,
+	})
+	assert.Equal([]string{"192.168.1.1:3016", "192.168.1.2:3016"}, c.Nodes())
+	key := getOwnedKey(c, "192.168.1.1:3016", "GET aslant.site /books/")
+	addr, self := c.Owner(key)
+	assert.Equal("192.168.1.1:3016", addr)
+	assert.True(self)
+
+	registry.nodes = []string{"192.168.1.3:3016"}
+	assert.Nil(c.Refresh())
+	assert.Equal([]string{"192.168.1.1:3016", "192.168.1.2:3016", "192.168.1.3:3016"}, c.Nodes())
+	assert.Nil(c.Close())
+	assert.Equal([]string{"192.168.1.3:3016"}, registry.nodes)
+
+	registry.err = errors.New("register fail")
+	assert.Equal(registry.err, c.Refresh())
+
+	assert.Nil((*Cluster)(nil).Peer("default", nil))
+	assert.Nil(c.Peer("default", nil))
+}
+
+func TestServeHTTP(t *testing.T) {
+	assert := assert.New(t)
+	c, ts := newTestCluster("token")
+	defer ts.Close()
+	key := "GET aslant.site /books/1"
+	uri := PeerPath + "default?key=" + url.QueryEscape(key)
+
+	req := httptest.NewRequest(http.MethodGet, uri, nil)
+	resp := httptest.NewRecorder()
+	c.ServeHTTP(resp, req)
+	assert.Equal(http.StatusForbidden, resp.Code)
+
+	// token不一致
+	req.Header.Set(HeaderToken, "tokens")
+	resp = httptest.NewRecorder()
+	c.ServeHTTP(resp, req)
+	assert.Equal(http.StatusForbidden, resp.Code)
+
+	for _, tt := range []struct {
+		method     string
+		uri        string
+		remoteAddr string
+		statusCode int
+	}{
+		{
+			method:     http.MethodGet,
+			uri:        "/books",
+			statusCode: http.StatusNotFound,
+		},
+		{
+			method:     http.MethodGet,
+			uri:        PeerPath + "notfound?key=" + url.QueryEscape(key),
+			statusCode: http.StatusNotFound,
+		},
+		{
+			method:     http.MethodGet,
+			uri:        uri,
+			statusCode: http.StatusNotFound,
+		},
+		{
+			method:     http.MethodPut,
+			uri:        uri,
+			statusCode: http.StatusBadRequest,
+		},
+		// 非集群节点不可推送缓存
+		{
+			method:     http.MethodPut,
+			uri:        uri,
+			remoteAddr: "192.168.1.10:3016",
+			statusCode: http.StatusForbidden,
+		},
+		{
+			method:     http.MethodDelete,
+			uri:        uri,
+			statusCode: http.StatusMethodNotAllowed,
+		},
+	} {
+		req := httptest.NewRequest(tt.method, tt.uri, strings.NewReader("a"))
+		req.Header.Set(HeaderToken, "token")
+		req.RemoteAddr = "127.0.0.1:3016"
+		if tt.remoteAddr != "" {
+			req.RemoteAddr = tt.remoteAddr
+		}
+		resp := httptest.NewRecorder()
+		c.ServeHTTP(resp, req)
+		assert.Equal(tt.statusCode, resp.Code, tt.method+" "+tt.uri)
+	}
+
+	c.getDispatcher("default").GetHTTPCache([]byte(key)).Cachable(60, &cache.HTTPData{
+		StatusCode: http.StatusOK,
+		RawBody:    []byte("book 1"),
+	})
+	req = httptest.NewRequest(http.MethodGet, uri, nil)
+	req.Header.Set(HeaderToken, "token")
+	resp = httptest.NewRecorder()
+	c.ServeHTTP(resp, req)
+	assert.Equal(http.StatusOK, resp.Code)
+	assert.NotEmpty(resp.Body.Bytes())
+
+	// 未配置token时拒绝所有请求
+	c, ts = newTestCluster("")
+	defer ts.Close()
+	req = httptest.NewRequest(http.MethodGet, uri, nil)
+	resp = httptest.NewRecorder()
+	c.ServeHTTP(resp, req)
+	assert.Equal(http.StatusForbidden, resp.Code)
+}
+
+func TestIsMember(t *testing.T) {
+	assert := assert.New(t)
+	c := New(Options{
+		Self:  "192.168.1.1:3016",
+		Peers: []string{"192.168.1.2:3016", "localhost:3016"},
+	})
+	assert.True(c.isMember("192.168.1.1:51234"))
+	assert.True(c.isMember("192.168.1.2:51234"))
+	assert.True(c.isMember("127.0.0.1:51234"))
+	assert.False(c.isMember("192.168.1.3:51234"))
+	assert.False(c.isMember("invalid"))
+
+	// 节点变化后更新
+	c.SetNodes("192.168.1.3:3016")
+	assert.True(c.isMember("192.168.1.3:51234"))
+	assert.False(c.isMember("192.168.1.2:51234"))
+}
+
+func TestPeer(t *testing.T) {
+	owner, ts := newTestCluster("token")
+	defer ts.Close()
+	ownerAddr := owner.opts.Self
+	ownerDispatcher := owner.getDispatcher("default")
+
+	c := New(Options{
+		Self:  "127.0.0.1:1",
+		Peers: []string{ownerAddr},
+		Token: "token",
+	})
+	dispatcher := newTestDispatchers().Get("default")
+	peer := c.Peer("default", dispatcher)
+	key := getOwnedKey(c, ownerAddr, "GET aslant.site /books/")
+	newHTTPData := func(body string) *cache.HTTPData {
+		return &cache.HTTPData{
+			StatusCode: http.StatusOK,
+			RawBody:    []byte(body),
+		}
+	}
+
+	t.Run("fill", func(t *testing.T) {
+		assert := assert.New(t)
+		hc := dispatcher.GetHTTPCache([]byte(key))
+		// owner未有缓存
+		assert.False(peer.Fill(key, hc))
+
+		ownerDispatcher.GetHTTPCache([]byte(key)).Cachable(60, newHTTPData("book 1"))
+		assert.True(peer.Fill(key, hc))
+		status, data := hc.Get()
+		assert.Equal(cache.StatusCacheable, status)
+		assert.Equal([]byte("book 1"), data.RawBody)
+
+		// 当前节点所属的key不从其它节点获取
+		selfKey := getOwnedKey(c, "127.0.0.1:1", "GET aslant.site /books/")
+		assert.False(peer.Fill(selfKey, dispatcher.GetHTTPCache([]byte(selfKey))))
+		assert.False((*Peer)(nil).Fill(key, hc))
+	})
+
+	t.Run("push", func(t *testing.T) {
+		assert := assert.New(t)
+		pushKey := getOwnedKey(c, ownerAddr, "GET aslant.site /push/")
+		dispatcher.GetHTTPCache([]byte(pushKey)).Cachable(60, newHTTPData("book push"))
+		peer.Push(pushKey)
+		var data *cache.HTTPData
+		for i := 0; i < 100; i++ {
+			time.Sleep(10 * time.Millisecond)
+			if ownerDispatcher.Inspect(pushKey, false) != nil {
+				_, data = ownerDispatcher.GetHTTPCache([]byte(pushKey)).Get()
+				break
+			}
+		}
+		assert.NotNil(data)
+		assert.Equal([]byte("book push"), data.RawBody)
+	})
+
+	t.Run("fail", func(t *testing.T) {
+		assert := assert.New(t)
+		c := New(Options{
+			Self:    "127.0.0.1:1",
+			Peers:   []string{"127.0.0.1:2"},
+			Timeout: 100 * time.Millisecond,
+		})
+		peer := c.Peer("default", dispatcher)
+		key := getOwnedKey(c, "127.0.0.1:2", "GET aslant.site /books/")
+		assert.False(peer.Fill(key, dispatcher.GetHTTPCache([]byte(key))))
+		// 请求失败后暂不再请求该节点
+		assert.False(c.available("127.0.0.1:2"))
+	})
+}
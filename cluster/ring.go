@@ -0,0 +1,92 @@
+// Copyright 2020 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// 一致性hash环，每个节点对应多个虚拟节点，
+// 节点增减时仅影响相邻虚拟节点的key
+
+package cluster
+
+import (
+	"hash/crc32"
+	"sort"
+	"strconv"
+
+	"github.com/vicanso/pike/util"
+)
+
+const (
+	defaultReplicas = 50
+)
+
+// Ring consistent hash ring
+type Ring struct {
+	replicas int
+	members  []string
+	hashes   []uint32
+	nodes    map[uint32]string
+}
+
+// NewRing new a consistent hash ring, each node has replicas virtual nodes
+func NewRing(replicas int, nodes ...string) *Ring {
+	if replicas <= 0 {
+		replicas = defaultReplicas
+	}
+	r := &Ring{
+		replicas: replicas,
+		hashes:   make([]uint32, 0, replicas*len(nodes)),
+		nodes:    make(map[uint32]string),
+	}
+	for _, node := range nodes {
+		if node != "" && !util.ContainesString(r.members, node) {
+			r.members = append(r.members, node)
+		}
+	}
+	// 按顺序添加，保证各节点生成的hash环一致
+	sort.Strings(r.members)
+	for _, node := range r.members {
+		for i := 0; i < replicas; i++ {
+			hash := crc32.ChecksumIEEE([]byte(strconv.Itoa(i) + node))
+			// hash冲突时保留先添加的节点
+			if _, ok := r.nodes[hash]; ok {
+				continue
+			}
+			r.nodes[hash] = node
+			r.hashes = append(r.hashes, hash)
+		}
+	}
+	sort.Slice(r.hashes, func(i, j int) bool {
+		return r.hashes[i] < r.hashes[j]
+	})
+	return r
+}
+
+// Get get the node of key, returns empty string if the ring is empty
+func (r *Ring) Get(key string) string {
+	if len(r.hashes) == 0 {
+		return ""
+	}
+	hash := crc32.ChecksumIEEE([]byte(key))
+	index := sort.Search(len(r.hashes), func(i int) bool {
+		return r.hashes[i] >= hash
+	})
+	if index == len(r.hashes) {
+		index = 0
+	}
+	return r.nodes[r.hashes[index]]
+}
+
+// Nodes get the sorted nodes of ring
+func (r *Ring) Nodes() []string {
+	return r.members
+}
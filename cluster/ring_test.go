@@ -0,0 +1,66 @@
+// Copyright 2020 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRing(t *testing.T) {
+	assert := assert.New(t)
+	r := NewRing(0)
+	assert.Equal("", r.Get("a"))
+	assert.Empty(r.Nodes())
+
+	nodes := []string{
+		"192.168.1.3:3016",
+		"192.168.1.1:3016",
+		"192.168.1.2:3016",
+	}
+	r = NewRing(0, append(nodes, "192.168.1.1:3016", "")...)
+	assert.Equal([]string{
+		"192.168.1.1:3016",
+		"192.168.1.2:3016",
+		"192.168.1.3:3016",
+	}, r.Nodes())
+	assert.Equal(3*defaultReplicas, len(r.hashes))
+
+	// 节点顺序不影响key所属的节点
+	r1 := NewRing(0, nodes[2], nodes[0], nodes[1])
+	counts := make(map[string]int)
+	owners := make(map[string]string)
+	for i := 0; i < 3000; i++ {
+		key := "GET aslant.site /books/" + strconv.Itoa(i)
+		node := r.Get(key)
+		assert.Equal(node, r1.Get(key))
+		owners[key] = node
+		counts[node]++
+	}
+	// key分布至各节点
+	for _, node := range nodes {
+		assert.True(counts[node] > 500, node)
+	}
+
+	// 删除节点后，仅该节点的key所属节点变化
+	r2 := NewRing(0, nodes[0], nodes[1])
+	for key, node := range owners {
+		if node != nodes[2] {
+			assert.Equal(node, r2.Get(key))
+		}
+	}
+}
@@ -19,6 +19,8 @@ package config
 
 import (
 	"strings"
+	"sync"
+	"time"
 
 	badger "github.com/dgraph-io/badger"
 	"github.com/vicanso/pike/log"
@@ -26,7 +28,9 @@ import (
 
 // BadgerClient badger client
 type BadgerClient struct {
-	db        *badger.DB
+	db *badger.DB
+	// 清除缓存的事件在其它goroutine中触发，需要加锁
+	mu        sync.RWMutex
 	onChanges map[string]OnKeyChange
 }
 
@@ -65,6 +69,8 @@ func (bc *BadgerClient) Get(key string) (data []byte, err error) {
 }
 
 func (bc *BadgerClient) emit(key string) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
 	for prefix, onChange := range bc.onChanges {
 		if strings.HasPrefix(key, prefix) {
 			onChange(key)
@@ -84,6 +90,17 @@ func (bc *BadgerClient) Set(key string, data []byte) (err error) {
 	return
 }
 
+// SetWithTTL set data with ttl to badger
+func (bc *BadgerClient) SetWithTTL(key string, data []byte, ttl time.Duration) (err error) {
+	err = bc.db.Update(func(txn *badger.Txn) error {
+		return txn.SetEntry(badger.NewEntry([]byte(key), data).WithTTL(ttl))
+	})
+	if err == nil {
+		bc.emit(key)
+	}
+	return
+}
+
 // List list all key of the prefix from badger
 func (bc *BadgerClient) List(prefix string) (keys []string, err error) {
 	err = bc.db.View(func(txn *badger.Txn) error {
@@ -112,6 +129,8 @@ func (bc *BadgerClient) Delete(key string) (err error) {
 
 // Watch watch config change
 func (bc *BadgerClient) Watch(key string, onChange OnKeyChange) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
 	if bc.onChanges == nil {
 		bc.onChanges = make(map[string]OnKeyChange)
 	}
@@ -17,6 +17,7 @@ package config
 import (
 	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -49,6 +50,17 @@ func TestBadger(t *testing.T) {
 		assert.Equal(key, keys[0])
 	})
 
+	t.Run("set with ttl", func(t *testing.T) {
+		ttlKey := prefix + "ttl"
+		err := client.SetWithTTL(ttlKey, value, time.Minute)
+		assert.Nil(err)
+		data, err := client.Get(ttlKey)
+		assert.Nil(err)
+		assert.Equal(value, data)
+		err = client.Delete(ttlKey)
+		assert.Nil(err)
+	})
+
 	t.Run("delete", func(t *testing.T) {
 		err := client.Delete(key)
 		assert.Nil(err)
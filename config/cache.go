@@ -15,17 +15,58 @@
 
 package config
 
-import "github.com/robfig/cron/v3"
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+const (
+	// EvictionLRU evict the least recently used cache
+	EvictionLRU = "lru"
+	// EvictionTinyLFU evict the cache by W-TinyLFU(window lru and frequency sketch)
+	EvictionTinyLFU = "tinylfu"
+	// EvictionARC evict the cache by adaptive replacement cache
+	EvictionARC = "arc"
+
+	// StorageHeap save the cached data in heap
+	StorageHeap = "heap"
+	// StorageArena save the cached data in the preallocated pages
+	StorageArena = "arena"
+)
+
+var (
+	errInvalidStatusTTL = errors.New("status ttl should be statusCode:ttl, such as 404:30s")
+)
 
 // Cache cache config
 type Cache struct {
-	cfg         *Config
-	Name        string `yaml:"-" json:"name,omitempty" valid:"xName"`
-	Zone        int    `yaml:"zone,omitempty" json:"zone,omitempty" valid:"numeric,range(1|10000)"`
-	Size        int    `yaml:"size,omitempty" json:"size,omitempty" valid:"numeric,range(1|10000)"`
-	HitForPass  int    `yaml:"hitForPass,omitempty" json:"hitForPass,omitempty" valid:"numeric,range(1|3600)"`
-	PurgedAt    string `yaml:"purgedAt,omitempty" json:"purgedAt,omitempty" valid:"-"`
-	Description string `yaml:"description,omitempty" json:"description,omitempty" valid:"-"`
+	cfg                  *Config
+	Name                 string        `yaml:"-" json:"name,omitempty" valid:"xName"`
+	Zone                 int           `yaml:"zone,omitempty" json:"zone,omitempty" valid:"numeric,range(1|10000)"`
+	Size                 int           `yaml:"size,omitempty" json:"size,omitempty" valid:"numeric,range(1|10000)"`
+	HitForPass           int           `yaml:"hitForPass,omitempty" json:"hitForPass,omitempty" valid:"numeric,range(1|3600)"`
+	PurgedAt             string        `yaml:"purgedAt,omitempty" json:"purgedAt,omitempty" valid:"-"`
+	StaleWhileRevalidate int           `yaml:"staleWhileRevalidate,omitempty" json:"staleWhileRevalidate,omitempty" valid:"numeric,range(1|86400),optional"`
+	StaleIfError         int           `yaml:"staleIfError,omitempty" json:"staleIfError,omitempty" valid:"numeric,range(1|86400),optional"`
+	MaxMemory            int           `yaml:"maxMemory,omitempty" json:"maxMemory,omitempty" valid:"numeric,range(1|1048576),optional"`
+	DiskPath             string        `yaml:"diskPath,omitempty" json:"diskPath,omitempty" valid:"-"`
+	DiskSize             int           `yaml:"diskSize,omitempty" json:"diskSize,omitempty" valid:"numeric,range(1|10485760),optional"`
+	DiskTTL              int           `yaml:"diskTTL,omitempty" json:"diskTTL,omitempty" valid:"numeric,range(1|31536000),optional"`
+	SurrogateKeyHeader   string        `yaml:"surrogateKeyHeader,omitempty" json:"surrogateKeyHeader,omitempty" valid:"-"`
+	WaitTimeout          time.Duration `yaml:"waitTimeout,omitempty" json:"waitTimeout,omitempty" valid:"-"`
+	WaitTimeoutPass      bool          `yaml:"waitTimeoutPass,omitempty" json:"waitTimeoutPass,omitempty" valid:"-"`
+	StatusTTL            []string      `yaml:"statusTTL,omitempty" json:"statusTTL,omitempty" valid:"xStatusTTL,optional"`
+	SnapshotPath         string        `yaml:"snapshotPath,omitempty" json:"snapshotPath,omitempty" valid:"-"`
+	Eviction             string        `yaml:"eviction,omitempty" json:"eviction,omitempty" valid:"xEviction,optional"`
+	Admission            int           `yaml:"admission,omitempty" json:"admission,omitempty" valid:"numeric,range(2|15),optional"`
+	AdmissionWindow      time.Duration `yaml:"admissionWindow,omitempty" json:"admissionWindow,omitempty" valid:"-"`
+	JanitorInterval      time.Duration `yaml:"janitorInterval,omitempty" json:"janitorInterval,omitempty" valid:"-"`
+	Storage              string        `yaml:"storage,omitempty" json:"storage,omitempty" valid:"xStorage,optional"`
+	Description          string        `yaml:"description,omitempty" json:"description,omitempty" valid:"-"`
 }
 
 // Caches cache configs
@@ -36,6 +77,37 @@ func (c *Cache) Fetch() (err error) {
 	return c.cfg.fetchConfig(c, CachesCategory, c.Name)
 }
 
+// ParseStatusTTL parse the status ttl(such as 404:30s), returns the status code and ttl
+func ParseStatusTTL(value string) (statusCode int, ttl time.Duration, err error) {
+	arr := strings.SplitN(value, ":", 2)
+	if len(arr) != 2 {
+		err = errInvalidStatusTTL
+		return
+	}
+	statusCode, err = strconv.Atoi(strings.TrimSpace(arr[0]))
+	if err != nil {
+		return
+	}
+	ttl, err = time.ParseDuration(strings.TrimSpace(arr[1]))
+	return
+}
+
+// GetStatusTTL get the ttl of status code, the invalid item is ignored
+func (c *Cache) GetStatusTTL() map[int]time.Duration {
+	if len(c.StatusTTL) == 0 {
+		return nil
+	}
+	result := make(map[int]time.Duration)
+	for _, item := range c.StatusTTL {
+		statusCode, ttl, err := ParseStatusTTL(item)
+		if err != nil {
+			continue
+		}
+		result[statusCode] = ttl
+	}
+	return result
+}
+
 // Save save ccache config
 func (c *Cache) Save() (err error) {
 	if c.PurgedAt != "" {
@@ -16,6 +16,7 @@ package config
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -42,11 +43,33 @@ func TestCacheConfig(t *testing.T) {
 	size := 10
 	description := "cache description"
 	purgedAt := "@every 5m"
+	staleWhileRevalidate := 60
+	staleIfError := 600
+	maxMemory := 512
+	diskPath := "/tmp/pike-cache"
+	diskSize := 10240
+	diskTTL := 86400
+	surrogateKeyHeader := "X-Cache-Tags"
+	waitTimeout := 3 * time.Second
+	statusTTL := []string{
+		"404:30s",
+		"502:5s",
+	}
 	c.HitForPass = hitForPass
 	c.Zone = zone
 	c.Size = size
 	c.Description = description
 	c.PurgedAt = purgedAt
+	c.StaleWhileRevalidate = staleWhileRevalidate
+	c.StaleIfError = staleIfError
+	c.MaxMemory = maxMemory
+	c.DiskPath = diskPath
+	c.DiskSize = diskSize
+	c.DiskTTL = diskTTL
+	c.SurrogateKeyHeader = surrogateKeyHeader
+	c.WaitTimeout = waitTimeout
+	c.WaitTimeoutPass = true
+	c.StatusTTL = statusTTL
 	err = c.Save()
 	assert.Nil(err)
 
@@ -61,9 +84,48 @@ func TestCacheConfig(t *testing.T) {
 	assert.Equal(size, nc.Size)
 	assert.Equal(description, nc.Description)
 	assert.Equal(purgedAt, nc.PurgedAt)
+	assert.Equal(staleWhileRevalidate, nc.StaleWhileRevalidate)
+	assert.Equal(staleIfError, nc.StaleIfError)
+	assert.Equal(maxMemory, nc.MaxMemory)
+	assert.Equal(diskPath, nc.DiskPath)
+	assert.Equal(diskSize, nc.DiskSize)
+	assert.Equal(diskTTL, nc.DiskTTL)
+	assert.Equal(surrogateKeyHeader, nc.SurrogateKeyHeader)
+	assert.Equal(waitTimeout, nc.WaitTimeout)
+	assert.True(nc.WaitTimeoutPass)
+	assert.Equal(statusTTL, nc.StatusTTL)
+	assert.Equal(map[int]time.Duration{
+		404: 30 * time.Second,
+		502: 5 * time.Second,
+	}, nc.GetStatusTTL())
 
 	caches, err := cfg.GetCaches()
 	assert.Nil(err)
 	nc = caches.Get(c.Name)
 	assert.Equal(c, nc)
 }
+
+func TestParseStatusTTL(t *testing.T) {
+	assert := assert.New(t)
+	statusCode, ttl, err := ParseStatusTTL("404: 30s")
+	assert.Nil(err)
+	assert.Equal(404, statusCode)
+	assert.Equal(30*time.Second, ttl)
+
+	_, _, err = ParseStatusTTL("404")
+	assert.Equal(errInvalidStatusTTL, err)
+	_, _, err = ParseStatusTTL("abc:30s")
+	assert.NotNil(err)
+	_, _, err = ParseStatusTTL("404:30")
+	assert.NotNil(err)
+
+	c := &Cache{
+		StatusTTL: []string{
+			"404:1m",
+			"500",
+		},
+	}
+	assert.Equal(map[int]time.Duration{
+		404: time.Minute,
+	}, c.GetStatusTTL())
+}
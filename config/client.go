@@ -17,6 +17,8 @@
 
 package config
 
+import "time"
+
 type (
 	// Client client interface
 	Client interface {
@@ -24,6 +26,8 @@ type (
 		Get(key string) (data []byte, err error)
 		// Set set the data of key
 		Set(key string, data []byte) (err error)
+		// SetWithTTL set the data of key, it will be deleted after ttl
+		SetWithTTL(key string, data []byte, ttl time.Duration) (err error)
 		// Delete delete the data of key
 		Delete(key string) (err error)
 		// List list all sub keys of key
@@ -0,0 +1,102 @@
+// Copyright 2020 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// cluster config, the nodes of cluster share the http caches
+
+package config
+
+import (
+	"sort"
+	"time"
+)
+
+type (
+	// Cluster cluster config
+	Cluster struct {
+		cfg *Config
+		// Addr the listen address of peer server, such as :3016
+		Addr string `yaml:"addr,omitempty" json:"addr,omitempty" valid:"ascii,runelength(1|50)"`
+		// Self the address of current node which other nodes can access, such as 192.168.1.2:3016
+		Self string `yaml:"self,omitempty" json:"self,omitempty" valid:"xAddr"`
+		// Peers the static addresses of nodes
+		Peers []string `yaml:"peers,omitempty" json:"peers,omitempty" valid:"xAddrs,optional"`
+		// Register register current node to config, the registered nodes are added to cluster
+		Register bool `yaml:"register,omitempty" json:"register,omitempty" valid:"-"`
+		// Replicas the virtual nodes of each node in the hash ring
+		Replicas int `yaml:"replicas,omitempty" json:"replicas,omitempty" valid:"numeric,range(1|1000),optional"`
+		// Timeout the timeout of request to other node
+		Timeout time.Duration `yaml:"timeout,omitempty" json:"timeout,omitempty" valid:"-"`
+		// Token the token of peer request, it should be the same for all nodes
+		Token       string `yaml:"token,omitempty" json:"token,omitempty" valid:"ascii,runelength(16|128)"`
+		Enabled     bool   `yaml:"enabled,omitempty" json:"enabled,omitempty" valid:"-"`
+		Description string `yaml:"description,omitempty" json:"description,omitempty" valid:"-"`
+	}
+	// Node the registered node of cluster
+	Node struct {
+		Addr      string `yaml:"addr"`
+		UpdatedAt int64  `yaml:"updatedAt"`
+	}
+)
+
+// Fetch fetch cluster config
+func (c *Cluster) Fetch() (err error) {
+	return c.cfg.fetchConfig(c, ClusterCategory)
+}
+
+// Save save cluster config
+func (c *Cluster) Save() (err error) {
+	return c.cfg.saveConfig(c, ClusterCategory)
+}
+
+// Delete delete cluster config
+func (c *Cluster) Delete() (err error) {
+	return c.cfg.deleteConfig(ClusterCategory)
+}
+
+// RegisterNode register the node(or refresh its updated time)
+func (cfg *Config) RegisterNode(addr string) error {
+	return cfg.saveConfig(&Node{
+		Addr:      addr,
+		UpdatedAt: time.Now().Unix(),
+	}, NodesCategory, addr)
+}
+
+// UnregisterNode unregister the node
+func (cfg *Config) UnregisterNode(addr string) error {
+	return cfg.deleteConfig(NodesCategory, addr)
+}
+
+// GetNodes get the sorted addresses of registered nodes,
+// the node which isn't refreshed in ttl is ignored
+func (cfg *Config) GetNodes(ttl time.Duration) ([]string, error) {
+	keys, err := cfg.listKeysExcludePrefix(NodesCategory)
+	if err != nil {
+		return nil, err
+	}
+	expiredAt := time.Now().Add(-ttl).Unix()
+	nodes := make([]string, 0, len(keys))
+	for _, key := range keys {
+		node := &Node{}
+		err := cfg.fetchConfig(node, NodesCategory, key)
+		if err != nil {
+			return nil, err
+		}
+		if node.Addr == "" || node.UpdatedAt < expiredAt {
+			continue
+		}
+		nodes = append(nodes, node.Addr)
+	}
+	sort.Strings(nodes)
+	return nodes, nil
+}
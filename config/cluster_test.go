@@ -0,0 +1,86 @@
+// Copyright 2020 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClusterConfig(t *testing.T) {
+	assert := assert.New(t)
+	cfg := NewTestConfig()
+	defer func() {
+		_ = cfg.NewClusterConfig().Delete()
+	}()
+
+	cluster, err := cfg.GetCluster()
+	assert.Nil(err)
+	assert.Empty(cluster.Addr)
+	assert.Empty(cluster.Self)
+	assert.False(cluster.Enabled)
+
+	cluster.Addr = ":3016"
+	cluster.Self = "192.168.1.1:3016"
+	cluster.Peers = []string{
+		"192.168.1.2:3016",
+	}
+	cluster.Register = true
+	cluster.Replicas = 100
+	cluster.Timeout = time.Second
+	cluster.Enabled = true
+	err = cluster.Save()
+	assert.Nil(err)
+
+	cluster = cfg.NewClusterConfig()
+	err = cluster.Fetch()
+	assert.Nil(err)
+	assert.Equal(":3016", cluster.Addr)
+	assert.Equal("192.168.1.1:3016", cluster.Self)
+	assert.Equal([]string{"192.168.1.2:3016"}, cluster.Peers)
+	assert.True(cluster.Register)
+	assert.Equal(100, cluster.Replicas)
+	assert.Equal(time.Second, cluster.Timeout)
+	assert.True(cluster.Enabled)
+}
+
+func TestClusterNodes(t *testing.T) {
+	assert := assert.New(t)
+	cfg := NewTestConfig()
+	nodes := []string{
+		"192.168.1.2:3016",
+		"192.168.1.1:3016",
+	}
+	defer func() {
+		for _, node := range nodes {
+			_ = cfg.UnregisterNode(node)
+		}
+	}()
+	for _, node := range nodes {
+		err := cfg.RegisterNode(node)
+		assert.Nil(err)
+	}
+	result, err := cfg.GetNodes(time.Minute)
+	assert.Nil(err)
+	assert.Equal([]string{"192.168.1.1:3016", "192.168.1.2:3016"}, result)
+
+	err = cfg.UnregisterNode(nodes[0])
+	assert.Nil(err)
+	result, err = cfg.GetNodes(time.Minute)
+	assert.Nil(err)
+	assert.Equal([]string{"192.168.1.1:3016"}, result)
+}
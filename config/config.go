@@ -50,6 +50,10 @@ const (
 	AdminCategory = "admin"
 	// AlarmsCategory alarm category
 	AlarmsCategory = "alarms"
+	// ClusterCategory cluster category
+	ClusterCategory = "cluster"
+	// NodesCategory the registered nodes of cluster, it isn't watched
+	NodesCategory = "nodes"
 )
 
 // IConfig config interface
@@ -83,6 +87,8 @@ const (
 	InfluxdbChange
 	// AlarmChange alarm's config change
 	AlarmChange
+	// ClusterChange cluster's config change
+	ClusterChange
 )
 
 type (
@@ -93,6 +99,7 @@ type (
 		basePath         string
 		client           Client
 		events           []OnChange
+		purgeEvents      []OnPurge
 	}
 )
 
@@ -132,12 +139,18 @@ func NewConfig(configPath string) (cfg *Config, err error) {
 	changeTypeKeyMap[CertChange] = filepath.Join(basePath, CertsCategory)
 	changeTypeKeyMap[InfluxdbChange] = filepath.Join(basePath, InfluxdbCategory)
 	changeTypeKeyMap[AlarmChange] = filepath.Join(basePath, AlarmsCategory)
+	changeTypeKeyMap[ClusterChange] = filepath.Join(basePath, ClusterCategory)
 	cfg = &Config{
 		client:           configClient,
 		basePath:         basePath,
 		changeTypeKeyMap: changeTypeKeyMap,
 	}
 	go configClient.Watch(basePath, func(key string) {
+		// 清除缓存的事件不触发配置变化
+		if cfg.isPurgeKey(key) {
+			cfg.emitPurge(key)
+			return
+		}
 		for t, prefix := range changeTypeKeyMap {
 			if strings.HasPrefix(key, prefix) {
 				value := ""
@@ -258,6 +271,14 @@ func (cfg *Config) GetInfluxdb() (*Influxdb, error) {
 	return influx, err
 }
 
+// GetCluster get cluster config
+func (cfg *Config) GetCluster() (*Cluster, error) {
+	cluster := new(Cluster)
+	cluster.cfg = cfg
+	err := cluster.Fetch()
+	return cluster, err
+}
+
 // GetCaches get all config config
 func (cfg *Config) GetCaches() (caches Caches, err error) {
 	keys, err := cfg.listKeysExcludePrefix(CachesCategory)
@@ -465,6 +486,13 @@ func (cfg *Config) NewInfluxdbConfig() *Influxdb {
 	}
 }
 
+// NewClusterConfig new cluster config
+func (cfg *Config) NewClusterConfig() *Cluster {
+	return &Cluster{
+		cfg: cfg,
+	}
+}
+
 // NewAlarmConfig new alarm config
 func (cfg *Config) NewAlarmConfig(name string) *Alarm {
 	return &Alarm{
@@ -90,6 +90,23 @@ func (ec *EtcdClient) Set(key string, data []byte) (err error) {
 	return
 }
 
+// SetWithTTL set data with lease to etcd, the key is deleted when the lease is expired
+func (ec *EtcdClient) SetWithTTL(key string, data []byte, ttl time.Duration) (err error) {
+	ctx, cancel := ec.context()
+	defer cancel()
+	// lease的最小单位为秒
+	seconds := int64(ttl / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	lease, err := ec.c.Grant(ctx, seconds)
+	if err != nil {
+		return
+	}
+	_, err = ec.c.Put(ctx, key, string(data), clientv3.WithLease(lease.ID))
+	return
+}
+
 // List list all key of the prefix from etcd
 func (ec *EtcdClient) List(prefix string) (keys []string, err error) {
 	ctx, cancel := ec.context()
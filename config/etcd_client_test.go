@@ -16,6 +16,7 @@ package config
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/vicanso/pike/util"
@@ -45,6 +46,16 @@ func TestEtdClient(t *testing.T) {
 		assert.Equal(1, len(keys))
 		assert.Equal(upstream1Name, keys[0])
 	})
+	t.Run("set with ttl", func(t *testing.T) {
+		key := name + "/purges/1"
+		err := client.SetWithTTL(key, upstream1Data, time.Minute)
+		assert.Nil(err)
+		data, err := client.Get(key)
+		assert.Nil(err)
+		assert.Equal(upstream1Data, data)
+		err = client.Delete(key)
+		assert.Nil(err)
+	})
 	t.Run("delete", func(t *testing.T) {
 		err := client.Delete(upstream1Name)
 		assert.Nil(err)
@@ -18,25 +18,60 @@ package config
 
 import (
 	"net/http"
+	"regexp"
 	"sort"
 	"strings"
 
 	"github.com/vicanso/pike/util"
 )
 
+const (
+	// CacheRuleActionForce force to cache the response with the ttl of rule
+	CacheRuleActionForce = "force"
+	// CacheRuleActionMax the ttl of response can't be greater than the ttl of rule
+	CacheRuleActionMax = "max"
+	// CacheRuleActionPass never cache the response
+	CacheRuleActionPass = "pass"
+)
+
+// LocationCacheRule the cache rule of location, the response matches all the
+// conditions(path regexp, content type regexp and status code) of rule will
+// use the action of rule, the condition isn't set will be ignored.
+type LocationCacheRule struct {
+	Path        string `yaml:"path,omitempty" json:"path,omitempty" valid:"-"`
+	ContentType string `yaml:"contentType,omitempty" json:"contentType,omitempty" valid:"-"`
+	StatusCode  int    `yaml:"statusCode,omitempty" json:"statusCode,omitempty" valid:"-"`
+	Action      string `yaml:"action,omitempty" json:"action,omitempty" valid:"-"`
+	// TTL the ttl(seconds) of force and max action
+	TTL int `yaml:"ttl,omitempty" json:"ttl,omitempty" valid:"-"`
+	// StripCookie remove the Set-Cookie of response before caching
+	StripCookie bool `yaml:"stripCookie,omitempty" json:"stripCookie,omitempty" valid:"-"`
+
+	pathReg        *regexp.Regexp
+	contentTypeReg *regexp.Regexp
+}
+
 // Location location config
 type Location struct {
-	cfg            *Config
-	Name           string      `yaml:"name,omitempty" json:"name,omitempty" valid:"xName"`
-	Upstream       string      `yaml:"upstream,omitempty" json:"upstream,omitempty" valid:"xName"`
-	Prefixs        []string    `yaml:"prefixs,omitempty" json:"prefixs,omitempty" valid:"xPrefixs,optional"`
-	Rewrites       []string    `yaml:"rewrites,omitempty" json:"rewrites,omitempty" valid:"xRewrites,optional"`
-	Hosts          []string    `yaml:"hosts,omitempty" json:"hosts,omitempty" valid:"xHosts,optional"`
-	ResponseHeader []string    `yaml:"responseHeader,omitempty" json:"responseHeader,omitempty" valid:"xHeader,optional"`
-	ResHeader      http.Header `yaml:"-" json:"-" valid:"-"`
-	RequestHeader  []string    `yaml:"requestHeader,omitempty" json:"requestHeader,omitempty" valid:"xHeader,optional"`
-	ReqHeader      http.Header `yaml:"-" json:"-" valid:"-"`
-	Description    string      `yaml:"description,omitempty" json:"description,omitempty" valid:"-"`
+	cfg                    *Config
+	Name                   string               `yaml:"name,omitempty" json:"name,omitempty" valid:"xName"`
+	Upstream               string               `yaml:"upstream,omitempty" json:"upstream,omitempty" valid:"xName"`
+	Prefixs                []string             `yaml:"prefixs,omitempty" json:"prefixs,omitempty" valid:"xPrefixs,optional"`
+	Rewrites               []string             `yaml:"rewrites,omitempty" json:"rewrites,omitempty" valid:"xRewrites,optional"`
+	Hosts                  []string             `yaml:"hosts,omitempty" json:"hosts,omitempty" valid:"xHosts,optional"`
+	ResponseHeader         []string             `yaml:"responseHeader,omitempty" json:"responseHeader,omitempty" valid:"xHeader,optional"`
+	ResHeader              http.Header          `yaml:"-" json:"-" valid:"-"`
+	RequestHeader          []string             `yaml:"requestHeader,omitempty" json:"requestHeader,omitempty" valid:"xHeader,optional"`
+	ReqHeader              http.Header          `yaml:"-" json:"-" valid:"-"`
+	CacheKeyIgnoreQuery    []string             `yaml:"cacheKeyIgnoreQuery,omitempty" json:"cacheKeyIgnoreQuery,omitempty" valid:"-"`
+	CacheKeyQueryWhitelist []string             `yaml:"cacheKeyQueryWhitelist,omitempty" json:"cacheKeyQueryWhitelist,omitempty" valid:"-"`
+	CacheKeySortQuery      bool                 `yaml:"cacheKeySortQuery,omitempty" json:"cacheKeySortQuery,omitempty" valid:"-"`
+	CacheKeyLowerHost      bool                 `yaml:"cacheKeyLowerHost,omitempty" json:"cacheKeyLowerHost,omitempty" valid:"-"`
+	CacheKeyHeaders        []string             `yaml:"cacheKeyHeaders,omitempty" json:"cacheKeyHeaders,omitempty" valid:"-"`
+	CacheKeyCookies        []string             `yaml:"cacheKeyCookies,omitempty" json:"cacheKeyCookies,omitempty" valid:"-"`
+	KeyPolicy              *util.IdentityPolicy `yaml:"-" json:"-" valid:"-"`
+	CacheRules             []LocationCacheRule  `yaml:"cacheRules,omitempty" json:"cacheRules,omitempty" valid:"xCacheRules,optional"`
+	Description            string               `yaml:"description,omitempty" json:"description,omitempty" valid:"-"`
 }
 
 // Locations locations
@@ -50,9 +85,80 @@ func (l *Location) Fetch() (err error) {
 	}
 	l.ReqHeader = util.ConvertToHTTPHeader(l.RequestHeader)
 	l.ResHeader = util.ConvertToHTTPHeader(l.ResponseHeader)
+	l.KeyPolicy = l.newKeyPolicy()
+	for i := range l.CacheRules {
+		l.CacheRules[i].compile()
+	}
 	return
 }
 
+// newKeyPolicy create the cache key policy of location, returns nil if no policy is set
+func (l *Location) newKeyPolicy() *util.IdentityPolicy {
+	if len(l.CacheKeyIgnoreQuery) == 0 &&
+		len(l.CacheKeyQueryWhitelist) == 0 &&
+		!l.CacheKeySortQuery &&
+		!l.CacheKeyLowerHost &&
+		len(l.CacheKeyHeaders) == 0 &&
+		len(l.CacheKeyCookies) == 0 {
+		return nil
+	}
+	return &util.IdentityPolicy{
+		IgnoreQuery:    l.CacheKeyIgnoreQuery,
+		QueryWhitelist: l.CacheKeyQueryWhitelist,
+		SortQuery:      l.CacheKeySortQuery,
+		LowerHost:      l.CacheKeyLowerHost,
+		Headers:        l.CacheKeyHeaders,
+		Cookies:        l.CacheKeyCookies,
+	}
+}
+
+// compile compile the regexps of cache rule, the invalid regexp is ignored(checked by validator)
+func (rule *LocationCacheRule) compile() {
+	if rule.Path != "" {
+		rule.pathReg, _ = regexp.Compile(rule.Path)
+	}
+	if rule.ContentType != "" {
+		rule.contentTypeReg, _ = regexp.Compile(rule.ContentType)
+	}
+}
+
+// matchString check the value match the regexp, the regexp is compiled if it isn't compiled
+func matchString(reg *regexp.Regexp, expr, value string) bool {
+	if reg == nil {
+		var err error
+		reg, err = regexp.Compile(expr)
+		if err != nil {
+			return false
+		}
+	}
+	return reg.MatchString(value)
+}
+
+// Match check the response match the cache rule
+func (rule *LocationCacheRule) Match(path, contentType string, statusCode int) bool {
+	if rule.StatusCode != 0 && rule.StatusCode != statusCode {
+		return false
+	}
+	if rule.Path != "" && !matchString(rule.pathReg, rule.Path, path) {
+		return false
+	}
+	if rule.ContentType != "" && !matchString(rule.contentTypeReg, rule.ContentType, contentType) {
+		return false
+	}
+	return true
+}
+
+// GetCacheRule get the first matched cache rule
+func (l *Location) GetCacheRule(path, contentType string, statusCode int) *LocationCacheRule {
+	for i := range l.CacheRules {
+		rule := &l.CacheRules[i]
+		if rule.Match(path, contentType, statusCode) {
+			return rule
+		}
+	}
+	return nil
+}
+
 // Save save location config
 func (l *Location) Save() (err error) {
 	return l.cfg.saveConfig(l, LocationsCategory, l.Name)
@@ -18,6 +18,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/vicanso/pike/util"
 )
 
 func TestLocation(t *testing.T) {
@@ -52,6 +53,20 @@ func TestLocation(t *testing.T) {
 		ResponseHeader: responseHeader,
 		RequestHeader:  requestHeader,
 		Description:    description,
+		CacheKeyIgnoreQuery: []string{
+			"utm_*",
+		},
+		CacheKeySortQuery: true,
+		CacheKeyCookies: []string{
+			"lang",
+		},
+		CacheRules: []LocationCacheRule{
+			{
+				Path:   "^/static/",
+				Action: CacheRuleActionForce,
+				TTL:    60,
+			},
+		},
 	}
 	defer func() {
 		_ = l.Delete()
@@ -73,6 +88,17 @@ func TestLocation(t *testing.T) {
 	assert.Equal(responseHeader, l.ResponseHeader)
 	assert.Equal(requestHeader, l.RequestHeader)
 	assert.Equal(description, l.Description)
+	assert.Equal(&util.IdentityPolicy{
+		IgnoreQuery: []string{
+			"utm_*",
+		},
+		SortQuery: true,
+		Cookies: []string{
+			"lang",
+		},
+	}, l.KeyPolicy)
+	assert.Equal(1, len(l.CacheRules))
+	assert.NotNil(l.CacheRules[0].pathReg)
 
 	locations, err := cfg.GetLocations()
 	assert.Nil(err)
@@ -97,6 +123,32 @@ func TestMatch(t *testing.T) {
 	assert.True(l.Match("aslant.site", "/api"))
 }
 
+func TestGetCacheRule(t *testing.T) {
+	assert := assert.New(t)
+	l := Location{
+		CacheRules: []LocationCacheRule{
+			{
+				Path:        "^/static/",
+				ContentType: "image|css",
+				Action:      CacheRuleActionForce,
+				TTL:         60,
+			},
+			{
+				StatusCode: 404,
+				Action:     CacheRuleActionMax,
+				TTL:        10,
+			},
+		},
+	}
+	// 未编译的规则也可匹配
+	assert.Equal(CacheRuleActionForce, l.GetCacheRule("/static/a.png", "image/png", 200).Action)
+	l.CacheRules[0].compile()
+	assert.Equal(CacheRuleActionForce, l.GetCacheRule("/static/a.css", "text/css", 200).Action)
+	assert.Nil(l.GetCacheRule("/static/a.js", "application/javascript", 200))
+	assert.Equal(CacheRuleActionMax, l.GetCacheRule("/static/a.js", "application/javascript", 404).Action)
+	assert.Nil(l.GetCacheRule("/api", "application/json", 200))
+}
+
 func newLocations() Locations {
 	return Locations{
 		&Location{
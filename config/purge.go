@@ -0,0 +1,154 @@
+// Copyright 2020 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// 清除缓存的事件，通过配置的监听通知至所有节点，
+// 各节点清除缓存后写入确认信息，事件与确认信息在有效期后自动删除
+
+package config
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-yaml/yaml"
+	"github.com/vicanso/pike/util"
+)
+
+const (
+	// PurgesCategory the category of purge events, it isn't watched as config change
+	PurgesCategory = "purges"
+	// AcksCategory the category of purge acknowledgements
+	AcksCategory = "acks"
+
+	// 事件与确认信息的有效期
+	purgeEventTTL = time.Minute
+)
+
+type (
+	// PurgeEvent the event of purging cache, it is published to all nodes
+	PurgeEvent struct {
+		ID string `yaml:"id"`
+		// Node the node which publishes the event
+		Node string `yaml:"node"`
+		// Cache the name of cache, empty means all caches
+		Cache string `yaml:"cache,omitempty"`
+		// Key purge by the key of cache
+		Key string `yaml:"key,omitempty"`
+		// Host the host of prefix
+		Host string `yaml:"host,omitempty"`
+		// Prefix purge by the prefix of uri
+		Prefix string `yaml:"prefix,omitempty"`
+		// Regexp purge by the regexp of key
+		Regexp string `yaml:"regexp,omitempty"`
+		// Tag purge by the tag(surrogate key) of cache
+		Tag string `yaml:"tag,omitempty"`
+		// Ban ban the http caches whose uri match the regexp(and host)
+		Ban       string `yaml:"ban,omitempty"`
+		CreatedAt int64  `yaml:"createdAt"`
+	}
+	// PurgeAck the acknowledgement of purge event
+	PurgeAck struct {
+		Node  string `yaml:"node" json:"node"`
+		Count int    `yaml:"count" json:"count"`
+		Error string `yaml:"error,omitempty" json:"error,omitempty"`
+	}
+	// OnPurge purge event's handler
+	OnPurge func(*PurgeEvent)
+)
+
+// PublishPurge publish the purge event to all nodes, the id of event is generated if it is empty
+func (cfg *Config) PublishPurge(event *PurgeEvent) (err error) {
+	if event.ID == "" {
+		event.ID = util.RandomString(16)
+	}
+	if event.CreatedAt == 0 {
+		event.CreatedAt = time.Now().Unix()
+	}
+	key, err := cfg.getKey(PurgesCategory, event.ID)
+	if err != nil {
+		return
+	}
+	data, err := yaml.Marshal(event)
+	if err != nil {
+		return
+	}
+	return cfg.client.SetWithTTL(key, data, purgeEventTTL)
+}
+
+// OnPurge add the handler of purge event
+func (cfg *Config) OnPurge(fn OnPurge) {
+	cfg.purgeEvents = append(cfg.purgeEvents, fn)
+}
+
+// emitPurge get the purge event of key and call the handlers,
+// the deleted(expired) event is ignored
+func (cfg *Config) emitPurge(key string) {
+	data, err := cfg.client.Get(key)
+	if err != nil || len(data) == 0 {
+		return
+	}
+	event := &PurgeEvent{}
+	err = yaml.Unmarshal(data, event)
+	if err != nil || event.ID == "" {
+		return
+	}
+	for _, fn := range cfg.purgeEvents {
+		fn(event)
+	}
+}
+
+// isPurgeKey check the key is the key of purge event
+func (cfg *Config) isPurgeKey(key string) bool {
+	prefix, _ := cfg.getKey(PurgesCategory)
+	return strings.HasPrefix(key, prefix+"/")
+}
+
+// AckPurge save the acknowledgement of purge event
+func (cfg *Config) AckPurge(id string, ack *PurgeAck) (err error) {
+	key, err := cfg.getKey(AcksCategory, id, ack.Node)
+	if err != nil {
+		return
+	}
+	data, err := yaml.Marshal(ack)
+	if err != nil {
+		return
+	}
+	return cfg.client.SetWithTTL(key, data, purgeEventTTL)
+}
+
+// GetPurgeAcks get the acknowledgements of purge event, they are sorted by node
+func (cfg *Config) GetPurgeAcks(id string) (acks []*PurgeAck, err error) {
+	keys, err := cfg.listKeysExcludePrefix(AcksCategory + "/" + id)
+	if err != nil {
+		return
+	}
+	acks = make([]*PurgeAck, 0, len(keys))
+	for _, key := range keys {
+		ack := &PurgeAck{}
+		err = cfg.fetchConfig(ack, AcksCategory, id, key)
+		if err != nil {
+			return
+		}
+		// 已过期的忽略
+		if ack.Node == "" {
+			continue
+		}
+		acks = append(acks, ack)
+	}
+	sort.Slice(acks, func(i, j int) bool {
+		return acks[i].Node < acks[j].Node
+	})
+	return
+}
@@ -0,0 +1,89 @@
+// Copyright 2020 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPurgeEvent(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "pike-purge")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+	cfg, err := NewConfig(dir + "/pike")
+	assert.Nil(err)
+	defer cfg.Close()
+	// 等待监听生效
+	time.Sleep(10 * time.Millisecond)
+
+	changed := false
+	cfg.Watch(func(_ ChangeType, _ string) {
+		changed = true
+	})
+	events := make(chan *PurgeEvent, 1)
+	cfg.OnPurge(func(event *PurgeEvent) {
+		events <- event
+	})
+
+	err = cfg.PublishPurge(&PurgeEvent{
+		Node:   "192.168.1.1:3016",
+		Cache:  "default",
+		Prefix: "/books",
+	})
+	assert.Nil(err)
+	var event *PurgeEvent
+	select {
+	case event = <-events:
+	case <-time.After(time.Second):
+	}
+	assert.NotNil(event)
+	assert.NotEmpty(event.ID)
+	assert.Equal("192.168.1.1:3016", event.Node)
+	assert.Equal("default", event.Cache)
+	assert.Equal("/books", event.Prefix)
+	assert.NotEmpty(event.CreatedAt)
+	// 清除缓存的事件不触发配置变化
+	assert.False(changed)
+
+	for _, node := range []string{"192.168.1.2:3016", "192.168.1.1:3016"} {
+		err = cfg.AckPurge(event.ID, &PurgeAck{
+			Node:  node,
+			Count: 1,
+		})
+		assert.Nil(err)
+	}
+	acks, err := cfg.GetPurgeAcks(event.ID)
+	assert.Nil(err)
+	assert.Equal([]*PurgeAck{
+		{
+			Node:  "192.168.1.1:3016",
+			Count: 1,
+		},
+		{
+			Node:  "192.168.1.2:3016",
+			Count: 1,
+		},
+	}, acks)
+
+	acks, err = cfg.GetPurgeAcks("notfound")
+	assert.Nil(err)
+	assert.Empty(acks)
+}
@@ -39,6 +39,8 @@ type Server struct {
 	WriteTimeout      time.Duration `yaml:"writeTimeout,omitempty" json:"writeTimeout,omitempty" valid:"-"`
 	IdleTimeout       time.Duration `yaml:"idleTimeout,omitempty" json:"idleTimeout,omitempty" valid:"-"`
 	MaxHeaderBytes    int           `yaml:"maxHeaderBytes,omitempty" json:"maxHeaderBytes,omitempty" valid:"-"`
+	EnabledPurge      bool          `yaml:"enabledPurge,omitempty" json:"enabledPurge,omitempty" valid:"-"`
+	PurgeACL          []string      `yaml:"purgeACL,omitempty" json:"purgeACL,omitempty" valid:"xCIDRs,optional"`
 	Description       string        `yaml:"description,omitempty" json:"description,omitempty" valid:"-"`
 }
 
@@ -60,6 +60,9 @@ func TestServerConfig(t *testing.T) {
 	writeTimeout := 3 * time.Second
 	ideleTimeout := 4 * time.Second
 	maxHeaderBytes := 10
+	purgeACL := []string{
+		"10.0.0.0/8",
+	}
 
 	s.Addr = addr
 	s.Cache = cache
@@ -71,6 +74,8 @@ func TestServerConfig(t *testing.T) {
 	s.WriteTimeout = writeTimeout
 	s.IdleTimeout = ideleTimeout
 	s.MaxHeaderBytes = maxHeaderBytes
+	s.EnabledPurge = true
+	s.PurgeACL = purgeACL
 	s.Description = description
 	s.Certs = certs
 	err = s.Save()
@@ -92,6 +97,8 @@ func TestServerConfig(t *testing.T) {
 	assert.Equal(writeTimeout, ns.WriteTimeout)
 	assert.Equal(ideleTimeout, ns.IdleTimeout)
 	assert.Equal(maxHeaderBytes, ns.MaxHeaderBytes)
+	assert.True(ns.EnabledPurge)
+	assert.Equal(purgeACL, ns.PurgeACL)
 	assert.Equal(description, ns.Description)
 
 	servers, err := cfg.GetServers()
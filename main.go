@@ -115,6 +115,9 @@ func startServer(cfg *config.Config) {
 			if ins.InfluxSrv != nil {
 				ins.InfluxSrv.Flush()
 			}
+			// 关闭前保存缓存快照，启动时再恢复
+			ins.SaveSnapshots()
+			ins.Close()
 			cfg.Close()
 			// TODO 将server设置为stop，延时退出
 			os.Exit(0)
@@ -18,8 +18,11 @@ import (
 	"bytes"
 	"encoding/base64"
 	"io/ioutil"
+	"math"
 	"net"
 	"net/http"
+	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/vicanso/elton"
@@ -34,7 +37,29 @@ import (
 	"github.com/vicanso/hes"
 	intranetip "github.com/vicanso/intranet-ip"
 	"github.com/vicanso/pike/application"
+	"github.com/vicanso/pike/cache"
 	"github.com/vicanso/pike/config"
+	"github.com/vicanso/pike/util"
+)
+
+type (
+	// purgeCacheParams the params of purging cache
+	purgeCacheParams struct {
+		// 缓存名称，为空则表示所有缓存
+		Cache string `json:"cache,omitempty" valid:"-"`
+		// 缓存的key(method host uri)
+		Key string `json:"key,omitempty" valid:"-"`
+		// 指定host，与prefix一起使用
+		Host string `json:"host,omitempty" valid:"-"`
+		// uri的前缀
+		Prefix string `json:"prefix,omitempty" valid:"-"`
+		// 匹配key的正则表达式
+		Regexp string `json:"regexp,omitempty" valid:"-"`
+		// 缓存的标签
+		Tag string `json:"tag,omitempty" valid:"-"`
+		// 匹配uri的正则表达式（与host一起使用），在此之前创建的匹配缓存在获取时失效
+		Ban string `json:"ban,omitempty" valid:"-"`
+	}
 )
 
 func newAdminValidateMiddlewares(adminConfig *config.Admin) []elton.Handler {
@@ -69,6 +94,219 @@ func newAdminValidateMiddlewares(adminConfig *config.Admin) []elton.Handler {
 	}
 	return handlers
 }
+
+// newPurgeCacheMatcher new a matcher for purging cache
+func newPurgeCacheMatcher(params *purgeCacheParams) (match func(key string) bool, err error) {
+	switch {
+	case params.Prefix != "":
+		match = func(key string) bool {
+			_, host, uri := util.ParseIdentity(key)
+			if params.Host != "" && params.Host != host {
+				return false
+			}
+			return strings.HasPrefix(uri, params.Prefix)
+		}
+	case params.Regexp != "":
+		reg, e := regexp.Compile(params.Regexp)
+		if e != nil {
+			err = hes.Wrap(e)
+			return
+		}
+		// 不包括key策略添加的请求头与cookie，使以$结尾的正则表达式可匹配
+		match = func(key string) bool {
+			return reg.MatchString(util.TrimIdentitySuffix(key))
+		}
+	default:
+		err = hes.New("key, prefix or regexp is required")
+	}
+	return
+}
+
+// purgeCaches purge the caches by params(key, tag, prefix, regexp or ban),
+// returns the count of removed
+func purgeCaches(dispatchers *cache.Dispatchers, params *purgeCacheParams) (count int, err error) {
+	if params.Cache != "" && dispatchers.Get(params.Cache) == nil {
+		err = hes.New(params.Cache + " of caches is not exists")
+		return
+	}
+	var match func(key string) bool
+	switch {
+	case params.Ban != "":
+		_, e := regexp.Compile(params.Ban)
+		if e != nil {
+			err = hes.Wrap(e)
+			return
+		}
+	case params.Key == "" && params.Tag == "":
+		match, err = newPurgeCacheMatcher(params)
+		if err != nil {
+			return
+		}
+	}
+	dispatchers.ForEach(func(name string, d *cache.Dispatcher) {
+		if params.Cache != "" && params.Cache != name {
+			return
+		}
+		switch {
+		case params.Ban != "":
+			// 正则表达式已校验，ban的缓存在获取时才失效，因此不统计数量
+			_ = d.Ban(params.Host, params.Ban)
+		case params.Tag != "":
+			count += d.PurgeByTag(params.Tag)
+		case match == nil:
+			count += d.Purge(params.Key)
+		default:
+			count += d.PurgeBy(match)
+		}
+	})
+	return
+}
+
+// doPurge purge the caches of current node and publish to other nodes
+func doPurge(c *elton.Context, dispatchers *cache.Dispatchers, publisher *purgePublisher, params *purgeCacheParams) (err error) {
+	count, err := purgeCaches(dispatchers, params)
+	if err != nil {
+		return
+	}
+	result := &purgeResult{
+		Count: count,
+	}
+	if publisher != nil {
+		wait, e := getPurgeWait(c.QueryParam("wait"))
+		if e != nil {
+			err = hes.Wrap(e)
+			return
+		}
+		result, err = publisher.publish(params, count, wait)
+		if err != nil {
+			return
+		}
+	}
+	c.Body = result
+	return
+}
+
+func newPurgeCacheHandler(dispatchers *cache.Dispatchers, publisher *purgePublisher) elton.Handler {
+	return func(c *elton.Context) (err error) {
+		params := &purgeCacheParams{}
+		err = doValidate(params, c.RequestBody)
+		if err != nil {
+			return
+		}
+		return doPurge(c, dispatchers, publisher, params)
+	}
+}
+
+func newPurgeCacheByTagHandler(dispatchers *cache.Dispatchers, publisher *purgePublisher) elton.Handler {
+	return func(c *elton.Context) (err error) {
+		return doPurge(c, dispatchers, publisher, &purgeCacheParams{
+			Tag: c.Param("tag"),
+			// 可指定仅清除某个缓存
+			Cache: c.QueryParam("cache"),
+		})
+	}
+}
+
+// getDispatcher get the dispatcher of the name param
+func getDispatcher(c *elton.Context, dispatchers *cache.Dispatchers) (d *cache.Dispatcher, err error) {
+	name := c.Param("name")
+	d = dispatchers.Get(name)
+	if d == nil {
+		err = hes.NewWithStatusCode(name+" of caches is not exists", http.StatusNotFound)
+	}
+	return
+}
+
+// getIntQueryParam get the int value of query param, returns the default value if it's empty
+func getIntQueryParam(c *elton.Context, name string, defaultValue, max int) (value int, err error) {
+	v := c.QueryParam(name)
+	if v == "" {
+		return defaultValue, nil
+	}
+	value, err = strconv.Atoi(v)
+	if err != nil || value < 0 || value > max {
+		err = hes.New(name + " should be an integer between 0 and " + strconv.Itoa(max))
+	}
+	return
+}
+
+func newListCacheHandler(dispatchers *cache.Dispatchers) elton.Handler {
+	return func(c *elton.Context) (err error) {
+		d, err := getDispatcher(c, dispatchers)
+		if err != nil {
+			return
+		}
+		offset, err := getIntQueryParam(c, "offset", 0, math.MaxInt32)
+		if err != nil {
+			return
+		}
+		limit, err := getIntQueryParam(c, "limit", 20, 100)
+		if err != nil {
+			return
+		}
+		infos, count := d.List(c.QueryParam("prefix"), offset, limit)
+		c.Body = map[string]interface{}{
+			"caches": infos,
+			"count":  count,
+		}
+		return
+	}
+}
+
+func newCacheCountersHandler(dispatchers *cache.Dispatchers) elton.Handler {
+	return func(c *elton.Context) (err error) {
+		d, err := getDispatcher(c, dispatchers)
+		if err != nil {
+			return
+		}
+		c.Body = d.Counters()
+		return
+	}
+}
+
+func newSaveCacheSnapshotHandler(dispatchers *cache.Dispatchers) elton.Handler {
+	return func(c *elton.Context) (err error) {
+		d, err := getDispatcher(c, dispatchers)
+		if err != nil {
+			return
+		}
+		if d.SnapshotPath == "" {
+			err = hes.New("snapshot path of cache is not set")
+			return
+		}
+		count, err := d.SaveSnapshot(d.SnapshotPath)
+		if err != nil {
+			err = hes.Wrap(err)
+			return
+		}
+		c.Body = map[string]int{
+			"count": count,
+		}
+		return
+	}
+}
+
+func newInspectCacheHandler(dispatchers *cache.Dispatchers) elton.Handler {
+	return func(c *elton.Context) (err error) {
+		d, err := getDispatcher(c, dispatchers)
+		if err != nil {
+			return
+		}
+		key := c.QueryParam("key")
+		if key == "" {
+			err = hes.New("key is required")
+			return
+		}
+		info := d.Inspect(key, c.QueryParam("header") == "true")
+		if info == nil {
+			err = hes.NewWithStatusCode(key+" is not exists", http.StatusNotFound)
+			return
+		}
+		c.Body = info
+		return
+	}
+}
+
 func newGetConfigHandler(cfg *config.Config) elton.Handler {
 	return func(c *elton.Context) (err error) {
 		var data interface{}
@@ -94,6 +332,8 @@ func newGetConfigHandler(cfg *config.Config) elton.Handler {
 				data, err = cfg.GetInfluxdb()
 			case config.AlarmsCategory:
 				data, err = cfg.GetAlarms()
+			case config.ClusterCategory:
+				data, err = cfg.GetCluster()
 			default:
 				err = hes.New(category + " is not support")
 			}
@@ -130,6 +370,8 @@ func newCreateOrUpdateConfigHandler(cfg *config.Config) elton.Handler {
 			iconfig = cfg.NewInfluxdbConfig()
 		case config.AlarmsCategory:
 			iconfig = cfg.NewAlarmConfig("")
+		case config.ClusterCategory:
+			iconfig = cfg.NewClusterConfig()
 		default:
 			err = hes.New(category + " is not support")
 			return
@@ -190,6 +432,8 @@ func newDeleteConfigHandler(cfg *config.Config) elton.Handler {
 			iconfig = cfg.NewInfluxdbConfig()
 		case config.AlarmsCategory:
 			iconfig = cfg.NewAlarmConfig(name)
+		case config.ClusterCategory:
+			iconfig = cfg.NewClusterConfig()
 		default:
 			err = hes.New(category + " is not support")
 			return
@@ -304,6 +548,24 @@ func NewAdmin(opts *ServerOptions) (string, *elton.Elton) {
 		return nil
 	})
 
+	// 获取缓存的使用情况
+	g.GET("/caches", func(c *elton.Context) error {
+		c.Body = opts.dispatchers.Stats()
+		return nil
+	})
+	// 清除缓存
+	g.POST("/caches/purge", newPurgeCacheHandler(opts.dispatchers, opts.publisher))
+	// 按标签清除缓存
+	g.DELETE("/caches/tags/:tag", newPurgeCacheByTagHandler(opts.dispatchers, opts.publisher))
+	// 分页获取缓存列表
+	g.GET("/caches/:name/keys", newListCacheHandler(opts.dispatchers))
+	// 获取单个缓存的信息
+	g.GET("/caches/:name/key", newInspectCacheHandler(opts.dispatchers))
+	// 获取缓存的统计计数（命中、淘汰等）
+	g.GET("/caches/:name/counters", newCacheCountersHandler(opts.dispatchers))
+	// 保存缓存快照
+	g.POST("/caches/:name/snapshot", newSaveCacheSnapshotHandler(opts.dispatchers))
+
 	// 上传
 	g.POST("/upload", func(c *elton.Context) (err error) {
 		file, fileHeader, err := c.Request.FormFile("file")
@@ -15,14 +15,19 @@
 package server
 
 import (
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/vicanso/elton"
 	"github.com/vicanso/hes"
+	"github.com/vicanso/pike/cache"
 	"github.com/vicanso/pike/config"
+	"github.com/vicanso/pike/util"
 )
 
 func TestNewAdminValidateMiddlewares(t *testing.T) {
@@ -96,6 +101,274 @@ func TestNewAdminValidateMiddlewares(t *testing.T) {
 	})
 }
 
+func TestPurgeCacheHandler(t *testing.T) {
+	assert := assert.New(t)
+	dispatchers := cache.NewDispatchers(config.Caches{
+		&config.Cache{
+			Name: "a",
+		},
+		&config.Cache{
+			Name: "b",
+		},
+	})
+	keys := []string{
+		"GET aslant.site /users/v1/me",
+		"GET aslant.site /users/v1/me?type=vip",
+		"HEAD aslant.site /users/v1/me",
+		"GET tiny.aslant.site /users/v1/me",
+		"GET aslant.site /books/v1",
+	}
+	init := func() {
+		dispatchers.ForEach(func(_ string, d *cache.Dispatcher) {
+			for _, key := range keys {
+				d.GetHTTPCache([]byte(key))
+			}
+		})
+	}
+	fn := newPurgeCacheHandler(dispatchers, nil)
+	purge := func(requestBody string) (int, error) {
+		c := elton.NewContext(nil, nil)
+		c.RequestBody = []byte(requestBody)
+		err := fn(c)
+		if err != nil {
+			return 0, err
+		}
+		return c.Body.(*purgeResult).Count, nil
+	}
+
+	t.Run("purge by key", func(t *testing.T) {
+		init()
+		count, err := purge(`{"key": "GET aslant.site /users/v1/me"}`)
+		assert.Nil(err)
+		assert.Equal(2, count)
+
+		count, err = purge(`{"key": "GET aslant.site /users/v1/me?type=vip", "cache": "a"}`)
+		assert.Nil(err)
+		assert.Equal(1, count)
+		assert.Equal(3, dispatchers.Get("a").Stats().Entries)
+		assert.Equal(4, dispatchers.Get("b").Stats().Entries)
+	})
+
+	t.Run("purge by prefix", func(t *testing.T) {
+		init()
+		count, err := purge(`{"prefix": "/users"}`)
+		assert.Nil(err)
+		assert.Equal(8, count)
+
+		init()
+		count, err = purge(`{"prefix": "/users", "host": "tiny.aslant.site", "cache": "b"}`)
+		assert.Nil(err)
+		assert.Equal(1, count)
+	})
+
+	t.Run("purge by regexp", func(t *testing.T) {
+		init()
+		count, err := purge(`{"regexp": "^HEAD "}`)
+		assert.Nil(err)
+		assert.Equal(2, count)
+
+		_, err = purge(`{"regexp": "("}`)
+		assert.NotNil(err)
+	})
+
+	t.Run("ban", func(t *testing.T) {
+		key := []byte("GET aslant.site /books/v1")
+		hc := dispatchers.Get("b").GetHTTPCache(key)
+		hc.Cachable(60, &cache.HTTPData{})
+		count, err := purge(`{"ban": "^/books/", "host": "aslant.site", "cache": "b"}`)
+		assert.Nil(err)
+		assert.Equal(0, count)
+		// 在ban之前创建的缓存获取时失效
+		assert.False(hc == dispatchers.Get("b").GetHTTPCache(key))
+
+		_, err = purge(`{"ban": "("}`)
+		assert.NotNil(err)
+	})
+
+	t.Run("purge with key policy", func(t *testing.T) {
+		policy := &util.IdentityPolicy{
+			Headers: []string{"X-Device"},
+			Cookies: []string{"lang"},
+		}
+		policyKeys := make([]string, 0)
+		for _, device := range []string{"mobile", "tablet pad"} {
+			req := httptest.NewRequest("GET", "/users/v1/me", nil)
+			req.Host = "aslant.site"
+			req.Header.Set("X-Device", device)
+			req.AddCookie(&http.Cookie{
+				Name:  "lang",
+				Value: "zh",
+			})
+			policyKeys = append(policyKeys, string(policy.GetIdentity(req)))
+		}
+		initPolicyKeys := func() {
+			for _, key := range policyKeys {
+				dispatchers.Get("a").GetHTTPCache([]byte(key)).Cachable(60, &cache.HTTPData{})
+			}
+		}
+
+		initPolicyKeys()
+		count, err := purge(`{"prefix": "/users/v1/me", "host": "aslant.site", "cache": "a"}`)
+		assert.Nil(err)
+		assert.Equal(len(policyKeys)+2, count)
+
+		initPolicyKeys()
+		count, err = purge(`{"regexp": "^GET aslant.site /users/v1/me$", "cache": "a"}`)
+		assert.Nil(err)
+		assert.Equal(len(policyKeys), count)
+
+		// ban的正则表达式仅匹配uri
+		initPolicyKeys()
+		assert.Nil(dispatchers.Get("a").Ban("aslant.site", "^/users/v1/me$"))
+		assert.Equal(len(policyKeys), dispatchers.Get("a").RemoveExpired())
+	})
+
+	t.Run("invalid params", func(t *testing.T) {
+		_, err := purge(`{}`)
+		assert.NotNil(err)
+
+		_, err = purge(`{"key": "GET aslant.site /", "cache": "c"}`)
+		assert.NotNil(err)
+	})
+}
+
+func TestPurgeCacheByTagHandler(t *testing.T) {
+	assert := assert.New(t)
+	dispatchers := cache.NewDispatchers(config.Caches{
+		&config.Cache{
+			Name: "a",
+		},
+		&config.Cache{
+			Name: "b",
+		},
+	})
+	dispatchers.ForEach(func(_ string, d *cache.Dispatcher) {
+		for _, key := range []string{"GET aslant.site /products/1", "GET aslant.site /products/2"} {
+			d.GetHTTPCache([]byte(key))
+			d.AddTags([]byte(key), "products")
+		}
+	})
+	fn := newPurgeCacheByTagHandler(dispatchers, nil)
+
+	req := httptest.NewRequest("DELETE", "/caches/tags/products?cache=a", nil)
+	c := elton.NewContext(nil, req)
+	c.Params = map[string]string{
+		"tag": "products",
+	}
+	err := fn(c)
+	assert.Nil(err)
+	assert.Equal(2, c.Body.(*purgeResult).Count)
+
+	req = httptest.NewRequest("DELETE", "/caches/tags/products", nil)
+	c = elton.NewContext(nil, req)
+	c.Params = map[string]string{
+		"tag": "products",
+	}
+	err = fn(c)
+	assert.Nil(err)
+	assert.Equal(2, c.Body.(*purgeResult).Count)
+
+	req = httptest.NewRequest("DELETE", "/caches/tags/products?cache=c", nil)
+	c = elton.NewContext(nil, req)
+	err = fn(c)
+	assert.NotNil(err)
+}
+
+func TestInspectCacheHandler(t *testing.T) {
+	assert := assert.New(t)
+	dispatchers := cache.NewDispatchers(config.Caches{
+		&config.Cache{
+			Name: "a",
+		},
+	})
+	d := dispatchers.Get("a")
+	for _, key := range []string{"GET aslant.site /books/1", "GET aslant.site /books/2", "GET aslant.site /users/1"} {
+		header := make(http.Header)
+		header.Set("Content-Type", "application/json")
+		d.GetHTTPCache([]byte(key)).Cachable(60, &cache.HTTPData{
+			Headers:  cache.NewHTTPHeaders(header),
+			RawBody:  []byte("abcd"),
+			GzipBody: []byte("ab"),
+		})
+	}
+	newContext := func(url, name string) *elton.Context {
+		c := elton.NewContext(nil, httptest.NewRequest("GET", url, nil))
+		c.Params = map[string]string{
+			"name": name,
+		}
+		return c
+	}
+
+	t.Run("list", func(t *testing.T) {
+		fn := newListCacheHandler(dispatchers)
+		c := newContext("/caches/a/keys?prefix=GET%20aslant.site%20/books/&limit=1&offset=1", "a")
+		err := fn(c)
+		assert.Nil(err)
+		data := c.Body.(map[string]interface{})
+		assert.Equal(2, data["count"])
+		infos := data["caches"].([]*cache.HTTPCacheInfo)
+		assert.Equal(1, len(infos))
+		assert.Equal("GET aslant.site /books/2", infos[0].Key)
+		assert.Equal("cacheable", infos[0].Status)
+		assert.Equal(4, infos[0].RawSize)
+		assert.Equal(2, infos[0].GzipSize)
+		assert.Equal([]string{"Content-Type"}, infos[0].Headers)
+		assert.Nil(infos[0].Header)
+
+		c = newContext("/caches/a/keys?limit=1000", "a")
+		assert.NotNil(fn(c))
+
+		c = newContext("/caches/b/keys", "b")
+		assert.NotNil(fn(c))
+	})
+
+	t.Run("inspect", func(t *testing.T) {
+		fn := newInspectCacheHandler(dispatchers)
+		c := newContext("/caches/a/key?key=GET%20aslant.site%20/users/1&header=true", "a")
+		err := fn(c)
+		assert.Nil(err)
+		info := c.Body.(*cache.HTTPCacheInfo)
+		assert.Equal("GET aslant.site /users/1", info.Key)
+		assert.Equal("application/json", info.Header.Get("Content-Type"))
+		assert.True(info.TTL > 0)
+
+		c = newContext("/caches/a/key?key=GET%20aslant.site%20/users/2", "a")
+		err = fn(c)
+		assert.NotNil(err)
+		assert.Equal(http.StatusNotFound, err.(*hes.Error).StatusCode)
+	})
+
+	t.Run("counters", func(t *testing.T) {
+		fn := newCacheCountersHandler(dispatchers)
+		c := newContext("/caches/a/counters", "a")
+		err := fn(c)
+		assert.Nil(err)
+		stats := c.Body.(*cache.CountersStats)
+		assert.Equal(uint64(3), stats.Store)
+		assert.Equal(uint64(0), stats.Hit)
+
+		c = newContext("/caches/b/counters", "b")
+		assert.NotNil(fn(c))
+	})
+
+	t.Run("snapshot", func(t *testing.T) {
+		fn := newSaveCacheSnapshotHandler(dispatchers)
+		c := newContext("/caches/a/snapshot", "a")
+		// 未设置快照路径
+		assert.NotNil(fn(c))
+
+		dir, err := ioutil.TempDir("", "pike-snapshot")
+		assert.Nil(err)
+		defer os.RemoveAll(dir)
+		d.SnapshotPath = filepath.Join(dir, "a.snapshot")
+		err = fn(c)
+		assert.Nil(err)
+		assert.Equal(3, c.Body.(map[string]int)["count"])
+		_, err = os.Stat(d.SnapshotPath)
+		assert.Nil(err)
+	})
+}
+
 func TestConfigHandler(t *testing.T) {
 	cfg := config.NewTestConfig()
 	createOrUpdateConfig := newCreateOrUpdateConfigHandler(cfg)
@@ -15,17 +15,34 @@
 package server
 
 import (
+	"context"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/vicanso/elton"
+	"github.com/vicanso/hes"
 	"github.com/vicanso/pike/cache"
+	"github.com/vicanso/pike/cluster"
 	"github.com/vicanso/pike/config"
+	"github.com/vicanso/pike/log"
 	"github.com/vicanso/pike/util"
+	"go.uber.org/zap"
 )
 
 const (
 	headerStatusKey = "X-Status"
+	headerWarning   = "Warning"
+
+	staleIfErrorWarning = `111 pike "Revalidation Failed"`
+)
+
+var (
+	errWaitTimeout = &hes.Error{
+		StatusCode: http.StatusGatewayTimeout,
+		Message:    "Wait for fetching timeout",
+	}
 )
 
 func requestIsPass(req *http.Request) bool {
@@ -33,83 +50,146 @@ func requestIsPass(req *http.Request) bool {
 	return method != http.MethodGet && method != http.MethodHead
 }
 
-// 根据Cache-Control的信息，获取s-maxage 或者max-age的值
-func getCacheAge(header http.Header) int {
-	// 如果有设置cookie，则为不可缓存
-	if len(header.Get(elton.HeaderSetCookie)) != 0 {
-		return 0
+// getFreshness get the freshness of response for caching, the TTL is 0 if it isn't cacheable.
+// The defaultTTL is used if the response doesn't have Cache-Control and Expires,
+// and the cache rule of location takes precedence over the Cache-Control of response.
+func getFreshness(header http.Header, defaultTTL int, rule *config.LocationCacheRule) *cache.Freshness {
+	f := cache.GetFreshness(header, time.Now())
+	// 响应未指定缓存有效期，则使用默认的有效期（如按状态码配置的404、502缓存）
+	if defaultTTL > 0 &&
+		len(header[elton.HeaderCacheControl]) == 0 &&
+		header.Get(headerExpires) == "" {
+		f.TTL = defaultTTL
+	}
+	if rule != nil {
+		switch rule.Action {
+		case config.CacheRuleActionForce:
+			f.TTL = rule.TTL
+		case config.CacheRuleActionMax:
+			if f.TTL > rule.TTL {
+				f.TTL = rule.TTL
+			}
+		case config.CacheRuleActionPass:
+			f.TTL = 0
+		}
+		// 删除Set-Cookie后再缓存
+		if rule.StripCookie && !util.ContainesString(f.IgnoreFields, elton.HeaderSetCookie) {
+			f.IgnoreFields = append(f.IgnoreFields, elton.HeaderSetCookie)
+		}
 	}
-	// 如果没有设置cache-control，则不可缓存
-	cc := header.Get(elton.HeaderCacheControl)
-	if len(cc) == 0 {
-		return 0
+	// 如果有设置cookie（且未指定该字段不可缓存），则为不可缓存
+	if len(header.Get(elton.HeaderSetCookie)) != 0 &&
+		!util.ContainesString(f.IgnoreFields, elton.HeaderSetCookie) {
+		f.TTL = 0
 	}
-
-	// 如果设置不可缓存，返回0
-	match := noCacheReg.MatchString(cc)
-	if match {
-		return 0
+	// 如果vary为*，则不可缓存
+	vary := cache.ParseVary(header)
+	if len(vary) != 0 && vary[0] == "*" {
+		f.TTL = 0
 	}
-	// 优先从s-maxage中获取
-	var maxAge = 0
-	result := sMaxAgeReg.FindStringSubmatch(cc)
-	if len(result) == 2 {
-		maxAge, _ = strconv.Atoi(result[1])
-	} else {
-		// 从max-age中获取缓存时间
-		result = maxAgeReg.FindStringSubmatch(cc)
-		if len(result) == 2 {
-			maxAge, _ = strconv.Atoi(result[1])
-		}
+	return f
+}
+
+// getFreshnessHeader get the response header for freshness, the Date of upstream
+// response is cleared by proxy, so it is added back for calculating the age
+func getFreshnessHeader(c *elton.Context) http.Header {
+	date := c.GetString(upstreamDateKey)
+	if date == "" || c.Headers.Get(headerDate) != "" {
+		return c.Headers
 	}
+	header := c.Headers.Clone()
+	header.Set(headerDate, date)
+	return header
+}
+
+// discardResponseWriter the response writer of background request, all data will be discarded
+type discardResponseWriter struct {
+	header http.Header
+}
+
+func (w *discardResponseWriter) Header() http.Header {
+	return w.header
+}
 
-	// 如果有设置了 age 字段，则最大缓存时长减少
-	age := header.Get(headerAge)
-	if age != "" {
-		v, _ := strconv.Atoi(age)
-		maxAge -= v
+func (w *discardResponseWriter) Write(buf []byte) (int, error) {
+	return len(buf), nil
+}
+
+func (w *discardResponseWriter) WriteHeader(_ int) {}
+
+// getCacheKey get the cache key of request with the key policy of location
+func getCacheKey(l *config.Location, req *http.Request) []byte {
+	if l == nil {
+		return util.GetIdentity(req)
 	}
+	return l.KeyPolicy.GetIdentity(req)
+}
 
-	return maxAge
+// getCacheRule get the cache rule of matched location for the response
+func getCacheRule(c *elton.Context) *config.LocationCacheRule {
+	v, ok := c.Get(locationKey)
+	if !ok {
+		return nil
+	}
+	l, _ := v.(*config.Location)
+	if l == nil {
+		return nil
+	}
+	// 以请求的url path匹配（proxy的rewrite有可能修改url）
+	path := c.Request.RequestURI
+	if index := strings.IndexByte(path, '?'); index != -1 {
+		path = path[:index]
+	}
+	return l.GetCacheRule(path, c.GetHeader(elton.HeaderContentType), c.StatusCode)
 }
 
-// newCacheDispatchMiddleware create a cache dispatch middleware
-func newCacheDispatchMiddleware(dispatcher *cache.Dispatcher, compress *config.Compress, generateEtag bool) elton.Handler {
+// newCacheDispatchMiddleware create a cache dispatch middleware,
+// the cache key is generated by the key policy of matched location,
+// the fetcher is used to revalidate the stale cache in background,
+// and the peer is used to share the http cache with the owner node of cluster.
+func newCacheDispatchMiddleware(dispatcher *cache.Dispatcher, locations config.Locations, compress *config.Compress, generateEtag bool, fetcher elton.Handler, peer *cluster.Peer) elton.Handler {
 
 	compressHandler := createCompressHandler(compress)
-	return func(c *elton.Context) (err error) {
-		status := cache.StatusUnknown
-		cacheable := false
-		passed := false
-		var httpData *cache.HTTPData
-		var httpCache *cache.HTTPCache
-		// 如果设置了dispatcher，而且不是pass类的请求
-		// 则表示有可能可缓存请求
-		if dispatcher != nil && !requestIsPass(c.Request) {
-			key := util.GetIdentity(c.Request)
-			httpCache = dispatcher.GetHTTPCache(key)
 
-			status, httpData = httpCache.Get()
-			c.Set(statusKey, status)
-			// 如果获取到缓存，则直接返回
-			if status == cache.StatusCacheable {
-				httpData.SetResponse(c)
-				// 设置Age
-				age := httpCache.Age()
-				if age > 0 {
-					c.SetHeader(headerAge, strconv.Itoa(age))
-				}
-				c.SetHeader(headerStatusKey, cache.StatusString(status))
-				return
+	// 根据响应头设置缓存的相关参数并保存缓存
+	save := func(c *elton.Context, httpCache *cache.HTTPCache, headers http.Header, freshness *cache.Freshness, httpData *cache.HTTPData, tags []string) {
+		cacheAge := freshness.TTL
+		// 响应未指定时使用默认配置，如果需要重新校验（如must-revalidate）则不使用默认配置
+		staleWhileRevalidate := freshness.StaleWhileRevalidate
+		if staleWhileRevalidate == -1 {
+			staleWhileRevalidate = 0
+			if !freshness.MustRevalidate {
+				staleWhileRevalidate = dispatcher.StaleWhileRevalidate
+			}
+		}
+		staleIfError := freshness.StaleIfError
+		if staleIfError == -1 {
+			staleIfError = 0
+			if !freshness.MustRevalidate {
+				staleIfError = dispatcher.StaleIfError
 			}
-			c.SetHeader(headerStatusKey, cache.StatusString(status))
-			c.Set(httpCacheKey, httpCache)
-		} else {
-			passed = true
-			c.Set(statusKey, cache.StatusPassed)
-			c.SetHeader(headerStatusKey, cache.StatusString(cache.StatusPassed))
 		}
+		// no-cache与private指定的字段不缓存
+		httpData.DelHeaders(freshness.IgnoreFields...)
+		vary := cache.ParseVary(headers)
+		// 响应有vary，则记录vary并将数据保存至对应的variant
+		if len(vary) != 0 {
+			httpCache = httpCache.Vary(cacheAge, vary, c.Request.Header)
+		}
+		httpCache.SetStaleWhileRevalidate(staleWhileRevalidate)
+		httpCache.SetStaleIfError(staleIfError)
+		httpCache.Cachable(cacheAge, httpData)
+		key := c.GetString(cacheKeyKey)
+		if len(tags) != 0 {
+			dispatcher.AddTags([]byte(key), tags...)
+		}
+		// 推送至集群中该key所属的节点
+		peer.Push(key)
+	}
 
+	// 调用next获取数据，并根据响应数据设置缓存状态
+	fetch := func(c *elton.Context, status int, httpCache *cache.HTTPCache, next func() error) (err error) {
+		cacheable := false
 		// 对于fetching类的请求，如果最终是不可缓存的，则设置hit for pass
 		if status == cache.StatusFetching {
 			defer func() {
@@ -119,13 +199,64 @@ func newCacheDispatchMiddleware(dispatcher *cache.Dispatcher, compress *config.C
 			}()
 		}
 
-		err = c.Next()
+		err = next()
+		// 如果获取数据失败（出错或响应5xx），而缓存有可用的过期数据，则使用过期数据
+		if status == cache.StatusFetching &&
+			(err != nil || c.StatusCode >= http.StatusInternalServerError) {
+			httpData := httpCache.FallbackToStale()
+			if httpData != nil {
+				log.Default().Warn("fetch fail, use stale cache",
+					zap.String("host", c.Request.Host),
+					zap.String("url", c.Request.RequestURI),
+					zap.Int("statusCode", c.StatusCode),
+					zap.Error(err),
+				)
+				cacheable = true
+				for key := range c.Headers {
+					delete(c.Headers, key)
+				}
+				httpData.SetResponse(c)
+				c.SetHeader(headerStatusKey, cache.StatusString(cache.StatusStale))
+				c.SetHeader(headerWarning, staleIfErrorWarning)
+				return nil
+			}
+		}
 		if err != nil {
 			return
 		}
 
 		// 执行proxy成功之后
 		headers := c.Headers
+		// surrogate key仅用于缓存，不返回给客户端
+		var tags []string
+		if dispatcher != nil {
+			tags = strings.Fields(headers.Get(dispatcher.SurrogateKeyHeader))
+			headers.Del(dispatcher.SurrogateKeyHeader)
+		}
+		// 条件请求的响应为304，则使用已缓存的数据，仅刷新响应头与缓存有效期
+		if status == cache.StatusFetching && c.StatusCode == http.StatusNotModified {
+			if data := httpCache.Data(); data != nil {
+				httpData := data.Refresh(headers)
+				// 以缓存的状态码与响应头计算有效期（range请求设置响应后状态码为206）
+				for key := range c.Headers {
+					delete(c.Headers, key)
+				}
+				for key, values := range httpData.Header() {
+					c.Headers[key] = values
+				}
+				c.StatusCode = httpData.StatusCode
+				freshness := getFreshness(getFreshnessHeader(c), dispatcher.StatusTTL[c.StatusCode], getCacheRule(c))
+				for key := range c.Headers {
+					delete(c.Headers, key)
+				}
+				httpData.SetResponse(c)
+				if freshness.TTL != 0 {
+					cacheable = true
+					save(c, httpCache, c.Headers, freshness, httpData, tags)
+				}
+				return
+			}
+		}
 		encoding := headers.Get(elton.HeaderContentEncoding)
 		var body []byte
 		if c.BodyBuffer != nil {
@@ -147,23 +278,119 @@ func newCacheDispatchMiddleware(dispatcher *cache.Dispatcher, compress *config.C
 		}
 
 		// 如果是fetching状态的，在成功获取数据后，要根据返回数据设置缓存状态
-		cacheAge := 0
 		// 如果是pass的请求，都不可以缓存
-		if !passed {
-			if status == cache.StatusFetching {
-				cacheAge = getCacheAge(c.Headers)
-			}
+		var freshness *cache.Freshness
+		if status == cache.StatusFetching {
+			freshness = getFreshness(getFreshnessHeader(c), dispatcher.StatusTTL[c.StatusCode], getCacheRule(c))
 			// 缓存时长大于0
-			if cacheAge != 0 {
-				cacheable = true
-			}
+			cacheable = freshness.TTL != 0
 		}
 
-		httpData = compressHandler(c, cacheable)
+		httpData := compressHandler(c, cacheable)
 		if cacheable {
-			httpCache.Cachable(cacheAge, httpData)
+			save(c, httpCache, headers, freshness, httpData, tags)
+			// range请求则根据缓存数据返回部分内容
+			if c.GetRequestHeader(cache.HeaderRange) != "" {
+				httpData.SetResponse(c)
+			}
 		}
-
 		return
 	}
+
+	// 在后台重新获取数据刷新缓存
+	revalidate := func(c *elton.Context, httpCache *cache.HTTPCache) {
+		req := c.Request.Clone(context.Background())
+		bc := elton.NewContext(&discardResponseWriter{
+			header: make(http.Header),
+		}, req)
+		bc.Set(statusKey, cache.StatusFetching)
+		bc.Set(httpCacheKey, httpCache)
+		bc.Set(cacheKeyKey, c.GetString(cacheKeyKey))
+		if l, ok := c.Get(locationKey); ok {
+			bc.Set(locationKey, l)
+		}
+		go func() {
+			err := fetch(bc, cache.StatusFetching, httpCache, func() error {
+				return fetcher(bc)
+			})
+			if err != nil {
+				log.Default().Error("revalidate cache fail",
+					zap.String("host", req.Host),
+					zap.String("url", req.RequestURI),
+					zap.Error(err),
+				)
+			}
+		}()
+	}
+
+	// 直接转发至upstream，不使用缓存
+	pass := func(c *elton.Context) error {
+		status := cache.StatusPassed
+		dispatcher.AddPass()
+		c.Set(statusKey, status)
+		c.SetHeader(headerStatusKey, cache.StatusString(status))
+		return fetch(c, status, nil, c.Next)
+	}
+
+	return func(c *elton.Context) (err error) {
+		status := cache.StatusUnknown
+		var httpData *cache.HTTPData
+		var httpCache *cache.HTTPCache
+		// 如果设置了dispatcher，而且不是pass类的请求
+		// 则表示有可能可缓存请求
+		if dispatcher != nil && !requestIsPass(c.Request) {
+			l := locations.GetMatch(c.Request.Host, c.Request.RequestURI)
+			key := getCacheKey(l, c.Request)
+			c.Set(cacheKeyKey, string(key))
+			if l != nil {
+				c.Set(locationKey, l)
+			}
+			// 未达到准入条件（请求次数不足）则不创建缓存，直接转发
+			if !dispatcher.Admit(key) {
+				return pass(c)
+			}
+			// 如果该缓存已记录vary，则根据请求头获取对应的缓存
+			httpCache = dispatcher.GetHTTPCache(key).GetVariant(c.Request.Header)
+
+			status, httpData, err = httpCache.GetWithTimeout(dispatcher.WaitTimeout)
+			if err == cache.ErrWaitTimeout {
+				// 等待超时，根据配置直接转发至upstream或返回504
+				if !dispatcher.WaitTimeoutPass {
+					return errWaitTimeout
+				}
+				return pass(c)
+			}
+			// 缓存不存在时，先从集群中该key所属的节点获取
+			if status == cache.StatusFetching && peer.Fill(string(key), httpCache) {
+				status = cache.StatusCacheable
+				httpData = httpCache.Data()
+			}
+			c.Set(statusKey, status)
+			// 如果获取到缓存（或可使用的过期缓存），则直接返回
+			if status == cache.StatusCacheable || status == cache.StatusStale {
+				httpData.SetResponse(c)
+				// 设置Age
+				age := httpCache.Age()
+				if age > 0 {
+					c.SetHeader(headerAge, strconv.Itoa(age))
+				}
+				c.SetHeader(headerStatusKey, cache.StatusString(status))
+				// 过期缓存仅由一个请求触发刷新
+				if status == cache.StatusStale && fetcher != nil && httpCache.Revalidate() {
+					revalidate(c, httpCache)
+				}
+				return
+			}
+			c.SetHeader(headerStatusKey, cache.StatusString(status))
+			c.Set(httpCacheKey, httpCache)
+		} else {
+			status = cache.StatusPassed
+			if dispatcher != nil {
+				dispatcher.AddPass()
+			}
+			c.Set(statusKey, status)
+			c.SetHeader(headerStatusKey, cache.StatusString(status))
+		}
+		return fetch(c, status, httpCache, c.Next)
+	}
 }
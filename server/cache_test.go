@@ -18,12 +18,17 @@ import (
 	"bytes"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/vicanso/elton"
 	"github.com/vicanso/pike/cache"
+	"github.com/vicanso/pike/cluster"
 	"github.com/vicanso/pike/config"
+	"github.com/vicanso/pike/util"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -42,28 +47,92 @@ func TestRequestIsPass(t *testing.T) {
 	assert.True(requestIsPass(req))
 }
 
-func TestGetCacheAge(t *testing.T) {
+func TestGetFreshness(t *testing.T) {
 	assert := assert.New(t)
 	h := make(http.Header)
 
 	h.Set(elton.HeaderSetCookie, "abc")
-	assert.Equal(0, getCacheAge(h))
+	h.Set(elton.HeaderCacheControl, "public, max-age=10")
+	assert.Equal(0, getFreshness(h, 0, nil).TTL)
+	// 指定Set-Cookie不可缓存，则可缓存其它数据
+	h.Set(elton.HeaderCacheControl, `public, max-age=10, no-cache="Set-Cookie"`)
+	assert.Equal(10, getFreshness(h, 0, nil).TTL)
 	h.Del(elton.HeaderSetCookie)
+	h.Del(elton.HeaderCacheControl)
 
-	assert.Equal(0, getCacheAge(h))
+	assert.Equal(0, getFreshness(h, 0, nil).TTL)
 
 	h.Set(elton.HeaderCacheControl, "no-cache")
-	assert.Equal(0, getCacheAge(h))
+	assert.Equal(0, getFreshness(h, 0, nil).TTL)
 
 	h.Set(elton.HeaderCacheControl, "public, max-age=10, s-maxage=2")
-	assert.Equal(2, getCacheAge(h))
+	assert.Equal(2, getFreshness(h, 0, nil).TTL)
 
 	h.Set(elton.HeaderCacheControl, "public, max-age=10")
-	assert.Equal(10, getCacheAge(h))
+	assert.Equal(10, getFreshness(h, 0, nil).TTL)
 
 	h.Set(headerAge, "2")
-	assert.Equal(8, getCacheAge(h))
+	assert.Equal(8, getFreshness(h, 0, nil).TTL)
+
+	// age超出有效期
+	h.Set(headerAge, "20")
+	assert.Equal(0, getFreshness(h, 0, nil).TTL)
+
+	h.Set("Vary", "*")
+	assert.Equal(0, getFreshness(h, 0, nil).TTL)
+	h.Del("Vary")
+	h.Del(headerAge)
+
+	// 未指定Cache-Control与Expires时使用默认有效期
+	h.Del(elton.HeaderCacheControl)
+	assert.Equal(30, getFreshness(h, 30, nil).TTL)
+	h.Set(headerExpires, "0")
+	assert.Equal(0, getFreshness(h, 30, nil).TTL)
+	h.Del(headerExpires)
+	h.Set(elton.HeaderCacheControl, "no-store")
+	assert.Equal(0, getFreshness(h, 30, nil).TTL)
+
+	// 缓存规则优先于Cache-Control
+	h.Set(elton.HeaderCacheControl, "private")
+	assert.Equal(60, getFreshness(h, 0, &config.LocationCacheRule{
+		Action: config.CacheRuleActionForce,
+		TTL:    60,
+	}).TTL)
+	h.Set(elton.HeaderCacheControl, "public, max-age=600")
+	assert.Equal(60, getFreshness(h, 0, &config.LocationCacheRule{
+		Action: config.CacheRuleActionMax,
+		TTL:    60,
+	}).TTL)
+	assert.Equal(0, getFreshness(h, 0, &config.LocationCacheRule{
+		Action: config.CacheRuleActionPass,
+	}).TTL)
+
+	// 有Set-Cookie时需要指定删除才可缓存
+	h.Set(elton.HeaderSetCookie, "abc")
+	rule := &config.LocationCacheRule{
+		Action: config.CacheRuleActionForce,
+		TTL:    60,
+	}
+	assert.Equal(0, getFreshness(h, 0, rule).TTL)
+	rule.StripCookie = true
+	f := getFreshness(h, 0, rule)
+	assert.Equal(60, f.TTL)
+	assert.Equal([]string{elton.HeaderSetCookie}, f.IgnoreFields)
+}
+
+func TestGetFreshnessHeader(t *testing.T) {
+	assert := assert.New(t)
+	c := elton.NewContext(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	c.SetHeader(elton.HeaderCacheControl, "public, max-age=60")
+	assert.Equal(c.Headers, getFreshnessHeader(c))
 
+	date := time.Now().Add(-10 * time.Second).UTC().Format(http.TimeFormat)
+	c.Set(upstreamDateKey, date)
+	header := getFreshnessHeader(c)
+	assert.Equal(date, header.Get(headerDate))
+	// 不修改响应头
+	assert.Empty(c.GetHeader(headerDate))
+	assert.Equal(50, getFreshness(header, 0, nil).TTL)
 }
 
 func TestCacheDispatchMiddleware(t *testing.T) {
@@ -78,7 +147,15 @@ func TestCacheDispatchMiddleware(t *testing.T) {
 		Filter:    "text|json|javascript",
 		MinLength: 1,
 	}
-	fn := newCacheDispatchMiddleware(dispatcher, compressConfig, true)
+	fetchCount := int32(0)
+	fetcher := func(c *elton.Context) error {
+		atomic.AddInt32(&fetchCount, 1)
+		c.SetHeader(elton.HeaderCacheControl, "public, max-age=10")
+		c.SetHeader(elton.HeaderContentType, "text/plain")
+		c.BodyBuffer = bytes.NewBufferString("revalidated")
+		return nil
+	}
+	fn := newCacheDispatchMiddleware(dispatcher, nil, compressConfig, true, fetcher, nil)
 
 	t.Run("no cache", func(t *testing.T) {
 		assert := assert.New(t)
@@ -158,6 +235,282 @@ func TestCacheDispatchMiddleware(t *testing.T) {
 		assert.Equal(elton.Br, c.GetHeader(elton.HeaderContentEncoding))
 	})
 
+	t.Run("revalidate not modified", func(t *testing.T) {
+		assert := assert.New(t)
+		url := "https://aslant.site/not-modified"
+		header := make(http.Header)
+		header.Set(elton.HeaderCacheControl, "public, max-age=10")
+		header.Set(elton.HeaderContentType, "text/plain")
+		header.Set(elton.HeaderETag, `"123"`)
+		// 已过期的缓存
+		dispatcher.GetHTTPCache(util.GetIdentity(httptest.NewRequest("GET", url, nil))).Cachable(-1, &cache.HTTPData{
+			StatusCode: http.StatusOK,
+			Headers:    cache.NewHTTPHeaders(header),
+			RawBody:    []byte("abcd"),
+		})
+
+		count := 0
+		newContext := func() *elton.Context {
+			c := elton.NewContext(httptest.NewRecorder(), httptest.NewRequest("GET", url, nil))
+			c.Next = func() error {
+				count++
+				c.StatusCode = http.StatusNotModified
+				c.SetHeader(elton.HeaderCacheControl, "public, max-age=60")
+				c.SetHeader("X-Version", "2")
+				return nil
+			}
+			return c
+		}
+		c := newContext()
+		err := fn(c)
+		assert.Nil(err)
+		assert.Equal(1, count)
+		assert.Equal(cache.StatusFetching, c.GetInt(statusKey))
+		// 304时使用缓存的数据并更新响应头
+		assert.Equal(http.StatusOK, c.StatusCode)
+		assert.Equal("abcd", c.BodyBuffer.String())
+		assert.Equal(`"123"`, c.GetHeader(elton.HeaderETag))
+		assert.Equal("public, max-age=60", c.GetHeader(elton.HeaderCacheControl))
+		assert.Equal("2", c.GetHeader("X-Version"))
+
+		// 缓存已刷新
+		c = newContext()
+		err = fn(c)
+		assert.Nil(err)
+		assert.Equal(1, count)
+		assert.Equal(cache.StatusCacheable, c.GetInt(statusKey))
+		assert.Equal("abcd", c.BodyBuffer.String())
+		assert.Equal("2", c.GetHeader("X-Version"))
+	})
+
+	t.Run("no-cache field", func(t *testing.T) {
+		assert := assert.New(t)
+		count := 0
+		newContext := func() *elton.Context {
+			req := httptest.NewRequest("GET", "https://aslant.site/no-cache-field", nil)
+			c := elton.NewContext(httptest.NewRecorder(), req)
+			c.Next = func() error {
+				count++
+				c.SetHeader(elton.HeaderCacheControl, `public, max-age=10, no-cache="Set-Cookie"`)
+				c.SetHeader(elton.HeaderSetCookie, "jt=abcd")
+				c.SetHeader(elton.HeaderContentType, "text/plain")
+				c.BodyBuffer = bytes.NewBufferString("abcd")
+				return nil
+			}
+			return c
+		}
+		c := newContext()
+		err := fn(c)
+		assert.Nil(err)
+		assert.Equal(1, count)
+		assert.Equal("jt=abcd", c.GetHeader(elton.HeaderSetCookie))
+
+		// 缓存的数据中不包括Set-Cookie
+		c = newContext()
+		err = fn(c)
+		assert.Nil(err)
+		assert.Equal(1, count)
+		assert.Equal(cache.StatusCacheable, c.GetInt(statusKey))
+		assert.Empty(c.GetHeader(elton.HeaderSetCookie))
+		assert.Equal("abcd", c.BodyBuffer.String())
+	})
+
+	t.Run("range", func(t *testing.T) {
+		assert := assert.New(t)
+		count := 0
+		newContext := func() *elton.Context {
+			req := httptest.NewRequest("GET", "https://aslant.site/download", nil)
+			req.Header.Set(cache.HeaderRange, "bytes=0-3")
+			c := elton.NewContext(httptest.NewRecorder(), req)
+			c.Next = func() error {
+				count++
+				c.StatusCode = http.StatusOK
+				c.CacheMaxAge("10s")
+				c.SetHeader(elton.HeaderContentType, "application/octet-stream")
+				c.BodyBuffer = bytes.NewBufferString("0123456789")
+				return nil
+			}
+			return c
+		}
+		// 首次请求获取完整数据缓存后返回部分内容
+		c := newContext()
+		err := fn(c)
+		assert.Nil(err)
+		assert.Equal(1, count)
+		assert.Equal(http.StatusPartialContent, c.StatusCode)
+		assert.Equal("0123", c.BodyBuffer.String())
+		assert.Equal("bytes 0-3/10", c.GetHeader("Content-Range"))
+
+		c = newContext()
+		err = fn(c)
+		assert.Nil(err)
+		assert.Equal(1, count)
+		assert.Equal(cache.StatusCacheable, c.GetInt(statusKey))
+		assert.Equal(http.StatusPartialContent, c.StatusCode)
+		assert.Equal("0123", c.BodyBuffer.String())
+		assert.Equal("bytes", c.GetHeader("Accept-Ranges"))
+	})
+
+	t.Run("vary", func(t *testing.T) {
+		assert := assert.New(t)
+		count := 0
+		newContext := func(lang string) *elton.Context {
+			req := httptest.NewRequest("GET", "https://aslant.site/i18n", nil)
+			req.Header.Set("Accept-Language", lang)
+			c := elton.NewContext(httptest.NewRecorder(), req)
+			c.Next = func() error {
+				count++
+				c.CacheMaxAge("10s")
+				c.SetHeader("Vary", "Accept-Language")
+				c.SetHeader(elton.HeaderContentType, "text/plain")
+				c.BodyBuffer = bytes.NewBufferString(lang)
+				return nil
+			}
+			return c
+		}
+
+		c := newContext("zh")
+		err := fn(c)
+		assert.Nil(err)
+		assert.Equal(1, count)
+		assert.Equal(cache.StatusFetching, c.GetInt(statusKey))
+
+		// 不同的语言需要重新获取
+		c = newContext("en")
+		err = fn(c)
+		assert.Nil(err)
+		assert.Equal(2, count)
+		assert.Equal(cache.StatusFetching, c.GetInt(statusKey))
+
+		c = newContext("zh")
+		err = fn(c)
+		assert.Nil(err)
+		assert.Equal(2, count)
+		assert.Equal(cache.StatusCacheable, c.GetInt(statusKey))
+		assert.Equal("zh", c.BodyBuffer.String())
+
+		c = newContext("en")
+		err = fn(c)
+		assert.Nil(err)
+		assert.Equal(2, count)
+		assert.Equal(cache.StatusCacheable, c.GetInt(statusKey))
+		assert.Equal("en", c.BodyBuffer.String())
+	})
+
+	t.Run("surrogate key", func(t *testing.T) {
+		assert := assert.New(t)
+		count := 0
+		newContext := func() *elton.Context {
+			req := httptest.NewRequest("GET", "https://aslant.site/products/123", nil)
+			c := elton.NewContext(httptest.NewRecorder(), req)
+			c.Next = func() error {
+				count++
+				c.CacheMaxAge("10s")
+				c.SetHeader(cache.DefaultSurrogateKeyHeader, "product:123  products")
+				c.SetHeader(elton.HeaderContentType, "text/plain")
+				c.BodyBuffer = bytes.NewBufferString("product")
+				return nil
+			}
+			return c
+		}
+		c := newContext()
+		err := fn(c)
+		assert.Nil(err)
+		assert.Equal(1, count)
+		// surrogate key不返回给客户端
+		assert.Empty(c.GetHeader(cache.DefaultSurrogateKeyHeader))
+
+		c = newContext()
+		err = fn(c)
+		assert.Nil(err)
+		assert.Equal(1, count)
+		assert.Equal(cache.StatusCacheable, c.GetInt(statusKey))
+		assert.Empty(c.GetHeader(cache.DefaultSurrogateKeyHeader))
+
+		// 按标签清除后需要重新获取
+		assert.Equal(1, dispatcher.PurgeByTag("products"))
+		c = newContext()
+		err = fn(c)
+		assert.Nil(err)
+		assert.Equal(2, count)
+		assert.Equal(cache.StatusFetching, c.GetInt(statusKey))
+	})
+
+	t.Run("stale while revalidate", func(t *testing.T) {
+		assert := assert.New(t)
+		newContext := func() *elton.Context {
+			req := httptest.NewRequest("GET", "https://aslant.site/stale", nil)
+			c := elton.NewContext(httptest.NewRecorder(), req)
+			c.Next = func() error {
+				c.SetHeader(elton.HeaderCacheControl, "public, max-age=1, stale-while-revalidate=10")
+				c.SetHeader(elton.HeaderContentType, "text/plain")
+				c.BodyBuffer = bytes.NewBufferString("original")
+				return nil
+			}
+			return c
+		}
+		c := newContext()
+		err := fn(c)
+		assert.Nil(err)
+		assert.Equal(cache.StatusFetching, c.GetInt(statusKey))
+
+		// 缓存过期后返回过期数据，并在后台刷新
+		time.Sleep(2100 * time.Millisecond)
+		c = newContext()
+		err = fn(c)
+		assert.Nil(err)
+		assert.Equal(cache.StatusStale, c.GetInt(statusKey))
+		assert.Equal("stale", c.GetHeader(headerStatusKey))
+		assert.Equal("original", c.BodyBuffer.String())
+
+		time.Sleep(10 * time.Millisecond)
+		assert.Equal(int32(1), atomic.LoadInt32(&fetchCount))
+		c = newContext()
+		err = fn(c)
+		assert.Nil(err)
+		assert.Equal(cache.StatusCacheable, c.GetInt(statusKey))
+		assert.Equal("revalidated", c.BodyBuffer.String())
+	})
+
+	t.Run("stale if error", func(t *testing.T) {
+		assert := assert.New(t)
+		newContext := func(fail bool) *elton.Context {
+			req := httptest.NewRequest("GET", "https://aslant.site/stale-if-error", nil)
+			c := elton.NewContext(httptest.NewRecorder(), req)
+			c.Next = func() error {
+				if fail {
+					return errServiceUnavailable
+				}
+				c.SetHeader(elton.HeaderCacheControl, "public, max-age=1, stale-if-error=10")
+				c.SetHeader(elton.HeaderContentType, "text/plain")
+				c.BodyBuffer = bytes.NewBufferString("original")
+				return nil
+			}
+			return c
+		}
+		c := newContext(false)
+		err := fn(c)
+		assert.Nil(err)
+		assert.Equal(cache.StatusFetching, c.GetInt(statusKey))
+
+		// 缓存过期后获取数据失败，使用过期数据
+		time.Sleep(2100 * time.Millisecond)
+		c = newContext(true)
+		err = fn(c)
+		assert.Nil(err)
+		assert.Equal(cache.StatusFetching, c.GetInt(statusKey))
+		assert.Equal("stale", c.GetHeader(headerStatusKey))
+		assert.Equal(staleIfErrorWarning, c.GetHeader(headerWarning))
+		assert.Equal("original", c.BodyBuffer.String())
+
+		// 再次获取数据成功则更新缓存
+		c = newContext(false)
+		err = fn(c)
+		assert.Nil(err)
+		assert.Equal(cache.StatusFetching, c.GetInt(statusKey))
+		assert.Empty(c.GetHeader(headerWarning))
+	})
+
 	t.Run("pass", func(t *testing.T) {
 		assert := assert.New(t)
 		req := httptest.NewRequest("POST", "https://aslant.site/users/login", nil)
@@ -190,4 +543,379 @@ func TestCacheDispatchMiddleware(t *testing.T) {
 		assert.NotEmpty(c.GetHeader(elton.HeaderETag))
 		assert.Equal(elton.Gzip, c.GetHeader(elton.HeaderContentEncoding))
 	})
+
+	t.Run("admission", func(t *testing.T) {
+		assert := assert.New(t)
+		dispatcher := cache.NewDispatcher(&config.Cache{
+			Size:      1,
+			Zone:      10,
+			Admission: 2,
+		})
+		fn := newCacheDispatchMiddleware(dispatcher, nil, compressConfig, false, nil, nil)
+		count := 0
+		newContext := func() *elton.Context {
+			req := httptest.NewRequest("GET", "https://aslant.site/books", nil)
+			c := elton.NewContext(httptest.NewRecorder(), req)
+			c.Next = func() error {
+				count++
+				c.CacheMaxAge("10s")
+				c.SetHeader(elton.HeaderContentType, "text/plain")
+				c.BodyBuffer = bytes.NewBufferString("books")
+				return nil
+			}
+			return c
+		}
+		// 第一次请求未达到准入次数，直接转发且不缓存
+		c := newContext()
+		assert.Nil(fn(c))
+		assert.Equal(1, count)
+		assert.Equal(cache.StatusPassed, c.GetInt(statusKey))
+		assert.Equal(0, dispatcher.Stats().Entries)
+
+		c = newContext()
+		assert.Nil(fn(c))
+		assert.Equal(2, count)
+		assert.Equal(cache.StatusFetching, c.GetInt(statusKey))
+
+		c = newContext()
+		assert.Nil(fn(c))
+		assert.Equal(2, count)
+		assert.Equal(cache.StatusCacheable, c.GetInt(statusKey))
+		assert.Equal(uint64(1), dispatcher.Counters().Rejection)
+	})
+
+	t.Run("cluster peer", func(t *testing.T) {
+		assert := assert.New(t)
+		newDispatchers := func() *cache.Dispatchers {
+			return cache.NewDispatchers(config.Caches{
+				{
+					Name: "default",
+				},
+			})
+		}
+		var owner *cluster.Cluster
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			owner.ServeHTTP(w, req)
+		}))
+		defer ts.Close()
+		ownerAddr := strings.TrimPrefix(ts.URL, "http://")
+		owner = cluster.New(cluster.Options{
+			Self:  ownerAddr,
+			Token: "token",
+		})
+		ownerDispatchers := newDispatchers()
+		owner.SetDispatchers(ownerDispatchers)
+
+		c := cluster.New(cluster.Options{
+			Self:  "127.0.0.1:1",
+			Peers: []string{ownerAddr},
+			Token: "token",
+		})
+		// 获取属于owner节点的url
+		url := ""
+		for i := 0; url == ""; i++ {
+			u := "https://aslant.site/books/" + strconv.Itoa(i)
+			key := string(util.GetIdentity(httptest.NewRequest("GET", u, nil)))
+			if addr, _ := c.Owner(key); addr == ownerAddr {
+				url = u
+			}
+		}
+		key := string(util.GetIdentity(httptest.NewRequest("GET", url, nil)))
+
+		count := 0
+		next := func(ctx *elton.Context) func() error {
+			return func() error {
+				count++
+				ctx.SetHeader(elton.HeaderCacheControl, "public, max-age=60")
+				ctx.BodyBuffer = bytes.NewBufferString("book")
+				return nil
+			}
+		}
+
+		// owner无缓存时从upstream获取，并推送至owner
+		dispatcher := newDispatchers().Get("default")
+		fn := newCacheDispatchMiddleware(dispatcher, nil, compressConfig, true, nil, c.Peer("default", dispatcher))
+		ctx := elton.NewContext(httptest.NewRecorder(), httptest.NewRequest("GET", url, nil))
+		ctx.Next = next(ctx)
+		assert.Nil(fn(ctx))
+		assert.Equal(1, count)
+		for i := 0; i < 100 && ownerDispatchers.Get("default").Inspect(key, false) == nil; i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+		assert.NotNil(ownerDispatchers.Get("default").Inspect(key, false))
+
+		// 其它节点从owner获取缓存
+		dispatcher = newDispatchers().Get("default")
+		fn = newCacheDispatchMiddleware(dispatcher, nil, compressConfig, true, nil, c.Peer("default", dispatcher))
+		ctx = elton.NewContext(httptest.NewRecorder(), httptest.NewRequest("GET", url, nil))
+		ctx.Next = next(ctx)
+		assert.Nil(fn(ctx))
+		assert.Equal(1, count)
+		assert.Equal(cache.StatusCacheable, ctx.GetInt(statusKey))
+		assert.Equal("book", ctx.BodyBuffer.String())
+		// 已保存至本节点
+		assert.NotNil(dispatcher.Inspect(key, false))
+	})
+
+	t.Run("wait timeout", func(t *testing.T) {
+		assert := assert.New(t)
+		dispatcher := cache.NewDispatcher(&config.Cache{
+			Size:        10,
+			Zone:        10,
+			HitForPass:  30,
+			WaitTimeout: 10 * time.Millisecond,
+		})
+		fn := newCacheDispatchMiddleware(dispatcher, nil, compressConfig, true, nil, nil)
+		url := "https://aslant.site/users/wait"
+		// 模拟正在获取数据
+		req := httptest.NewRequest("GET", url, nil)
+		dispatcher.GetHTTPCache(util.GetIdentity(req)).Get()
+
+		c := elton.NewContext(httptest.NewRecorder(), req)
+		count := 0
+		c.Next = func() error {
+			count++
+			return nil
+		}
+		err := fn(c)
+		assert.Equal(errWaitTimeout, err)
+		assert.Equal(0, count)
+
+		// 超时后直接转发
+		dispatcher.WaitTimeoutPass = true
+		c = elton.NewContext(httptest.NewRecorder(), httptest.NewRequest("GET", url, nil))
+		c.Next = func() error {
+			count++
+			c.SetHeader(elton.HeaderContentType, "text/plain")
+			c.BodyBuffer = bytes.NewBufferString("abcd")
+			return nil
+		}
+		err = fn(c)
+		assert.Nil(err)
+		assert.Equal(1, count)
+		assert.Equal(cache.StatusPassed, c.GetInt(statusKey))
+		assert.Equal("abcd", c.BodyBuffer.String())
+	})
+
+	t.Run("key policy", func(t *testing.T) {
+		assert := assert.New(t)
+		locations := config.Locations{
+			&config.Location{
+				Prefixs: []string{
+					"/products",
+				},
+				KeyPolicy: &util.IdentityPolicy{
+					IgnoreQuery: []string{
+						"utm_*",
+					},
+					SortQuery: true,
+				},
+			},
+		}
+		fn := newCacheDispatchMiddleware(dispatcher, locations, compressConfig, true, nil, nil)
+		count := 0
+		newContext := func(url string) *elton.Context {
+			req := httptest.NewRequest("GET", url, nil)
+			req.Host = "aslant.site"
+			c := elton.NewContext(httptest.NewRecorder(), req)
+			c.Next = func() error {
+				count++
+				c.CacheMaxAge("10s")
+				c.SetHeader(elton.HeaderContentType, "text/plain")
+				c.BodyBuffer = bytes.NewBufferString("products")
+				return nil
+			}
+			return c
+		}
+		c := newContext("/products?page=1&id=2&utm_source=a")
+		err := fn(c)
+		assert.Nil(err)
+		assert.Equal(1, count)
+		assert.Equal(cache.StatusFetching, c.GetInt(statusKey))
+
+		// 忽略utm参数并排序后为相同的缓存
+		c = newContext("/products?id=2&page=1&utm_medium=b")
+		err = fn(c)
+		assert.Nil(err)
+		assert.Equal(1, count)
+		assert.Equal(cache.StatusCacheable, c.GetInt(statusKey))
+		assert.NotNil(dispatcher.Inspect("GET aslant.site /products?id=2&page=1", false))
+	})
+
+	t.Run("upstream date", func(t *testing.T) {
+		assert := assert.New(t)
+		url := "https://aslant.site/upstream-date"
+		c := elton.NewContext(httptest.NewRecorder(), httptest.NewRequest("GET", url, nil))
+		c.Next = func() error {
+			c.SetHeader(elton.HeaderCacheControl, "public, max-age=60")
+			c.SetHeader(elton.HeaderContentType, "text/plain")
+			// 与proxy相同，响应头中的Date已清除
+			c.Set(upstreamDateKey, time.Now().Add(-20*time.Second).UTC().Format(http.TimeFormat))
+			c.BodyBuffer = bytes.NewBufferString("date")
+			return nil
+		}
+		err := fn(c)
+		assert.Nil(err)
+		info := dispatcher.Inspect(string(util.GetIdentity(c.Request)), false)
+		assert.NotNil(info)
+		// 有效期减去upstream响应的已存在时长
+		assert.True(info.TTL <= 40 && info.TTL >= 39)
+	})
+
+	t.Run("status ttl", func(t *testing.T) {
+		assert := assert.New(t)
+		dispatcher := cache.NewDispatcher(&config.Cache{
+			Size:       1,
+			Zone:       10,
+			HitForPass: 30,
+			StatusTTL: []string{
+				"404:30s",
+			},
+		})
+		fn := newCacheDispatchMiddleware(dispatcher, nil, compressConfig, true, nil, nil)
+		count := 0
+		newContext := func(url string, statusCode int) *elton.Context {
+			req := httptest.NewRequest("GET", url, nil)
+			c := elton.NewContext(httptest.NewRecorder(), req)
+			c.Next = func() error {
+				count++
+				c.StatusCode = statusCode
+				c.SetHeader(elton.HeaderContentType, "text/plain")
+				c.BodyBuffer = bytes.NewBufferString("not found")
+				return nil
+			}
+			return c
+		}
+		// 404且未设置Cache-Control，使用配置的有效期缓存
+		c := newContext("/not-found", http.StatusNotFound)
+		err := fn(c)
+		assert.Nil(err)
+		c = newContext("/not-found", http.StatusNotFound)
+		err = fn(c)
+		assert.Nil(err)
+		assert.Equal(1, count)
+		assert.Equal(cache.StatusCacheable, c.GetInt(statusKey))
+		assert.Equal(http.StatusNotFound, c.StatusCode)
+		assert.Equal("not found", c.BodyBuffer.String())
+
+		// 未配置的状态码则为hit for pass
+		count = 0
+		c = newContext("/error", http.StatusBadGateway)
+		err = fn(c)
+		assert.Nil(err)
+		c = newContext("/error", http.StatusBadGateway)
+		err = fn(c)
+		assert.Nil(err)
+		assert.Equal(2, count)
+		assert.Equal(cache.StatusHitForPass, c.GetInt(statusKey))
+	})
+
+	t.Run("status ttl of not modified range", func(t *testing.T) {
+		assert := assert.New(t)
+		dispatcher := cache.NewDispatcher(&config.Cache{
+			Size:       1,
+			Zone:       10,
+			HitForPass: 30,
+			StatusTTL: []string{
+				"200:30s",
+			},
+		})
+		fn := newCacheDispatchMiddleware(dispatcher, nil, compressConfig, true, nil, nil)
+		url := "/not-modified-range"
+		header := make(http.Header)
+		header.Set(elton.HeaderContentType, "application/octet-stream")
+		// 已过期的缓存
+		dispatcher.GetHTTPCache(util.GetIdentity(httptest.NewRequest("GET", url, nil))).Cachable(-1, &cache.HTTPData{
+			StatusCode: http.StatusOK,
+			Headers:    cache.NewHTTPHeaders(header),
+			RawBody:    []byte("0123456789"),
+		})
+		count := 0
+		newContext := func() *elton.Context {
+			req := httptest.NewRequest("GET", url, nil)
+			req.Header.Set(cache.HeaderRange, "bytes=0-3")
+			c := elton.NewContext(httptest.NewRecorder(), req)
+			c.Next = func() error {
+				count++
+				c.StatusCode = http.StatusNotModified
+				return nil
+			}
+			return c
+		}
+		c := newContext()
+		err := fn(c)
+		assert.Nil(err)
+		assert.Equal(http.StatusPartialContent, c.StatusCode)
+		assert.Equal("0123", c.BodyBuffer.String())
+
+		// 以200的有效期刷新缓存
+		c = newContext()
+		err = fn(c)
+		assert.Nil(err)
+		assert.Equal(1, count)
+		assert.Equal(cache.StatusCacheable, c.GetInt(statusKey))
+		assert.Equal(http.StatusPartialContent, c.StatusCode)
+		assert.Equal("0123", c.BodyBuffer.String())
+	})
+
+	t.Run("cache rules", func(t *testing.T) {
+		assert := assert.New(t)
+		locations := config.Locations{
+			&config.Location{
+				Prefixs: []string{
+					"/rules",
+				},
+				CacheRules: []config.LocationCacheRule{
+					{
+						Path:        "^/rules/static/",
+						ContentType: "text",
+						Action:      config.CacheRuleActionForce,
+						TTL:         60,
+						StripCookie: true,
+					},
+				},
+			},
+		}
+		fn := newCacheDispatchMiddleware(dispatcher, locations, compressConfig, true, nil, nil)
+		count := 0
+		newContext := func(url string, statusCode int) *elton.Context {
+			req := httptest.NewRequest("GET", url, nil)
+			req.Host = "aslant.site"
+			c := elton.NewContext(httptest.NewRecorder(), req)
+			c.Next = func() error {
+				count++
+				c.StatusCode = statusCode
+				c.CacheMaxAge("10s")
+				c.SetHeader(elton.HeaderCacheControl, "private")
+				c.SetHeader(elton.HeaderSetCookie, "jt=abcd")
+				c.SetHeader(elton.HeaderContentType, "text/plain")
+				c.BodyBuffer = bytes.NewBufferString("rules")
+				return nil
+			}
+			return c
+		}
+
+		// 强制缓存并删除Set-Cookie
+		c := newContext("/rules/static/a.txt?v=1", http.StatusOK)
+		err := fn(c)
+		assert.Nil(err)
+		assert.Equal(1, count)
+		c = newContext("/rules/static/a.txt?v=1", http.StatusOK)
+		err = fn(c)
+		assert.Nil(err)
+		assert.Equal(1, count)
+		assert.Equal(cache.StatusCacheable, c.GetInt(statusKey))
+		assert.Empty(c.GetHeader(elton.HeaderSetCookie))
+
+		// 未匹配规则则按响应头处理
+		count = 0
+		c = newContext("/rules/api", http.StatusOK)
+		err = fn(c)
+		assert.Nil(err)
+		c = newContext("/rules/api", http.StatusOK)
+		err = fn(c)
+		assert.Nil(err)
+		assert.Equal(2, count)
+		assert.Equal(cache.StatusHitForPass, c.GetInt(statusKey))
+	})
 }
@@ -16,7 +16,6 @@ package server
 
 import (
 	"net/http"
-	"regexp"
 	"strconv"
 	"strings"
 	"sync/atomic"
@@ -34,17 +33,19 @@ import (
 const (
 	statusKey    = "status"
 	httpCacheKey = "httpCache"
+	// 缓存的key（proxy有可能修改请求的host，因此在获取缓存时保存）
+	cacheKeyKey = "cacheKey"
+	// 缓存请求匹配的location，用于获取其缓存规则
+	locationKey = "location"
+	// upstream响应的Date（响应头中的Date会被清除），用于计算缓存有效期
+	upstreamDateKey = "upstreamDate"
 
 	// 默认的 admin 目录
 	defaultAdminPath = "/pike"
 
-	headerAge = "Age"
-)
-
-var (
-	noCacheReg = regexp.MustCompile(`no-cache|no-store|private`)
-	sMaxAgeReg = regexp.MustCompile(`s-maxage=(\d+)`)
-	maxAgeReg  = regexp.MustCompile(`max-age=(\d+)`)
+	headerAge     = "Age"
+	headerDate    = "Date"
+	headerExpires = "Expires"
 )
 
 var (
@@ -163,16 +164,29 @@ func NewElton(opts *ServerOptions) *elton.Elton {
 		})
 	}
 
+	// 支持PURGE与BAN请求
+	if opts.server.EnabledPurge {
+		e.Use(newPurgeMiddleware(dispatcher, opts.server.Cache, locations, opts.server.PurgeACL, opts.publisher))
+	}
+
 	e.Use(fresh.NewDefault())
 
+	proxyMid := createProxyMiddleware(locations, upstreams)
+
 	// get http cache
-	e.Use(newCacheDispatchMiddleware(dispatcher, opts.compress, opts.server.ETag))
+	e.Use(newCacheDispatchMiddleware(dispatcher, locations, opts.compress, opts.server.ETag, proxyMid, opts.peer))
 
 	// http request proxy
-	e.Use(createProxyMiddleware(locations, upstreams))
+	e.Use(proxyMid)
 
-	e.ALL("/*url", func(c *elton.Context) error {
+	noop := func(c *elton.Context) error {
 		return nil
-	})
+	}
+	e.ALL("/*url", noop)
+	// PURGE与BAN非标准的http method，需要单独添加路由
+	if opts.server.EnabledPurge {
+		e.Handle(methodPurge, "/*url", noop)
+		e.Handle(methodBan, "/*url", noop)
+	}
 	return e
 }
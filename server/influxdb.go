@@ -20,11 +20,19 @@ import (
 	"time"
 
 	influxdb "github.com/influxdata/influxdb-client-go"
+	"github.com/vicanso/pike/cache"
 	"github.com/vicanso/pike/config"
 	"github.com/vicanso/pike/log"
 	"go.uber.org/zap"
 )
 
+const (
+	// 缓存统计计数的measurement
+	cacheCountersMeasurement = "pike-cache"
+	// 缓存统计计数写入influxdb的间隔
+	cacheCountersInterval = "@every 1m"
+)
+
 type (
 	InfluxSrv struct {
 		client *influxdb.Client
@@ -72,6 +80,15 @@ func (srv *InfluxSrv) Write(measurement string, fields map[string]interface{}, t
 	}
 }
 
+// WriteCacheCounters write the counters of all dispatchers to influxdb
+func (srv *InfluxSrv) WriteCacheCounters(dispatchers *cache.Dispatchers) {
+	dispatchers.ForEach(func(name string, d *cache.Dispatcher) {
+		srv.Write(cacheCountersMeasurement, d.Counters().Fields(), map[string]string{
+			"cache": name,
+		})
+	})
+}
+
 // Flush flush metric list
 func (srv *InfluxSrv) Flush() {
 	srv.Lock()
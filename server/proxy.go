@@ -29,10 +29,14 @@ import (
 	"github.com/vicanso/pike/util"
 )
 
+const (
+	headerIfRange = "If-Range"
+)
+
 var (
 	// 需要清除的header
 	clearHeaders = []string{
-		"Date",
+		headerDate,
 		"Connection",
 		elton.HeaderContentLength,
 	}
@@ -84,6 +88,19 @@ func newProxyHandlers(locations config.Locations, upstreams *upstream.Upstreams)
 	return proxyMids
 }
 
+// getHTTPCacheValidators get the validators of http cache from context
+func getHTTPCacheValidators(c *elton.Context) (etag, lastModified string) {
+	v, ok := c.Get(httpCacheKey)
+	if !ok {
+		return
+	}
+	httpCache, _ := v.(*cache.HTTPCache)
+	if httpCache == nil {
+		return
+	}
+	return httpCache.Validators()
+}
+
 // createProxyMiddleware create proxy middleware handler
 func createProxyMiddleware(locations config.Locations, upstreams *upstream.Upstreams) elton.Handler {
 	proxyMids := newProxyHandlers(locations, upstreams)
@@ -123,7 +140,7 @@ func createProxyMiddleware(locations config.Locations, upstreams *upstream.Upstr
 		}
 
 		reqHeader := c.Request.Header
-		var ifModifiedSince, ifNoneMatch, acceptEncoding string
+		var ifModifiedSince, ifNoneMatch, acceptEncoding, rangeValue, ifRange string
 		status := c.GetInt(statusKey)
 		// 针对fetching的请求，由于其最终状态未知，因此需要删除有可能导致304的请求，避免无法生成缓存
 		if status == cache.StatusFetching {
@@ -136,6 +153,25 @@ func createProxyMiddleware(locations config.Locations, upstreams *upstream.Upstr
 			if ifNoneMatch != "" {
 				reqHeader.Del(elton.HeaderIfNoneMatch)
 			}
+			// 如果有过期的缓存，则使用其ETag与Last-Modified发送条件请求，
+			// 数据未修改时（304）仅需刷新缓存有效期
+			etag, lastModified := getHTTPCacheValidators(c)
+			if etag != "" {
+				reqHeader.Set(elton.HeaderIfNoneMatch, etag)
+			}
+			if lastModified != "" {
+				reqHeader.Set(elton.HeaderIfModifiedSince, lastModified)
+			}
+
+			// 获取完整的数据用于缓存，range请求由缓存数据生成
+			rangeValue = reqHeader.Get(cache.HeaderRange)
+			ifRange = reqHeader.Get(headerIfRange)
+			if rangeValue != "" {
+				reqHeader.Del(cache.HeaderRange)
+			}
+			if ifRange != "" {
+				reqHeader.Del(headerIfRange)
+			}
 
 			if strings.Contains(acceptEncoding, elton.Gzip) {
 				reqHeader.Set(elton.HeaderAcceptEncoding, elton.Gzip)
@@ -150,15 +186,29 @@ func createProxyMiddleware(locations config.Locations, upstreams *upstream.Upstr
 		if acceptEncoding != "" {
 			reqHeader.Set(elton.HeaderAcceptEncoding, acceptEncoding)
 		}
+		if status == cache.StatusFetching {
+			reqHeader.Del(elton.HeaderIfModifiedSince)
+			reqHeader.Del(elton.HeaderIfNoneMatch)
+		}
 		if ifModifiedSince != "" {
 			reqHeader.Set(elton.HeaderIfModifiedSince, ifModifiedSince)
 		}
 		if ifNoneMatch != "" {
 			reqHeader.Set(elton.HeaderIfNoneMatch, ifNoneMatch)
 		}
+		if rangeValue != "" {
+			reqHeader.Set(cache.HeaderRange, rangeValue)
+		}
+		if ifRange != "" {
+			reqHeader.Set(headerIfRange, ifRange)
+		}
 		if err != nil {
 			return
 		}
+		// Date在清除前保存，用于计算缓存有效期（Age未清除，可直接使用）
+		if date := c.GetHeader(headerDate); date != "" {
+			c.Set(upstreamDateKey, date)
+		}
 		for _, key := range clearHeaders {
 			// 清除header
 			c.SetHeader(key, "")
@@ -18,8 +18,10 @@ import (
 	"bytes"
 	"encoding/json"
 	"net"
+	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/vicanso/pike/cache"
 	"github.com/vicanso/pike/config"
@@ -43,12 +45,22 @@ func newTestProxyServer() (net.Listener, config.Locations, *upstream.Upstreams,
 		c.BodyBuffer = bytes.NewBufferString("hello world!")
 		return nil
 	})
+	// 响应已在upstream中缓存了20秒
+	e.GET("/date", func(c *elton.Context) error {
+		date := time.Now().Add(-20 * time.Second)
+		c.SetHeader(headerDate, date.UTC().Format(http.TimeFormat))
+		c.SetHeader(headerExpires, date.Add(80*time.Second).UTC().Format(http.TimeFormat))
+		c.CacheMaxAge("60s")
+		c.BodyBuffer = bytes.NewBufferString("date")
+		return nil
+	})
 	e.GET("/check", func(c *elton.Context) error {
 		m := map[string]string{
 			"Host":                      c.Request.Host,
 			elton.HeaderAcceptEncoding:  c.GetRequestHeader(elton.HeaderAcceptEncoding),
 			elton.HeaderIfModifiedSince: c.GetRequestHeader(elton.HeaderIfModifiedSince),
 			elton.HeaderIfNoneMatch:     c.GetRequestHeader(elton.HeaderIfNoneMatch),
+			cache.HeaderRange:           c.GetRequestHeader(cache.HeaderRange),
 			"X-Request-ID":              c.GetRequestHeader("X-Request-ID"),
 			"url":                       c.Request.URL.RequestURI(),
 		}
@@ -140,6 +152,7 @@ func TestCreateProxyMiddleware(t *testing.T) {
 		req.Header.Set(elton.HeaderAcceptEncoding, "br, gzip")
 		req.Header.Set(elton.HeaderIfModifiedSince, "date time")
 		req.Header.Set(elton.HeaderIfNoneMatch, "etag")
+		req.Header.Set(cache.HeaderRange, "bytes=0-1")
 
 		resp := httptest.NewRecorder()
 		c := elton.NewContext(resp, req)
@@ -156,10 +169,68 @@ func TestCreateProxyMiddleware(t *testing.T) {
 		assert.Equal("gzip", m[elton.HeaderAcceptEncoding])
 		assert.Empty(m[elton.HeaderIfModifiedSince])
 		assert.Empty(m[elton.HeaderIfNoneMatch])
+		assert.Empty(m[cache.HeaderRange])
+		assert.Equal("bytes=0-1", req.Header.Get(cache.HeaderRange))
 		assert.Equal("/check", m["url"])
 		assert.Equal("tiny.aslant.site", m["Host"])
 	})
 
+	t.Run("upstream date", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/api/date", nil)
+		req.Host = "aslant.site"
+		c := elton.NewContext(httptest.NewRecorder(), req)
+		c.Set(statusKey, cache.StatusFetching)
+		c.Next = func() error {
+			return nil
+		}
+		err = fn(c)
+		assert.Nil(err)
+		// Date从响应头中清除，但用于计算缓存有效期
+		assert.Empty(c.GetHeader(headerDate))
+		assert.NotEmpty(c.GetString(upstreamDateKey))
+		ttl := getFreshness(getFreshnessHeader(c), 0, nil).TTL
+		assert.True(ttl <= 40 && ttl >= 39)
+
+		// 仅有Expires时使用Expires与Date的差值
+		c.Headers.Del(elton.HeaderCacheControl)
+		ttl = getFreshness(getFreshnessHeader(c), 0, nil).TTL
+		assert.True(ttl <= 60 && ttl >= 59)
+	})
+
+	t.Run("revalidate request", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/api/check", nil)
+		req.Host = "aslant.site"
+		req.Header.Set(elton.HeaderIfNoneMatch, "etag")
+
+		header := make(http.Header)
+		header.Set(elton.HeaderETag, `"123"`)
+		header.Set(elton.HeaderLastModified, "Mon, 02 Jan 2006 15:04:05 GMT")
+		httpCache := cache.NewHTTPCache()
+		httpCache.Cachable(10, &cache.HTTPData{
+			Headers: cache.NewHTTPHeaders(header),
+			RawBody: []byte("abcd"),
+		})
+
+		resp := httptest.NewRecorder()
+		c := elton.NewContext(resp, req)
+		c.Set(statusKey, cache.StatusFetching)
+		c.Set(httpCacheKey, httpCache)
+		c.Next = func() error {
+			return nil
+		}
+		err = fn(c)
+		assert.Nil(err)
+		m := make(map[string]string)
+		err = json.Unmarshal(c.BodyBuffer.Bytes(), &m)
+		assert.Nil(err)
+		// 使用缓存的ETag与Last-Modified发送条件请求
+		assert.Equal(`"123"`, m[elton.HeaderIfNoneMatch])
+		assert.Equal("Mon, 02 Jan 2006 15:04:05 GMT", m[elton.HeaderIfModifiedSince])
+		// 恢复原有的请求头
+		assert.Equal("etag", req.Header.Get(elton.HeaderIfNoneMatch))
+		assert.Empty(req.Header.Get(elton.HeaderIfModifiedSince))
+	})
+
 	t.Run("pass requset", func(t *testing.T) {
 		req := httptest.NewRequest("GET", "/api/check", nil)
 		req.Host = "aslant.site"
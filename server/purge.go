@@ -0,0 +1,151 @@
+// Copyright 2020 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// 支持PURGE与BAN请求清除缓存（与varnish类似）
+
+package server
+
+import (
+	"bytes"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/vicanso/elton"
+	"github.com/vicanso/hes"
+	intranetip "github.com/vicanso/intranet-ip"
+	"github.com/vicanso/pike/cache"
+	"github.com/vicanso/pike/config"
+	"github.com/vicanso/pike/log"
+	"go.uber.org/zap"
+)
+
+const (
+	methodPurge = "PURGE"
+	methodBan   = "BAN"
+
+	// ban请求中指定匹配url的正则表达式，如果未指定则使用请求的url
+	headerBanURL = "X-Ban-Url"
+)
+
+var (
+	errPurgeForbidden = &hes.Error{
+		StatusCode: http.StatusForbidden,
+		Message:    "Not allow to purge",
+	}
+)
+
+// newPurgeACL create a function to check the ip is allowed to purge,
+// only the intranet ip is allowed if the cidrs is empty
+func newPurgeACL(cidrs []string) func(ip net.IP) bool {
+	if len(cidrs) == 0 {
+		return intranetip.Is
+	}
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			log.Default().Error("parse cidr of purge acl fail",
+				zap.String("cidr", cidr),
+				zap.Error(err),
+			)
+			continue
+		}
+		nets = append(nets, ipNet)
+	}
+	return func(ip net.IP) bool {
+		for _, ipNet := range nets {
+			if ipNet.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// getRemoteIP get the ip of connection, the X-Forwarded-For and X-Real-Ip
+// can be set by any client so they aren't used
+func getRemoteIP(req *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+	return net.ParseIP(host)
+}
+
+// newPurgeMiddleware create a middleware to handle PURGE and BAN requests,
+// the purge event is published to other nodes(without waiting for acks) if publisher is not nil
+func newPurgeMiddleware(dispatcher *cache.Dispatcher, name string, locations config.Locations, cidrs []string, publisher *purgePublisher) elton.Handler {
+	isAllowed := newPurgeACL(cidrs)
+	return func(c *elton.Context) (err error) {
+		req := c.Request
+		if req.Method != methodPurge && req.Method != methodBan {
+			return c.Next()
+		}
+		ip := getRemoteIP(req)
+		if ip == nil || !isAllowed(ip) {
+			err = errPurgeForbidden
+			return
+		}
+		count := 0
+		// 需要发布至其它节点的清除参数
+		events := make([]*purgeCacheParams, 0, 2)
+		if req.Method == methodPurge {
+			// 清除GET与HEAD的缓存
+			if dispatcher != nil {
+				for _, method := range []string{http.MethodGet, http.MethodHead} {
+					// 使用与缓存相同的key生成策略
+					r := req.Clone(req.Context())
+					r.Method = method
+					key := string(getCacheKey(locations.GetMatch(r.Host, r.RequestURI), r))
+					count += dispatcher.Purge(key)
+					events = append(events, &purgeCacheParams{
+						Cache: name,
+						Key:   key,
+					})
+				}
+			}
+		} else {
+			pattern := req.Header.Get(headerBanURL)
+			if pattern == "" {
+				pattern = req.RequestURI
+			}
+			if dispatcher != nil {
+				err = dispatcher.Ban(req.Host, pattern)
+				if err != nil {
+					err = hes.Wrap(err)
+					return
+				}
+				events = append(events, &purgeCacheParams{
+					Cache: name,
+					Host:  req.Host,
+					Ban:   pattern,
+				})
+			}
+		}
+		// 发布至其它节点，不等待确认
+		if publisher != nil {
+			for _, params := range events {
+				_, err = publisher.publish(params, count, 0)
+				if err != nil {
+					err = hes.Wrap(err)
+					return
+				}
+			}
+		}
+		c.SetContentTypeByExt(".json")
+		c.BodyBuffer = bytes.NewBufferString(`{"count":` + strconv.Itoa(count) + `}`)
+		return
+	}
+}
@@ -0,0 +1,212 @@
+// Copyright 2020 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// 清除缓存时发布事件至所有节点，各节点清除后写入确认信息，
+// 管理接口等待确认后返回已确认的节点
+
+package server
+
+import (
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/vicanso/pike/cache"
+	"github.com/vicanso/pike/config"
+	"github.com/vicanso/pike/log"
+	"github.com/vicanso/pike/util"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultPurgeWait = time.Second
+	maxPurgeWait     = 10 * time.Second
+	// 查询确认信息的间隔
+	purgeAckInterval = 100 * time.Millisecond
+)
+
+type (
+	// purgeResult the result of purge
+	purgeResult struct {
+		// Count the count of purged caches in current node
+		Count int `json:"count"`
+		// ID the id of purge event
+		ID string `json:"id,omitempty"`
+		// Acks the acknowledgements of nodes
+		Acks []*config.PurgeAck `json:"acks,omitempty"`
+	}
+	// purgePublisher publish the purge event to all nodes
+	purgePublisher struct {
+		cfg  *config.Config
+		node string
+		// nodes get the nodes which should acknowledge, empty means unknown
+		nodes func() []string
+	}
+)
+
+// getPurgeWait get the duration of waiting acks, the default is 1s and max is 10s
+func getPurgeWait(value string) (time.Duration, error) {
+	if value == "" {
+		return defaultPurgeWait, nil
+	}
+	wait, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	if wait < 0 {
+		wait = 0
+	}
+	if wait > maxPurgeWait {
+		wait = maxPurgeWait
+	}
+	return wait, nil
+}
+
+// getNodeName get the name of current node, hostname-pid is used if addr is empty
+func getNodeName(addr string) string {
+	if addr != "" {
+		return addr
+	}
+	hostname, _ := os.Hostname()
+	if hostname == "" {
+		hostname = util.RandomString(8)
+	}
+	return hostname + "-" + strconv.Itoa(os.Getpid())
+}
+
+// newPurgeEvent convert purge params to purge event
+func newPurgeEvent(node string, params *purgeCacheParams) *config.PurgeEvent {
+	return &config.PurgeEvent{
+		Node:   node,
+		Cache:  params.Cache,
+		Key:    params.Key,
+		Host:   params.Host,
+		Prefix: params.Prefix,
+		Regexp: params.Regexp,
+		Tag:    params.Tag,
+		Ban:    params.Ban,
+	}
+}
+
+// acked check all nodes are acknowledged
+func acked(nodes []string, acks []*config.PurgeAck) bool {
+	if len(nodes) == 0 {
+		return false
+	}
+	for _, node := range nodes {
+		found := false
+		for _, ack := range acks {
+			if ack.Node == node {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// publish publish the purge event(current node is purged) and wait for the acks of nodes.
+// If the nodes are unknown, it returns when the acks aren't changed within an interval
+func (p *purgePublisher) publish(params *purgeCacheParams, count int, wait time.Duration) (result *purgeResult, err error) {
+	event := newPurgeEvent(p.node, params)
+	err = p.cfg.PublishPurge(event)
+	if err != nil {
+		return
+	}
+	err = p.cfg.AckPurge(event.ID, &config.PurgeAck{
+		Node:  p.node,
+		Count: count,
+	})
+	if err != nil {
+		return
+	}
+	var nodes []string
+	if p.nodes != nil {
+		nodes = p.nodes()
+	}
+	deadline := time.Now().Add(wait)
+	var acks []*config.PurgeAck
+	prevCount := -1
+	for {
+		acks, err = p.cfg.GetPurgeAcks(event.ID)
+		if err != nil {
+			return
+		}
+		// 所有节点已确认或已超时
+		if acked(nodes, acks) || !time.Now().Before(deadline) {
+			break
+		}
+		// 未知节点列表时，确认信息不再变化则返回
+		if len(nodes) == 0 && len(acks) == prevCount {
+			break
+		}
+		prevCount = len(acks)
+		time.Sleep(purgeAckInterval)
+	}
+	result = &purgeResult{
+		Count: count,
+		ID:    event.ID,
+		Acks:  acks,
+	}
+	return
+}
+
+// newPurgeEventHandler create a handler of purge event,
+// it purges the caches of current node and acknowledges the event
+func newPurgeEventHandler(cfg *config.Config, node func() string, dispatchers func() *cache.Dispatchers) config.OnPurge {
+	return func(event *config.PurgeEvent) {
+		name := node()
+		// 当前节点发布的事件已清除
+		if event.Node == name {
+			return
+		}
+		ack := &config.PurgeAck{
+			Node: name,
+		}
+		ds := dispatchers()
+		if ds == nil {
+			ack.Error = "caches are not initialized"
+		} else {
+			count, err := purgeCaches(ds, &purgeCacheParams{
+				Cache:  event.Cache,
+				Key:    event.Key,
+				Host:   event.Host,
+				Prefix: event.Prefix,
+				Regexp: event.Regexp,
+				Tag:    event.Tag,
+				Ban:    event.Ban,
+			})
+			ack.Count = count
+			if err != nil {
+				ack.Error = err.Error()
+			}
+		}
+		err := cfg.AckPurge(event.ID, ack)
+		if err != nil {
+			log.Default().Error("ack purge event fail",
+				zap.String("id", event.ID),
+				zap.Error(err),
+			)
+			return
+		}
+		log.Default().Info("purge caches by event successful",
+			zap.String("id", event.ID),
+			zap.String("from", event.Node),
+			zap.Int("count", ack.Count),
+		)
+	}
+}
@@ -0,0 +1,155 @@
+// Copyright 2020 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vicanso/pike/cache"
+	"github.com/vicanso/pike/config"
+)
+
+func TestGetPurgeWait(t *testing.T) {
+	assert := assert.New(t)
+	wait, err := getPurgeWait("")
+	assert.Nil(err)
+	assert.Equal(defaultPurgeWait, wait)
+
+	wait, err = getPurgeWait("500ms")
+	assert.Nil(err)
+	assert.Equal(500*time.Millisecond, wait)
+
+	wait, err = getPurgeWait("1m")
+	assert.Nil(err)
+	assert.Equal(maxPurgeWait, wait)
+
+	_, err = getPurgeWait("a")
+	assert.NotNil(err)
+}
+
+func TestGetNodeName(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("192.168.1.1:3016", getNodeName("192.168.1.1:3016"))
+	assert.NotEmpty(getNodeName(""))
+}
+
+func TestPurgePublisher(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "pike-purge")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+	cfg, err := config.NewConfig(dir + "/pike")
+	assert.Nil(err)
+	defer cfg.Close()
+	// 等待监听生效
+	time.Sleep(10 * time.Millisecond)
+
+	// 模拟另一个节点
+	dispatchers := cache.NewDispatchers(config.Caches{
+		&config.Cache{
+			Name: "a",
+		},
+	})
+	for _, key := range []string{"GET aslant.site /users/v1/me", "GET aslant.site /books/v1"} {
+		dispatchers.Get("a").GetHTTPCache([]byte(key))
+	}
+	cfg.OnPurge(newPurgeEventHandler(cfg, func() string {
+		return "b"
+	}, func() *cache.Dispatchers {
+		return dispatchers
+	}))
+
+	t.Run("all nodes ack", func(t *testing.T) {
+		p := &purgePublisher{
+			cfg:  cfg,
+			node: "a",
+			nodes: func() []string {
+				return []string{"a", "b"}
+			},
+		}
+		start := time.Now()
+		result, err := p.publish(&purgeCacheParams{
+			Prefix: "/users",
+		}, 3, time.Second)
+		assert.Nil(err)
+		// 所有节点确认后马上返回
+		assert.True(time.Since(start) < time.Second)
+		assert.Equal(3, result.Count)
+		assert.NotEmpty(result.ID)
+		assert.Equal([]*config.PurgeAck{
+			{
+				Node:  "a",
+				Count: 3,
+			},
+			{
+				Node:  "b",
+				Count: 1,
+			},
+		}, result.Acks)
+		assert.Equal(1, dispatchers.Get("a").Stats().Entries)
+	})
+
+	t.Run("unknown nodes", func(t *testing.T) {
+		p := &purgePublisher{
+			cfg:  cfg,
+			node: "a",
+		}
+		start := time.Now()
+		result, err := p.publish(&purgeCacheParams{
+			Key: "GET aslant.site /users/v1/me",
+		}, 0, defaultPurgeWait)
+		assert.Nil(err)
+		// 确认信息不再变化后返回，无需等待超时
+		assert.True(time.Since(start) < defaultPurgeWait)
+		assert.NotEmpty(result.Acks)
+		assert.Equal("a", result.Acks[0].Node)
+	})
+
+	t.Run("ack with error", func(t *testing.T) {
+		p := &purgePublisher{
+			cfg:  cfg,
+			node: "a",
+		}
+		result, err := p.publish(&purgeCacheParams{
+			Cache: "c",
+			Key:   "GET aslant.site /books/v1",
+		}, 0, 0)
+		assert.Nil(err)
+		assert.Equal(2, len(result.Acks))
+		assert.Equal("b", result.Acks[1].Node)
+		assert.NotEmpty(result.Acks[1].Error)
+	})
+
+	t.Run("skip self event", func(t *testing.T) {
+		p := &purgePublisher{
+			cfg:  cfg,
+			node: "b",
+		}
+		result, err := p.publish(&purgeCacheParams{
+			Key: "GET aslant.site /books/v1",
+		}, 0, 0)
+		assert.Nil(err)
+		assert.Equal([]*config.PurgeAck{
+			{
+				Node: "b",
+			},
+		}, result.Acks)
+		assert.Equal(1, dispatchers.Get("a").Stats().Entries)
+	})
+}
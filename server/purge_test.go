@@ -0,0 +1,222 @@
+// Copyright 2020 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vicanso/elton"
+	"github.com/vicanso/pike/cache"
+	"github.com/vicanso/pike/config"
+	"github.com/vicanso/pike/util"
+)
+
+func TestNewPurgeACL(t *testing.T) {
+	assert := assert.New(t)
+	isAllowed := newPurgeACL(nil)
+	assert.True(isAllowed(net.ParseIP("192.168.1.1")))
+	assert.False(isAllowed(net.ParseIP("1.1.1.1")))
+
+	isAllowed = newPurgeACL([]string{
+		"1.1.1.0/24",
+	})
+	assert.True(isAllowed(net.ParseIP("1.1.1.1")))
+	assert.False(isAllowed(net.ParseIP("192.168.1.1")))
+}
+
+func TestPurgeMiddleware(t *testing.T) {
+	assert := assert.New(t)
+	dispatcher := cache.NewDispatcher(nil)
+	fn := newPurgeMiddleware(dispatcher, "a", nil, nil, nil)
+	newContext := func(method, url string) *elton.Context {
+		req := httptest.NewRequest(method, url, nil)
+		req.Host = "aslant.site"
+		req.RemoteAddr = "127.0.0.1:3000"
+		c := elton.NewContext(httptest.NewRecorder(), req)
+		c.Next = func() error {
+			return nil
+		}
+		return c
+	}
+
+	t.Run("not purge request", func(t *testing.T) {
+		c := newContext("GET", "/")
+		done := false
+		c.Next = func() error {
+			done = true
+			return nil
+		}
+		err := fn(c)
+		assert.Nil(err)
+		assert.True(done)
+	})
+
+	t.Run("not allowed", func(t *testing.T) {
+		c := newContext(methodPurge, "/")
+		c.Request.RemoteAddr = "1.1.1.1:3000"
+		err := fn(c)
+		assert.Equal(errPurgeForbidden, err)
+
+		// 伪造的转发请求头无效
+		c = newContext(methodPurge, "/")
+		c.Request.RemoteAddr = "1.1.1.1:3000"
+		c.Request.Header.Set("X-Forwarded-For", "10.0.0.1")
+		c.Request.Header.Set("X-Real-Ip", "10.0.0.1")
+		err = fn(c)
+		assert.Equal(errPurgeForbidden, err)
+	})
+
+	t.Run("purge", func(t *testing.T) {
+		dispatcher.GetHTTPCache([]byte("GET aslant.site /users/me?type=1"))
+		dispatcher.GetHTTPCache([]byte("HEAD aslant.site /users/me?type=1"))
+		c := newContext(methodPurge, "/users/me?type=1")
+		err := fn(c)
+		assert.Nil(err)
+		assert.Equal(`{"count":2}`, c.BodyBuffer.String())
+	})
+
+	t.Run("purge with key policy", func(t *testing.T) {
+		fn := newPurgeMiddleware(dispatcher, "a", config.Locations{
+			&config.Location{
+				KeyPolicy: &util.IdentityPolicy{
+					IgnoreQuery: []string{
+						"utm_*",
+					},
+				},
+			},
+		}, nil, nil)
+		dispatcher.GetHTTPCache([]byte("GET aslant.site /books/2?id=1"))
+		c := newContext(methodPurge, "/books/2?id=1&utm_source=a")
+		err := fn(c)
+		assert.Nil(err)
+		assert.Equal(`{"count":1}`, c.BodyBuffer.String())
+	})
+
+	t.Run("ban", func(t *testing.T) {
+		key := []byte("GET aslant.site /books/1")
+		hc := dispatcher.GetHTTPCache(key)
+		hc.Cachable(60, &cache.HTTPData{
+			RawBody: []byte("abcd"),
+		})
+		c := newContext(methodBan, "/books/")
+		err := fn(c)
+		assert.Nil(err)
+		// 在ban之前创建的缓存失效
+		nhc := dispatcher.GetHTTPCache(key)
+		assert.NotEqual(hc, nhc)
+		assert.Equal(cache.StatusUnknown, nhc.GetStatus())
+
+		c = newContext(methodBan, "/")
+		c.Request.Header.Set(headerBanURL, "(")
+		err = fn(c)
+		assert.NotNil(err)
+	})
+}
+
+func TestPurgeMiddlewareBanCreatedAfter(t *testing.T) {
+	assert := assert.New(t)
+	dispatcher := cache.NewDispatcher(nil)
+	err := dispatcher.Ban("aslant.site", "^/books/")
+	assert.Nil(err)
+	// 确保缓存在ban之后创建
+	time.Sleep(time.Second)
+	key := []byte("GET aslant.site /books/1")
+	hc := dispatcher.GetHTTPCache(key)
+	hc.Cachable(60, &cache.HTTPData{
+		RawBody: []byte("abcd"),
+	})
+	assert.Equal(hc, dispatcher.GetHTTPCache(key))
+}
+
+func TestPurgeMiddlewarePublish(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "pike-purge")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+	cfg, err := config.NewConfig(dir + "/pike")
+	assert.Nil(err)
+	defer cfg.Close()
+	// 等待监听生效
+	time.Sleep(10 * time.Millisecond)
+
+	// 模拟另一个节点
+	dispatchers := cache.NewDispatchers(config.Caches{
+		&config.Cache{
+			Name: "a",
+		},
+	})
+	cfg.OnPurge(newPurgeEventHandler(cfg, func() string {
+		return "b"
+	}, func() *cache.Dispatchers {
+		return dispatchers
+	}))
+	other := dispatchers.Get("a")
+
+	dispatcher := cache.NewDispatcher(nil)
+	fn := newPurgeMiddleware(dispatcher, "a", nil, nil, &purgePublisher{
+		cfg:  cfg,
+		node: "a",
+	})
+	newContext := func(method, url string) *elton.Context {
+		req := httptest.NewRequest(method, url, nil)
+		req.Host = "aslant.site"
+		req.RemoteAddr = "127.0.0.1:3000"
+		return elton.NewContext(httptest.NewRecorder(), req)
+	}
+	// 等待其它节点处理清除事件
+	waitFor := func(done func() bool) bool {
+		for i := 0; i < 100; i++ {
+			if done() {
+				return true
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		return false
+	}
+
+	t.Run("purge", func(t *testing.T) {
+		for _, d := range []*cache.Dispatcher{dispatcher, other} {
+			d.GetHTTPCache([]byte("GET aslant.site /users/me"))
+			d.GetHTTPCache([]byte("HEAD aslant.site /users/me"))
+		}
+		c := newContext(methodPurge, "/users/me")
+		assert.Nil(fn(c))
+		assert.Equal(`{"count":2}`, c.BodyBuffer.String())
+		assert.Equal(0, dispatcher.Stats().Entries)
+		assert.True(waitFor(func() bool {
+			return other.Stats().Entries == 0
+		}))
+	})
+
+	t.Run("ban", func(t *testing.T) {
+		key := []byte("GET aslant.site /books/1")
+		hc := other.GetHTTPCache(key)
+		hc.Cachable(60, &cache.HTTPData{
+			RawBody: []byte("abcd"),
+		})
+		c := newContext(methodBan, "/books/")
+		assert.Nil(fn(c))
+		// 其它节点在ban之前创建的缓存失效
+		assert.True(waitFor(func() bool {
+			return other.GetHTTPCache(key) != hc
+		}))
+	})
+}
@@ -22,6 +22,7 @@ import (
 	"encoding/base64"
 	"errors"
 	"net/http"
+	"reflect"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -31,6 +32,7 @@ import (
 	"github.com/vicanso/elton"
 
 	"github.com/vicanso/pike/cache"
+	"github.com/vicanso/pike/cluster"
 	"github.com/vicanso/pike/config"
 	"github.com/vicanso/pike/log"
 	"github.com/vicanso/pike/upstream"
@@ -54,14 +56,17 @@ type Server struct {
 
 // ServerOptions server options
 type ServerOptions struct {
-	name       string
-	influxSrv  *InfluxSrv
-	server     *config.Server
-	locations  config.Locations
-	upstreams  *upstream.Upstreams
-	dispatcher *cache.Dispatcher
-	compress   *config.Compress
-	cfg        *config.Config
+	name        string
+	influxSrv   *InfluxSrv
+	server      *config.Server
+	locations   config.Locations
+	upstreams   *upstream.Upstreams
+	dispatcher  *cache.Dispatcher
+	dispatchers *cache.Dispatchers
+	compress    *config.Compress
+	cfg         *config.Config
+	peer        *cluster.Peer
+	publisher   *purgePublisher
 }
 
 // Instance pike server instance
@@ -71,7 +76,14 @@ type Instance struct {
 	EnabledAdminServer bool
 	servers            *sync.Map
 	upstreams          *upstream.Upstreams
+	dispatchers        *cache.Dispatchers
 	cron               *cron.Cron
+	cluster            *cluster.Cluster
+	clusterConfig      *config.Cluster
+
+	// 清除缓存事件的处理中使用
+	mu   sync.RWMutex
+	node string
 }
 
 // upstreamAlarmHandle upstream状态变化的告警
@@ -111,14 +123,42 @@ func (ins *Instance) Fetch() (err error) {
 	if err != nil {
 		return
 	}
+	cachesConfig, err := cfg.GetCaches()
+	if err != nil {
+		return
+	}
+	clusterConfig, err := cfg.GetCluster()
+	if err != nil {
+		return
+	}
+	locationsConfig, err := cfg.GetLocations()
+	if err != nil {
+		return
+	}
+	locationsConfig.Sort()
+	upstreamsConfig, err := cfg.GetUpstreams()
+	if err != nil {
+		return
+	}
+	alarmsConfig, err := cfg.GetAlarms()
+	if err != nil {
+		return
+	}
+	compressesConfig, err := cfg.GetCompresses()
+	if err != nil {
+		return
+	}
+
+	// 所有配置获取成功后才重新加载，避免部分配置出错时已替换了缓存等
 	var influxSrv *InfluxSrv
+	var influxErr error
 	if influxdbConfig != nil && influxdbConfig.Enabled {
-		influxSrv, err = NewInfluxSrv(influxdbConfig)
+		influxSrv, influxErr = NewInfluxSrv(influxdbConfig)
 	}
 	// 初始化influxdb失败只输出日志
-	if err != nil {
+	if influxErr != nil {
 		log.Default().Error("create influxdb service fail",
-			zap.Error(err),
+			zap.Error(influxErr),
 		)
 	}
 	if ins.InfluxSrv != nil {
@@ -126,11 +166,12 @@ func (ins *Instance) Fetch() (err error) {
 	}
 	ins.InfluxSrv = influxSrv
 
-	cachesConfig, err := cfg.GetCaches()
-	if err != nil {
-		return
-	}
-	dispatchers := cache.NewDispatchers(cachesConfig)
+	// 重新加载时保留原有的缓存数据，避免配置修改后大量请求转发至upstream，
+	// 新增的缓存从快照中恢复
+	dispatchers := ins.dispatchers.Reload(cachesConfig)
+	ins.mu.Lock()
+	ins.dispatchers = dispatchers
+	ins.mu.Unlock()
 	// 缓存的定期清除任务
 	for _, cacheConfig := range cachesConfig {
 		if cacheConfig.PurgedAt != "" {
@@ -151,21 +192,21 @@ func (ins *Instance) Fetch() (err error) {
 			}(cacheConfig.Name)
 		}
 	}
-
-	locationsConfig, err := cfg.GetLocations()
-	if err != nil {
-		return
+	// 定时将缓存的统计计数写入influxdb
+	if influxSrv != nil {
+		_, err := cronIns.AddFunc(cacheCountersInterval, func() {
+			influxSrv.WriteCacheCounters(dispatchers)
+		})
+		if err != nil {
+			logger.Error("create cache counters cron fail",
+				zap.Error(err),
+			)
+		}
 	}
-	locationsConfig.Sort()
 
-	upstreamsConfig, err := cfg.GetUpstreams()
-	if err != nil {
-		return
-	}
-	alarmsConfig, err := cfg.GetAlarms()
-	if err != nil {
-		return
-	}
+	ins.resetCluster(clusterConfig, dispatchers)
+	publisher := ins.newPurgePublisher()
+
 	upstreams := upstream.NewUpstreams(upstreamsConfig)
 	upstreamAlarm := alarmsConfig.Get("upstream")
 	upstreams.OnStatus(func(info upstream.UpStream) {
@@ -179,10 +220,6 @@ func (ins *Instance) Fetch() (err error) {
 		}
 	})
 
-	compressesConfig, err := cfg.GetCompresses()
-	if err != nil {
-		return
-	}
 	servers := ins.servers
 	if servers == nil {
 		servers = new(sync.Map)
@@ -195,14 +232,17 @@ func (ins *Instance) Fetch() (err error) {
 		data, ok := servers.Load(conf.Name)
 		// 如果已存在，仅更新信息
 		opts := &ServerOptions{
-			name:       conf.Name,
-			influxSrv:  influxSrv,
-			server:     conf,
-			locations:  locations,
-			upstreams:  upstreams,
-			dispatcher: dispatcher,
-			compress:   compress,
-			cfg:        cfg,
+			name:        conf.Name,
+			influxSrv:   influxSrv,
+			server:      conf,
+			locations:   locations,
+			upstreams:   upstreams,
+			dispatcher:  dispatcher,
+			dispatchers: dispatchers,
+			compress:    compress,
+			cfg:         cfg,
+			peer:        ins.cluster.Peer(conf.Cache, dispatcher),
+			publisher:   publisher,
 		}
 		var srv *Server
 		if ok {
@@ -214,6 +254,8 @@ func (ins *Instance) Fetch() (err error) {
 		}
 		srv.toggleElton()
 	}
+	// 各server已使用新的dispatchers，关闭被替换的dispatcher与磁盘缓存
+	dispatchers.CloseStale()
 	oldUpstreams := ins.upstreams
 	// 如果已有upstreams存在，则将原有upstream销毁
 	if oldUpstreams != nil {
@@ -230,6 +272,81 @@ func (ins *Instance) Fetch() (err error) {
 	return
 }
 
+// resetCluster create the cluster of config, the cluster is recreated
+// if the config is changed and it is closed if the config is disabled
+func (ins *Instance) resetCluster(clusterConfig *config.Cluster, dispatchers *cache.Dispatchers) {
+	if ins.cluster != nil && (!clusterConfig.Enabled || !reflect.DeepEqual(ins.clusterConfig, clusterConfig)) {
+		err := ins.cluster.Close()
+		if err != nil {
+			log.Default().Error("close cluster fail",
+				zap.Error(err),
+			)
+		}
+		ins.cluster = nil
+	}
+	ins.clusterConfig = clusterConfig
+	if !clusterConfig.Enabled {
+		return
+	}
+	// 未配置token时任何可访问的客户端均可写入缓存，因此不启用集群
+	if clusterConfig.Token == "" {
+		log.Default().Error("cluster is disabled because token is empty")
+		return
+	}
+	if ins.cluster == nil {
+		opts := cluster.Options{
+			Addr:     clusterConfig.Addr,
+			Self:     clusterConfig.Self,
+			Peers:    clusterConfig.Peers,
+			Replicas: clusterConfig.Replicas,
+			Timeout:  clusterConfig.Timeout,
+			Token:    clusterConfig.Token,
+		}
+		// 注册至配置中，由各节点获取已注册的节点
+		if clusterConfig.Register {
+			opts.Registry = ins.Config
+		}
+		ins.cluster = cluster.New(opts)
+		ins.cluster.Start()
+	}
+	ins.cluster.SetDispatchers(dispatchers)
+}
+
+// newPurgePublisher create the purge publisher of current node,
+// the nodes of cluster should acknowledge the purge event if cluster is enabled
+func (ins *Instance) newPurgePublisher() *purgePublisher {
+	addr := ""
+	if ins.clusterConfig != nil && ins.clusterConfig.Enabled {
+		addr = ins.clusterConfig.Self
+	}
+	node := getNodeName(addr)
+	ins.mu.Lock()
+	ins.node = node
+	ins.mu.Unlock()
+	publisher := &purgePublisher{
+		cfg:  ins.Config,
+		node: node,
+	}
+	if c := ins.cluster; c != nil {
+		publisher.nodes = c.Nodes
+	}
+	return publisher
+}
+
+// getNode get the name of current node
+func (ins *Instance) getNode() string {
+	ins.mu.RLock()
+	defer ins.mu.RUnlock()
+	return ins.node
+}
+
+// getDispatchers get the dispatchers of instance
+func (ins *Instance) getDispatchers() *cache.Dispatchers {
+	ins.mu.RLock()
+	defer ins.mu.RUnlock()
+	return ins.dispatchers
+}
+
 // Restart restart all server
 func (ins *Instance) Restart() {
 	ins.servers.Range(func(k, v interface{}) bool {
@@ -245,6 +362,8 @@ func (ins *Instance) Restart() {
 
 // Start start all server
 func (ins *Instance) Start() (err error) {
+	// 其它节点发布的清除缓存事件
+	ins.Config.OnPurge(newPurgeEventHandler(ins.Config, ins.getNode, ins.getDispatchers))
 	err = ins.Fetch()
 	if err != nil {
 		return
@@ -254,6 +373,21 @@ func (ins *Instance) Start() (err error) {
 	return
 }
 
+// SaveSnapshots save the snapshots of caches
+func (ins *Instance) SaveSnapshots() {
+	ins.dispatchers.SaveSnapshots()
+}
+
+// Close close the resources of instance, such as disk cache
+func (ins *Instance) Close() {
+	if ins.cluster != nil {
+		_ = ins.cluster.Close()
+	}
+	if ins.dispatchers != nil {
+		ins.dispatchers.Close()
+	}
+}
+
 // NewServer new a server
 func NewServer(opts *ServerOptions) *Server {
 	conf := opts.server
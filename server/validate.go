@@ -16,7 +16,10 @@ package server
 
 import (
 	"encoding/json"
+	"net"
+	"regexp"
 	"strings"
+	"time"
 
 	"github.com/asaskevich/govalidator"
 	"github.com/vicanso/hes"
@@ -105,10 +108,128 @@ func init() {
 		return isURLPath(value)
 	})
 
+	add("xAddr", func(i interface{}, _ interface{}) bool {
+		value, ok := i.(string)
+		if !ok {
+			return false
+		}
+		return isAddr(value)
+	})
+	add("xAddrs", func(i interface{}, _ interface{}) bool {
+		arr, ok := i.([]string)
+		if !ok {
+			return false
+		}
+		for _, item := range arr {
+			if !isAddr(item) {
+				return false
+			}
+		}
+		return true
+	})
+
+	add("xCIDRs", func(i interface{}, _ interface{}) bool {
+		arr, ok := i.([]string)
+		if !ok {
+			return false
+		}
+		for _, item := range arr {
+			_, _, err := net.ParseCIDR(item)
+			if err != nil {
+				return false
+			}
+		}
+		return true
+	})
+
 	add("xServers", func(i interface{}, _ interface{}) bool {
 		_, ok := i.([]config.UpstreamServer)
 		return ok
 	})
+
+	add("xStatusTTL", func(i interface{}, _ interface{}) bool {
+		arr, ok := i.([]string)
+		if !ok {
+			return false
+		}
+		for _, item := range arr {
+			statusCode, ttl, err := config.ParseStatusTTL(item)
+			if err != nil || statusCode < 100 || statusCode > 599 || ttl < time.Second {
+				return false
+			}
+		}
+		return true
+	})
+
+	add("xEviction", func(i interface{}, _ interface{}) bool {
+		value, ok := i.(string)
+		if !ok {
+			return false
+		}
+		switch value {
+		case config.EvictionLRU, config.EvictionTinyLFU, config.EvictionARC:
+			return true
+		}
+		return false
+	})
+
+	add("xStorage", func(i interface{}, _ interface{}) bool {
+		value, ok := i.(string)
+		if !ok {
+			return false
+		}
+		switch value {
+		case config.StorageHeap, config.StorageArena:
+			return true
+		}
+		return false
+	})
+
+	add("xCacheRules", func(i interface{}, _ interface{}) bool {
+		rules, ok := i.([]config.LocationCacheRule)
+		if !ok {
+			return false
+		}
+		for _, rule := range rules {
+			if !isCacheRule(rule) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+func isCacheRule(rule config.LocationCacheRule) bool {
+	switch rule.Action {
+	case config.CacheRuleActionForce, config.CacheRuleActionMax:
+		if rule.TTL <= 0 {
+			return false
+		}
+	case config.CacheRuleActionPass:
+	default:
+		return false
+	}
+	if rule.StatusCode != 0 && (rule.StatusCode < 100 || rule.StatusCode > 599) {
+		return false
+	}
+	for _, expr := range []string{
+		rule.Path,
+		rule.ContentType,
+	} {
+		if _, err := regexp.Compile(expr); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// isAddr check the value is host:port
+func isAddr(value string) bool {
+	host, port, err := net.SplitHostPort(value)
+	if err != nil || host == "" {
+		return false
+	}
+	return govalidator.IsPort(port)
 }
 
 func isURLPath(value string) bool {
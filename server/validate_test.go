@@ -32,6 +32,27 @@ func TestDoValidate(t *testing.T) {
 	}`))
 	assert.Nil(err)
 
+	err = doValidate(new(config.Server), []byte(`{
+		"name": "test",
+		"cache": "commonCache",
+		"compress": "commonCompress",
+		"locations": ["l1", "l2"],
+		"addr": ":3000",
+		"enabledPurge": true,
+		"purgeACL": ["127.0.0.1/32", "10.0.0.0/8"]
+	}`))
+	assert.Nil(err)
+
+	err = doValidate(new(config.Server), []byte(`{
+		"name": "test",
+		"cache": "commonCache",
+		"compress": "commonCompress",
+		"locations": ["l1", "l2"],
+		"addr": ":3000",
+		"purgeACL": ["127.0.0.1"]
+	}`))
+	assert.NotNil(err)
+
 	err = doValidate(new(config.Location), []byte(`{
 		"name": "l1",
 		"upstream": "u1",
@@ -42,6 +63,44 @@ func TestDoValidate(t *testing.T) {
 	}`))
 	assert.Nil(err)
 
+	err = doValidate(new(config.Location), []byte(`{
+		"name": "l1",
+		"upstream": "u1",
+		"cacheRules": [
+			{
+				"path": "^/static/",
+				"contentType": "image|css",
+				"action": "force",
+				"ttl": 600,
+				"stripCookie": true
+			},
+			{
+				"statusCode": 404,
+				"action": "max",
+				"ttl": 10
+			},
+			{
+				"path": "^/api/",
+				"action": "pass"
+			}
+		]
+	}`))
+	assert.Nil(err)
+
+	for _, rule := range []string{
+		`{"action": "force"}`,
+		`{"action": "cache", "ttl": 10}`,
+		`{"path": "[", "action": "pass"}`,
+		`{"statusCode": 1000, "action": "pass"}`,
+	} {
+		err = doValidate(new(config.Location), []byte(`{
+			"name": "l1",
+			"upstream": "u1",
+			"cacheRules": [`+rule+`]
+		}`))
+		assert.NotNil(err, rule)
+	}
+
 	err = doValidate(new(config.Upstream), []byte(`{
 		"name": "u1",
 		"healthCheck": "/ping",
@@ -53,6 +112,53 @@ func TestDoValidate(t *testing.T) {
 	}`))
 	assert.Nil(err)
 
+	validateStatusTTL, _ := customTypeTagMap.Get("xStatusTTL")
+	assert.True(validateStatusTTL([]string{"404:30s", "502:5s"}, nil))
+	for _, statusTTL := range []string{
+		"404",
+		"404:30",
+		"404:500ms",
+		"1000:30s",
+	} {
+		assert.False(validateStatusTTL([]string{statusTTL}, nil), statusTTL)
+	}
+
+	validateEviction, _ := customTypeTagMap.Get("xEviction")
+	for _, eviction := range []string{
+		config.EvictionLRU,
+		config.EvictionTinyLFU,
+		config.EvictionARC,
+	} {
+		assert.True(validateEviction(eviction, nil), eviction)
+	}
+	assert.False(validateEviction("lfu", nil))
+
+	validateStorage, _ := customTypeTagMap.Get("xStorage")
+	assert.True(validateStorage(config.StorageHeap, nil))
+	assert.True(validateStorage(config.StorageArena, nil))
+	assert.False(validateStorage("mmap", nil))
+
+	validateAddr, _ := customTypeTagMap.Get("xAddr")
+	assert.True(validateAddr("192.168.1.2:3016", nil))
+	assert.False(validateAddr(":3016", nil))
+	assert.False(validateAddr("192.168.1.2", nil))
+	validateAddrs, _ := customTypeTagMap.Get("xAddrs")
+	assert.True(validateAddrs([]string{"192.168.1.2:3016", "pike:3016"}, nil))
+	assert.False(validateAddrs([]string{"192.168.1.2:3016", "pike"}, nil))
+
+	// 集群需要配置token
+	clusterConfig := map[string]interface{}{
+		"addr":     ":3016",
+		"self":     "192.168.1.1:3016",
+		"replicas": 50,
+		"enabled":  true,
+	}
+	assert.NotNil(doValidate(new(config.Cluster), clusterConfig))
+	clusterConfig["token"] = "short"
+	assert.NotNil(doValidate(new(config.Cluster), clusterConfig))
+	clusterConfig["token"] = "0123456789abcdef"
+	assert.Nil(doValidate(new(config.Cluster), clusterConfig))
+
 	err = doValidate(new(config.Admin), map[string]string{
 		"prefix": "/pike",
 	})
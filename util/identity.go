@@ -0,0 +1,156 @@
+// Copyright 2020 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// 根据策略生成请求的identity（缓存的key），
+// 如忽略或仅保留指定的query参数、query参数排序、host转换为小写以及添加请求头或cookie等
+
+package util
+
+import (
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+type (
+	// IdentityPolicy the policy of generating identity(cache key) of request
+	IdentityPolicy struct {
+		// IgnoreQuery the query parameters to be ignored, support prefix match such as utm_*
+		IgnoreQuery []string
+		// QueryWhitelist only the query parameters in whitelist will be kept if it is not empty
+		QueryWhitelist []string
+		// SortQuery sort the query parameters by name
+		SortQuery bool
+		// LowerHost convert the host to lower case
+		LowerHost bool
+		// Headers the request headers to be added to identity
+		Headers []string
+		// Cookies the cookies to be added to identity
+		Cookies []string
+	}
+	queryParam struct {
+		name  string
+		value string
+	}
+)
+
+// matchName check the name match the patterns, the pattern ends with * is prefix match
+func matchName(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if strings.HasSuffix(pattern, "*") {
+			if strings.HasPrefix(name, pattern[:len(pattern)-1]) {
+				return true
+			}
+			continue
+		}
+		if pattern == name {
+			return true
+		}
+	}
+	return false
+}
+
+// getURI get the request uri with the query policy
+func (p *IdentityPolicy) getURI(uri string) string {
+	if len(p.IgnoreQuery) == 0 && len(p.QueryWhitelist) == 0 && !p.SortQuery {
+		return uri
+	}
+	index := strings.IndexByte(uri, '?')
+	if index == -1 {
+		return uri
+	}
+	path := uri[:index]
+	params := make([]*queryParam, 0)
+	for _, item := range strings.Split(uri[index+1:], "&") {
+		if item == "" {
+			continue
+		}
+		name := item
+		if i := strings.IndexByte(item, '='); i != -1 {
+			name = item[:i]
+		}
+		// 参数名以解码后的值匹配
+		if v, err := url.QueryUnescape(name); err == nil {
+			name = v
+		}
+		if len(p.QueryWhitelist) != 0 && !matchName(p.QueryWhitelist, name) {
+			continue
+		}
+		if matchName(p.IgnoreQuery, name) {
+			continue
+		}
+		params = append(params, &queryParam{
+			name:  name,
+			value: item,
+		})
+	}
+	if len(params) == 0 {
+		return path
+	}
+	if p.SortQuery {
+		sort.SliceStable(params, func(i, j int) bool {
+			return params[i].name < params[j].name
+		})
+	}
+	var b strings.Builder
+	b.WriteString(path)
+	for i, param := range params {
+		if i == 0 {
+			b.WriteByte('?')
+		} else {
+			b.WriteByte('&')
+		}
+		b.WriteString(param.value)
+	}
+	return b.String()
+}
+
+// GetIdentity get identity of request with the policy,
+// the format is "Method Host URI", and the selected headers and cookies will be appended
+// as " h:Name=value" and " c:name=value"(they are excluded by ParseIdentity and TrimIdentitySuffix).
+// If the policy is nil, returns GetIdentity(req).
+func (p *IdentityPolicy) GetIdentity(req *http.Request) []byte {
+	if p == nil {
+		return GetIdentity(req)
+	}
+	host := req.Host
+	if p.LowerHost {
+		host = strings.ToLower(host)
+	}
+	var b strings.Builder
+	b.WriteString(req.Method)
+	b.WriteByte(spaceByte)
+	b.WriteString(host)
+	b.WriteByte(spaceByte)
+	b.WriteString(p.getURI(req.RequestURI))
+	for _, name := range p.Headers {
+		name = textproto.CanonicalMIMEHeaderKey(name)
+		b.WriteString(" h:")
+		b.WriteString(name)
+		b.WriteByte('=')
+		b.WriteString(strings.Join(req.Header[name], ","))
+	}
+	for _, name := range p.Cookies {
+		b.WriteString(" c:")
+		b.WriteString(name)
+		b.WriteByte('=')
+		cookie, err := req.Cookie(name)
+		if err == nil {
+			b.WriteString(cookie.Value)
+		}
+	}
+	return []byte(b.String())
+}
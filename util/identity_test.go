@@ -0,0 +1,121 @@
+// Copyright 2020 tree xie
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIdentityPolicy(t *testing.T) {
+	newRequest := func(url string) *http.Request {
+		req := httptest.NewRequest("GET", url, nil)
+		req.Host = "Aslant.Site"
+		return req
+	}
+
+	t.Run("nil policy", func(t *testing.T) {
+		assert := assert.New(t)
+		var p *IdentityPolicy
+		req := newRequest("/users/v1/me?type=vip")
+		assert.Equal(GetIdentity(req), p.GetIdentity(req))
+	})
+
+	t.Run("query", func(t *testing.T) {
+		assert := assert.New(t)
+		tests := []struct {
+			policy   *IdentityPolicy
+			url      string
+			identity string
+		}{
+			{
+				policy: &IdentityPolicy{
+					IgnoreQuery: []string{
+						"utm_*",
+						"t",
+					},
+				},
+				url:      "/books?utm_source=a&id=1&t=123&utm_medium=b",
+				identity: "GET Aslant.Site /books?id=1",
+			},
+			{
+				policy: &IdentityPolicy{
+					IgnoreQuery: []string{
+						"utm_*",
+					},
+				},
+				url:      "/books?utm_source=a",
+				identity: "GET Aslant.Site /books",
+			},
+			{
+				policy: &IdentityPolicy{
+					QueryWhitelist: []string{
+						"id",
+						"page",
+					},
+				},
+				url:      "/books?page=1&utm_source=a&id=1",
+				identity: "GET Aslant.Site /books?page=1&id=1",
+			},
+			{
+				policy: &IdentityPolicy{
+					SortQuery: true,
+				},
+				url:      "/books?page=1&id=2&a%20b=3&id=1",
+				identity: "GET Aslant.Site /books?a%20b=3&id=2&id=1&page=1",
+			},
+			{
+				policy: &IdentityPolicy{
+					SortQuery: true,
+				},
+				url:      "/books",
+				identity: "GET Aslant.Site /books",
+			},
+		}
+		for _, tt := range tests {
+			assert.Equal(tt.identity, string(tt.policy.GetIdentity(newRequest(tt.url))))
+		}
+	})
+
+	t.Run("host, header and cookie", func(t *testing.T) {
+		assert := assert.New(t)
+		p := &IdentityPolicy{
+			LowerHost: true,
+			Headers: []string{
+				"accept-language",
+			},
+			Cookies: []string{
+				"lang",
+				"theme",
+			},
+		}
+		req := newRequest("/books?id=1")
+		req.Header.Set("Accept-Language", "zh")
+		req.AddCookie(&http.Cookie{
+			Name:  "lang",
+			Value: "en",
+		})
+		assert.Equal("GET aslant.site /books?id=1 h:Accept-Language=zh c:lang=en c:theme=", string(p.GetIdentity(req)))
+
+		method, host, uri := ParseIdentity(string(p.GetIdentity(req)))
+		assert.Equal("GET", method)
+		assert.Equal("aslant.site", host)
+		// 请求头与cookie不属于uri
+		assert.Equal("/books?id=1", uri)
+	})
+}
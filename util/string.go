@@ -92,6 +92,32 @@ func GetIdentity(req *http.Request) []byte {
 	return buffer
 }
 
+// ParseIdentity parse the identity(generated by GetIdentity) to method, host and uri,
+// the headers and cookies appended by identity policy are excluded from uri
+func ParseIdentity(identity string) (method, host, uri string) {
+	arr := strings.SplitN(TrimIdentitySuffix(identity), " ", 3)
+	if len(arr) != 3 {
+		return
+	}
+	return arr[0], arr[1], arr[2]
+}
+
+// TrimIdentitySuffix trim the headers and cookies appended by identity policy,
+// the uri of request doesn't contain space, so they start from the space after uri
+func TrimIdentitySuffix(identity string) string {
+	count := 0
+	for i := 0; i < len(identity); i++ {
+		if identity[i] != spaceByte {
+			continue
+		}
+		count++
+		if count == 3 {
+			return identity[:i]
+		}
+	}
+	return identity
+}
+
 // GenerateETag generate eTag
 func GenerateETag(buf []byte) string {
 	size := len(buf)
@@ -41,6 +41,32 @@ func TestGetIdentity(t *testing.T) {
 	assert.Equal("GET aslant.site /users/v1/me?type=vip", string(GetIdentity(req)))
 }
 
+func TestParseIdentity(t *testing.T) {
+	assert := assert.New(t)
+	method, host, uri := ParseIdentity("GET aslant.site /users/v1/me?type=vip")
+	assert.Equal("GET", method)
+	assert.Equal("aslant.site", host)
+	assert.Equal("/users/v1/me?type=vip", uri)
+
+	// key策略添加的请求头与cookie不属于uri
+	method, host, uri = ParseIdentity("GET aslant.site /users/v1/me?type=vip h:X-Device=mobile pad c:lang=zh")
+	assert.Equal("GET", method)
+	assert.Equal("aslant.site", host)
+	assert.Equal("/users/v1/me?type=vip", uri)
+
+	method, host, uri = ParseIdentity("abcd")
+	assert.Empty(method)
+	assert.Empty(host)
+	assert.Empty(uri)
+}
+
+func TestTrimIdentitySuffix(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("GET aslant.site /users/v1/me", TrimIdentitySuffix("GET aslant.site /users/v1/me"))
+	assert.Equal("GET aslant.site /users/v1/me", TrimIdentitySuffix("GET aslant.site /users/v1/me h:X-Device=mobile c:lang="))
+	assert.Equal("abcd", TrimIdentitySuffix("abcd"))
+}
+
 func TestGenerateETag(t *testing.T) {
 	assert := assert.New(t)
 	assert.Equal(`"0-2jmj7l5rSw0yVb_vlWAYkK_YBwk="`, GenerateETag(nil))
@@ -12,7 +12,8 @@ import {
   HOME_PATH,
   INFLUXDB_PATH,
   CERTS_PATH,
-  ALARMS_PATH
+  ALARMS_PATH,
+  CLUSTER_PATH
 } from "./paths";
 import Caches from "./components/caches";
 import Compresses from "./components/compress";
@@ -24,6 +25,7 @@ import Home from "./components/home";
 import Certs from "./components/certs";
 import Influxdb from "./components/influxdb";
 import Alarms from "./components/alarms";
+import Cluster from "./components/cluster";
 
 function App() {
   return (
@@ -40,6 +42,7 @@ function App() {
           <Route path={CERTS_PATH} component={Certs} />
           <Route path={INFLUXDB_PATH} component={Influxdb} />
           <Route path={ALARMS_PATH} component={Alarms} />
+          <Route path={CLUSTER_PATH} component={Cluster} />
           <Route path={HOME_PATH} exact component={Home} />
         </div>
       </HashRouter>
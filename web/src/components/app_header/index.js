@@ -20,7 +20,8 @@ import {
   HOME_PATH,
   INFLUXDB_PATH,
   CERTS_PATH,
-  ALARMS_PATH
+  ALARMS_PATH,
+  CLUSTER_PATH
 } from "../../paths";
 
 const paths = [
@@ -59,6 +60,10 @@ const paths = [
   {
     name: getNavI18n("influxdb"),
     path: INFLUXDB_PATH
+  },
+  {
+    name: getNavI18n("cluster"),
+    path: CLUSTER_PATH
   }
 ];
 
@@ -103,6 +103,103 @@ const fields = [
     key: "purgedAt",
     placeholder: getCacheI18n("purgedAtPlaceholder")
   },
+  {
+    label: getCacheI18n("staleWhileRevalidate"),
+    key: "staleWhileRevalidate",
+    type: "number",
+    placeholder: getCacheI18n("staleWhileRevalidatePlaceholder")
+  },
+  {
+    label: getCacheI18n("staleIfError"),
+    key: "staleIfError",
+    type: "number",
+    placeholder: getCacheI18n("staleIfErrorPlaceholder")
+  },
+  {
+    label: getCacheI18n("maxMemory"),
+    key: "maxMemory",
+    type: "number",
+    placeholder: getCacheI18n("maxMemoryPlaceholder")
+  },
+  {
+    label: getCacheI18n("diskPath"),
+    key: "diskPath",
+    placeholder: getCacheI18n("diskPathPlaceholder")
+  },
+  {
+    label: getCacheI18n("diskSize"),
+    key: "diskSize",
+    type: "number",
+    placeholder: getCacheI18n("diskSizePlaceholder")
+  },
+  {
+    label: getCacheI18n("diskTTL"),
+    key: "diskTTL",
+    type: "number",
+    placeholder: getCacheI18n("diskTTLPlaceholder")
+  },
+  {
+    label: getCacheI18n("surrogateKeyHeader"),
+    key: "surrogateKeyHeader",
+    placeholder: getCacheI18n("surrogateKeyHeaderPlaceholder")
+  },
+  {
+    label: getCacheI18n("waitTimeout"),
+    key: "waitTimeout",
+    type: "duration",
+    placeholder: getCacheI18n("waitTimeoutPlaceholder")
+  },
+  {
+    label: getCacheI18n("waitTimeoutPass"),
+    key: "waitTimeoutPass",
+    type: "switch"
+  },
+  {
+    label: getCacheI18n("statusTTL"),
+    key: "statusTTL",
+    placeholder: [
+      getCacheI18n("statusTTLCodePlaceholder"),
+      getCacheI18n("statusTTLValuePlaceholder")
+    ],
+    type: "keyValueList"
+  },
+  {
+    label: getCacheI18n("eviction"),
+    key: "eviction",
+    options: ["lru", "tinylfu", "arc"],
+    type: "select",
+    placeholder: getCacheI18n("evictionPlaceholder")
+  },
+  {
+    label: getCacheI18n("storage"),
+    key: "storage",
+    options: ["heap", "arena"],
+    type: "select",
+    placeholder: getCacheI18n("storagePlaceholder")
+  },
+  {
+    label: getCacheI18n("admission"),
+    key: "admission",
+    type: "number",
+    placeholder: getCacheI18n("admissionPlaceholder")
+  },
+  {
+    label: getCacheI18n("admissionWindow"),
+    key: "admissionWindow",
+    type: "duration",
+    placeholder: getCacheI18n("admissionWindowPlaceholder")
+  },
+  {
+    label: getCacheI18n("janitorInterval"),
+    key: "janitorInterval",
+    type: "duration",
+    placeholder: getCacheI18n("janitorIntervalPlaceholder")
+  },
+  {
+    label: getCacheI18n("snapshotPath"),
+    key: "snapshotPath",
+    placeholder: getCacheI18n("snapshotPathPlaceholder")
+  },
   {
     label: getCommonI18n("description"),
     key: "description",
@@ -0,0 +1,130 @@
+import React from "react";
+import { Switch } from "antd";
+
+import Configs from "../configs";
+
+import { getClusterI18n, getCommonI18n } from "../../i18n";
+
+const category = "cluster";
+const renderList = row => {
+  if (!row) {
+    return;
+  }
+  const items = row.map(item => {
+    return <li key={item}>{item}</li>;
+  });
+  return <ul>{items}</ul>;
+};
+
+const columns = [
+  {
+    title: getClusterI18n("addr"),
+    dataIndex: "addr"
+  },
+  {
+    title: getClusterI18n("self"),
+    dataIndex: "self"
+  },
+  {
+    title: getClusterI18n("peers"),
+    dataIndex: "peers",
+    render: renderList
+  },
+  {
+    title: getClusterI18n("register"),
+    dataIndex: "register",
+    render: row => {
+      return <Switch disabled={true} defaultChecked={row} />;
+    }
+  },
+  {
+    title: getClusterI18n("enabled"),
+    dataIndex: "enabled",
+    render: row => {
+      return <Switch disabled={true} defaultChecked={row} />;
+    }
+  },
+  {
+    title: getCommonI18n("description"),
+    dataIndex: "description"
+  }
+];
+
+const fields = [
+  {
+    label: getClusterI18n("addr"),
+    key: "addr",
+    placeholder: getClusterI18n("addrPlaceHolder"),
+    rules: [
+      {
+        required: true
+      }
+    ]
+  },
+  {
+    label: getClusterI18n("self"),
+    key: "self",
+    placeholder: getClusterI18n("selfPlaceHolder"),
+    rules: [
+      {
+        required: true
+      }
+    ]
+  },
+  {
+    label: getClusterI18n("peers"),
+    key: "peers",
+    placeholder: getClusterI18n("peersPlaceHolder"),
+    type: "textList"
+  },
+  {
+    label: getClusterI18n("register"),
+    key: "register",
+    type: "switch"
+  },
+  {
+    label: getClusterI18n("replicas"),
+    key: "replicas",
+    type: "number",
+    placeholder: getClusterI18n("replicasPlaceHolder")
+  },
+  {
+    label: getClusterI18n("timeout"),
+    key: "timeout",
+    type: "duration",
+    placeholder: getClusterI18n("timeoutPlaceHolder")
+  },
+  {
+    label: getClusterI18n("token"),
+    key: "token",
+    placeholder: getClusterI18n("tokenPlaceHolder")
+  },
+  {
+    label: getClusterI18n("enabled"),
+    key: "enabled",
+    type: "switch"
+  },
+  {
+    label: getCommonI18n("description"),
+    key: "description",
+    type: "textarea",
+    placeholder: getCommonI18n("descriptionPlaceholder")
+  }
+];
+
+class Cluster extends Configs {
+  constructor(props) {
+    super(props);
+    Object.assign(this.state, {
+      disabledDelete: true,
+      single: true,
+      title: getClusterI18n("title"),
+      description: getClusterI18n("description"),
+      category,
+      columns,
+      fields
+    });
+  }
+}
+
+export default Cluster;
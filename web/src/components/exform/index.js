@@ -349,6 +349,140 @@ class UpstreamServersInput extends React.Component {
   }
 }
 
+class CacheRulesInput extends React.Component {
+  state = {
+    cacheRules: null
+  };
+  constructor(props) {
+    super(props);
+    const value = props.value || [];
+    if (value.length === 0) {
+      value.push(null);
+    }
+    this.state.cacheRules = value;
+  }
+  handleChange(index, value) {
+    const rules = this.state.cacheRules.slice(0);
+    rules[index] = Object.assign({}, rules[index], value);
+    this.setState({
+      cacheRules: rules
+    });
+    const { onChange } = this.props;
+    if (onChange) {
+      onChange(rules.filter(item => item && !!item.action));
+    }
+  }
+  renderRule(rule, index) {
+    const placeholder = this.props.placeholder || [];
+    return (
+      <div key={`rule-${index}`}>
+        <Row gutter={8}>
+          <Col span={6}>
+            <Input
+              onChange={e => {
+                this.handleChange(index, {
+                  path: e.target.value
+                });
+              }}
+              defaultValue={rule && rule.path}
+              type="text"
+              placeholder={placeholder[0]}
+              allowClear
+            />
+          </Col>
+          <Col span={5}>
+            <Input
+              onChange={e => {
+                this.handleChange(index, {
+                  contentType: e.target.value
+                });
+              }}
+              defaultValue={rule && rule.contentType}
+              type="text"
+              placeholder={placeholder[1]}
+              allowClear
+            />
+          </Col>
+          <Col span={3}>
+            <Input
+              onChange={e => {
+                this.handleChange(index, {
+                  statusCode: Number(e.target.value)
+                });
+              }}
+              defaultValue={rule && rule.statusCode}
+              type="number"
+              placeholder={placeholder[2]}
+            />
+          </Col>
+          <Col span={3}>
+            <Select
+              onChange={value => {
+                this.handleChange(index, {
+                  action: value
+                });
+              }}
+              defaultValue={rule && rule.action}
+            >
+              {["force", "max", "pass"].map(item => (
+                <Option key={item} value={item}>
+                  {item}
+                </Option>
+              ))}
+            </Select>
+          </Col>
+          <Col span={3}>
+            <Input
+              onChange={e => {
+                this.handleChange(index, {
+                  ttl: Number(e.target.value)
+                });
+              }}
+              defaultValue={rule && rule.ttl}
+              type="number"
+              placeholder={placeholder[3]}
+            />
+          </Col>
+          <Col span={3}>
+            <Switch
+              onChange={checked => {
+                this.handleChange(index, {
+                  stripCookie: checked
+                });
+              }}
+              checkedChildren="cookie"
+              unCheckedChildren="cookie"
+              defaultChecked={rule && rule.stripCookie}
+            />
+          </Col>
+        </Row>
+      </div>
+    );
+  }
+  render() {
+    const { cacheRules } = this.state;
+    const rules = cacheRules.map((item, index) => {
+      return this.renderRule(item, index);
+    });
+    return (
+      <div className="cacheRules">
+        {rules}
+        <Button
+          onClick={() => {
+            const rules = this.state.cacheRules.slice(0);
+            rules.push({});
+            this.setState({
+              cacheRules: rules
+            });
+          }}
+        >
+          {getCommonI18n("add").toUpperCase()}
+        </Button>
+      </div>
+    );
+  }
+}
+
 class FileUpload extends React.Component {
   render() {
     const { placeholder, onChange } = this.props;
@@ -483,6 +617,12 @@ class ExForm extends React.Component {
             decoratorOpts
           )(<UpstreamServersInput placeholder={item.placeholder || ""} />);
           break;
+        case "cacheRules":
+          decorator = getFieldDecorator(
+            key,
+            decoratorOpts
+          )(<CacheRulesInput placeholder={item.placeholder} />);
+          break;
         case "textList":
           decorator = getFieldDecorator(
             key,
@@ -118,6 +118,51 @@ const fields = [
     ],
     type: "keyValueList"
   },
+  {
+    label: getLocationI18n("cacheKeyIgnoreQuery"),
+    key: "cacheKeyIgnoreQuery",
+    placeholder: getLocationI18n("cacheKeyIgnoreQueryPlaceHolder"),
+    type: "textList"
+  },
+  {
+    label: getLocationI18n("cacheKeyQueryWhitelist"),
+    key: "cacheKeyQueryWhitelist",
+    placeholder: getLocationI18n("cacheKeyQueryWhitelistPlaceHolder"),
+    type: "textList"
+  },
+  {
+    label: getLocationI18n("cacheKeySortQuery"),
+    key: "cacheKeySortQuery",
+    type: "switch"
+  },
+  {
+    label: getLocationI18n("cacheKeyLowerHost"),
+    key: "cacheKeyLowerHost",
+    type: "switch"
+  },
+  {
+    label: getLocationI18n("cacheKeyHeaders"),
+    key: "cacheKeyHeaders",
+    placeholder: getLocationI18n("cacheKeyHeadersPlaceHolder"),
+    type: "textList"
+  },
+  {
+    label: getLocationI18n("cacheKeyCookies"),
+    key: "cacheKeyCookies",
+    placeholder: getLocationI18n("cacheKeyCookiesPlaceHolder"),
+    type: "textList"
+  },
+  {
+    label: getLocationI18n("cacheRules"),
+    key: "cacheRules",
+    placeholder: [
+      getLocationI18n("cacheRulePathPlaceHolder"),
+      getLocationI18n("cacheRuleContentTypePlaceHolder"),
+      getLocationI18n("cacheRuleStatusCodePlaceHolder"),
+      getLocationI18n("cacheRuleTTLPlaceHolder")
+    ],
+    type: "cacheRules"
+  },
   {
     label: getCommonI18n("description"),
     key: "description",
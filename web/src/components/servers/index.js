@@ -186,6 +186,17 @@ const fields = [
     type: "number",
     placeholder: getServerI18n("maxHeaderBytesPlaceHolder")
   },
+  {
+    label: getServerI18n("enabledPurge"),
+    key: "enabledPurge",
+    type: "switch"
+  },
+  {
+    label: getServerI18n("purgeACL"),
+    key: "purgeACL",
+    placeholder: getServerI18n("purgeACLPlaceHolder"),
+    type: "textList"
+  },
   {
     label: getCommonI18n("description"),
     key: "description",
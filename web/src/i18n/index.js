@@ -11,7 +11,8 @@ const navEn = {
   admin: "Admin",
   cert: "Certifications",
   influxdb: "Influxdb",
-  alarms: "Alarms"
+  alarms: "Alarms",
+  cluster: "Cluster"
 };
 const navZh = {
   caches: "缓存",
@@ -22,7 +23,8 @@ const navZh = {
   admin: "管理配置",
   cert: "证书",
   influxdb: "Influxdb",
-  alarms: "告警"
+  alarms: "告警",
+  cluster: "集群"
 };
 
 const commonEn = {
@@ -77,7 +79,48 @@ const cacheEn = {
   hitForPassRequireMessage: "The cache's hit for pass should be gt 0",
   purgedAt: "PurgedAt",
   purgedAtPlaceholder:
-    "Please input the regular purges, support cron format, eg: 0 0 * * *"
+    "Please input the regular purges, support cron format, eg: 0 0 * * *",
+  staleWhileRevalidate: "Stale While Revalidate",
+  staleWhileRevalidatePlaceholder:
+    "Please input the ttl of using expired cache while revalidating",
+  staleIfError: "Stale If Error",
+  staleIfErrorPlaceholder:
+    "Please input the ttl of using expired cache when fetching fails",
+  maxMemory: "Max Memory(MB)",
+  maxMemoryPlaceholder: "Please input the max memory usage of cache",
+  diskPath: "Disk Path",
+  diskPathPlaceholder:
+    "Please input the path of disk cache, evicted cache will be saved to disk",
+  diskSize: "Disk Size(MB)",
+  diskSizePlaceholder: "Please input the max disk usage of cache",
+  diskTTL: "Disk TTL",
+  diskTTLPlaceholder: "Please input the max ttl of disk cache",
+  surrogateKeyHeader: "Surrogate Key Header",
+  surrogateKeyHeaderPlaceholder:
+    "Please input the response header of cache tags, default is Surrogate-Key",
+  waitTimeout: "Wait Timeout",
+  waitTimeoutPlaceholder:
+    "Please input the timeout of waiting for the fetching request",
+  waitTimeoutPass: "Pass When Wait Timeout",
+  statusTTL: "Status TTL",
+  statusTTLCodePlaceholder: "Please input the status code, eg: 404",
+  statusTTLValuePlaceholder: "Please input the ttl, eg: 30s",
+  eviction: "Eviction",
+  evictionPlaceholder: "Please select the eviction policy, default is lru",
+  storage: "Storage",
+  storagePlaceholder: "Please select the storage of cache data, default is heap",
+  admission: "Admission",
+  admissionPlaceholder:
+    "Please input the request times(2-15) within the window before caching, empty means no limit",
+  admissionWindow: "Admission Window",
+  admissionWindowPlaceholder:
+    "Please input the window of counting request times, default is 1m",
+  janitorInterval: "Janitor Interval",
+  janitorIntervalPlaceholder:
+    "Please input the interval of removing expired caches, default is 10s",
+  snapshotPath: "Snapshot Path",
+  snapshotPathPlaceholder:
+    "Please input the snapshot file, caches will be saved when exiting and restored when starting"
 };
 const cacheZh = {
   createUpdateTitle: "创建或更新缓存",
@@ -96,7 +139,39 @@ const cacheZh = {
   hitForPassPlaceholder: "请输入hit for pass的有效期",
   hitForPassRequireMessage: "hit for pass的有效期必须大于0",
   purgedAt: "定期清除",
-  purgedAtPlaceholder: "请输入定期清除配置，支持cron表达式，如：0 0 * * *"
+  purgedAtPlaceholder: "请输入定期清除配置，支持cron表达式，如：0 0 * * *",
+  staleWhileRevalidate: "Stale While Revalidate",
+  staleWhileRevalidatePlaceholder: "请输入缓存过期后（后台刷新时）仍可使用的时长",
+  staleIfError: "Stale If Error",
+  staleIfErrorPlaceholder: "请输入缓存过期后获取数据失败时仍可使用的时长",
+  maxMemory: "最大内存(MB)",
+  maxMemoryPlaceholder: "请输入缓存可使用的最大内存",
+  diskPath: "磁盘缓存路径",
+  diskPathPlaceholder: "请输入磁盘缓存的保存路径，内存缓存淘汰的数据将保存至磁盘",
+  diskSize: "磁盘缓存大小(MB)",
+  diskSizePlaceholder: "请输入磁盘缓存可使用的最大空间",
+  diskTTL: "磁盘缓存有效期",
+  diskTTLPlaceholder: "请输入磁盘缓存的最长有效期",
+  surrogateKeyHeader: "缓存标签响应头",
+  surrogateKeyHeaderPlaceholder: "请输入缓存标签的响应头，默认为Surrogate-Key",
+  waitTimeout: "等待超时",
+  waitTimeoutPlaceholder: "请输入等待相同请求获取数据的超时时长",
+  waitTimeoutPass: "超时后转发",
+  statusTTL: "状态码缓存有效期",
+  statusTTLCodePlaceholder: "请输入状态码，如：404",
+  statusTTLValuePlaceholder: "请输入缓存有效期，如：30s",
+  eviction: "淘汰策略",
+  evictionPlaceholder: "请选择缓存的淘汰策略，默认为lru",
+  storage: "存储方式",
+  storagePlaceholder: "请选择缓存数据的存储方式，默认为heap",
+  admission: "准入次数",
+  admissionPlaceholder: "请输入时间窗口内请求多少次(2-15)后才缓存，为空则不限制",
+  admissionWindow: "准入时间窗口",
+  admissionWindowPlaceholder: "请输入统计请求次数的时间窗口，默认为1m",
+  janitorInterval: "过期清除间隔",
+  janitorIntervalPlaceholder: "请输入后台清除过期缓存的间隔，默认为10s",
+  snapshotPath: "快照文件",
+  snapshotPathPlaceholder: "请输入缓存快照的保存文件，退出时保存缓存并在启动时恢复"
 };
 
 const compressEn = {
@@ -193,7 +268,26 @@ const locationEn = {
   reqHeader: "Request Header",
   resHeader: "Response Header",
   headerNamePlaceHolder: "Please input the header's name, eg: X-Request-ID",
-  headerValuePlaceHolder: "Please input the header's value eg: 1001"
+  headerValuePlaceHolder: "Please input the header's value eg: 1001",
+  cacheKeyIgnoreQuery: "Cache Key Ignore Query",
+  cacheKeyIgnoreQueryPlaceHolder:
+    "Please input the query parameter ignored by cache key, eg: utm_*",
+  cacheKeyQueryWhitelist: "Cache Key Query Whitelist",
+  cacheKeyQueryWhitelistPlaceHolder:
+    "Please input the query parameter kept by cache key, eg: id",
+  cacheKeySortQuery: "Cache Key Sort Query",
+  cacheKeyLowerHost: "Cache Key Lower Host",
+  cacheKeyHeaders: "Cache Key Headers",
+  cacheKeyHeadersPlaceHolder:
+    "Please input the request header added to cache key, eg: Accept-Language",
+  cacheKeyCookies: "Cache Key Cookies",
+  cacheKeyCookiesPlaceHolder:
+    "Please input the cookie added to cache key, eg: lang",
+  cacheRules: "Cache Rules",
+  cacheRulePathPlaceHolder: "Path regexp, eg: ^/static/",
+  cacheRuleContentTypePlaceHolder: "Content type regexp, eg: image|css",
+  cacheRuleStatusCodePlaceHolder: "Status code",
+  cacheRuleTTLPlaceHolder: "TTL(seconds)"
 };
 const locationZh = {
   createUpdateTitle: "创建或更新location",
@@ -215,7 +309,22 @@ const locationZh = {
   reqHeader: "请求头",
   resHeader: "响应头",
   headerNamePlaceHolder: "请输入HTTP头的名称，如：X-Request-ID",
-  headerValuePlaceHolder: "请输入HTTP头的值，如：1001"
+  headerValuePlaceHolder: "请输入HTTP头的值，如：1001",
+  cacheKeyIgnoreQuery: "缓存key忽略的参数",
+  cacheKeyIgnoreQueryPlaceHolder: "请输入缓存key忽略的query参数，如：utm_*",
+  cacheKeyQueryWhitelist: "缓存key参数白名单",
+  cacheKeyQueryWhitelistPlaceHolder: "请输入缓存key保留的query参数，如：id",
+  cacheKeySortQuery: "缓存key参数排序",
+  cacheKeyLowerHost: "缓存key的host转换为小写",
+  cacheKeyHeaders: "缓存key的请求头",
+  cacheKeyHeadersPlaceHolder: "请输入添加至缓存key的请求头，如：Accept-Language",
+  cacheKeyCookies: "缓存key的cookie",
+  cacheKeyCookiesPlaceHolder: "请输入添加至缓存key的cookie，如：lang",
+  cacheRules: "缓存规则",
+  cacheRulePathPlaceHolder: "path正则，如：^/static/",
+  cacheRuleContentTypePlaceHolder: "Content-Type正则，如：image|css",
+  cacheRuleStatusCodePlaceHolder: "状态码",
+  cacheRuleTTLPlaceHolder: "缓存时长（秒）"
 };
 
 const serverEn = {
@@ -253,7 +362,11 @@ const serverEn = {
   idleTimeout: "IdleTimeout",
   idleTimeoutPlaceHolder: "Please input the idle timeout",
   maxHeaderBytes: "MaxHeaderBytes",
-  maxHeaderBytesPlaceHolder: "Please input the max header bytes limit"
+  maxHeaderBytesPlaceHolder: "Please input the max header bytes limit",
+  enabledPurge: "PURGE/BAN",
+  purgeACL: "Purge ACL",
+  purgeACLPlaceHolder:
+    "Please input the cidr which is allowed to purge, eg: 10.0.0.0/8"
 };
 const serverZh = {
   createUpdateTitle: "创建或更新HTTP服务器",
@@ -287,7 +400,10 @@ const serverZh = {
   idleTimeout: "空闲超时",
   idleTimeoutPlaceHolder: "请输入空闲超时参数",
   maxHeaderBytes: "最大请求头长度",
-  maxHeaderBytesPlaceHolder: "请输入最大请求头长度限制参数"
+  maxHeaderBytesPlaceHolder: "请输入最大请求头长度限制参数",
+  enabledPurge: "PURGE/BAN",
+  purgeACL: "清除缓存的访问控制",
+  purgeACLPlaceHolder: "请输入允许清除缓存的网段，如：10.0.0.0/8"
 };
 
 const adminEn = {
@@ -355,6 +471,42 @@ const certZh = {
   fileRequireMessage: "请先成功上传文件"
 };
 
+const clusterEn = {
+  title: "Cluster",
+  description: "Set the cluster's config, each cache key is owned by one node of consistent hash ring, other nodes get the cache from the owner before fetching from upstream",
+  addr: "Address",
+  addrPlaceHolder: "Please input the listen address of peer server, e.g.: :3016",
+  self: "Self",
+  selfPlaceHolder: "Please input the address of current node which other nodes can access, e.g.: 192.168.1.1:3016",
+  peers: "Peers",
+  peersPlaceHolder: "Please input the address of node, e.g.: 192.168.1.2:3016",
+  register: "Register",
+  replicas: "Replicas",
+  replicasPlaceHolder: "Please input the virtual nodes of each node(default 50)",
+  timeout: "Timeout",
+  timeoutPlaceHolder: "Please input the timeout of peer request(default 1s)",
+  token: "Token",
+  tokenPlaceHolder: "Please input the token of peer request",
+  enabled: "Enabled"
+};
+const clusterZh = {
+  title: "集群",
+  description: "设置集群的配置，缓存按一致性hash归属于某一节点，其它节点先从该节点获取缓存，获取失败再请求upstream",
+  addr: "地址",
+  addrPlaceHolder: "请输入节点间通讯的监听地址，如：:3016",
+  self: "本节点",
+  selfPlaceHolder: "请输入其它节点访问本节点的地址，如：192.168.1.1:3016",
+  peers: "节点",
+  peersPlaceHolder: "请输入节点地址，如：192.168.1.2:3016",
+  register: "注册",
+  replicas: "虚拟节点数",
+  replicasPlaceHolder: "请输入每个节点的虚拟节点数（默认为50）",
+  timeout: "超时",
+  timeoutPlaceHolder: "请输入节点间请求的超时（默认为1s）",
+  token: "Token",
+  tokenPlaceHolder: "请输入节点间请求的token",
+  enabled: "启用"
+};
 const influxdbEn = {
   title: "Influxdb",
   description: "Set influxdb's config for http stats",
@@ -431,7 +583,8 @@ const i18ns = {
     application: applicationEn,
     cert: certEn,
     influxdb: influxdbEn,
-    alarm: alarmEn
+    alarm: alarmEn,
+    cluster: clusterEn
   },
   zh: {
     common: commonZh,
@@ -445,7 +598,8 @@ const i18ns = {
     application: applicationZh,
     cert: certZh,
     influxdb: influxdbZh,
-    alarm: alarmZh
+    alarm: alarmZh,
+    cluster: clusterZh
   }
 };
 
@@ -520,3 +674,7 @@ export function getInfluxdbI18n(name) {
 export function getAlarmI18n(name) {
   return get(`alarm.${name}`);
 }
+
+export function getClusterI18n(name) {
+  return get(`cluster.${name}`);
+}
@@ -10,3 +10,4 @@ export const HOME_PATH = `${prefix}/`;
 export const CERTS_PATH = `${prefix}/certs`;
 export const INFLUXDB_PATH = `${prefix}/influxdb`;
 export const ALARMS_PATH = `${prefix}/alarms`;
+export const CLUSTER_PATH = `${prefix}/cluster`;